@@ -0,0 +1,54 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BlockscapeNetwork/signctrl/privval"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	drainRank   int
+	drainHeight int64
+	undrain     bool
+	drainCmd    = &cobra.Command{
+		Use:   "drain",
+		Short: "Takes a backup rank out of the promotion line",
+		Long:  "Schedules a drain of a rank at the given height by appending it to the config.toml, so the rank keeps its rank on rank updates and is skipped by the ranks below it. The drains must be the same across all validators in the set, so run this command with the same height on every node before that height",
+		Run: func(cmd *cobra.Command, args []string) {
+			if drainHeight <= 0 {
+				fmt.Println("--height must be set to the height at which the drain activates")
+				os.Exit(1)
+			}
+
+			dr, err := privval.RequestDrain(drainRank, !undrain, drainHeight)
+			if err != nil {
+				fmt.Printf("couldn't schedule drain: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Scheduled drain at height %v: drained ranks %v\nRun the same command on all validators in the set before height %v.\n", dr.Height, dr.Ranks, dr.Height)
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(drainCmd)
+	drainCmd.Flags().IntVar(&drainRank, "rank", 0, "Rank to drain (defaults to the node's own rank)")
+	if err := viper.BindPFlag("rank", drainCmd.Flags().Lookup("rank")); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	drainCmd.Flags().Int64Var(&drainHeight, "height", 0, "Height from which on the rank is drained (must be the same on all nodes)")
+	if err := viper.BindPFlag("height", drainCmd.Flags().Lookup("height")); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	drainCmd.Flags().BoolVar(&undrain, "undo", false, "Puts the rank back into the promotion line")
+	if err := viper.BindPFlag("undo", drainCmd.Flags().Lookup("undo")); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BlockscapeNetwork/signctrl/privval"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	handoverHeight int64
+	cancelHandover bool
+	handoverCmd    = &cobra.Command{
+		Use:   "handover",
+		Short: "Hands rank 1 over to rank 2",
+		Long:  "Makes the local rank 1 node stop signing at the given height, so rank 2 is promoted once its rank policy triggers a rank update and rank 1 shuts down",
+		Run: func(cmd *cobra.Command, args []string) {
+			if cancelHandover {
+				if err := privval.CancelHandover(); err != nil {
+					fmt.Printf("couldn't cancel handover: %v\n", err)
+					os.Exit(1)
+				}
+				fmt.Println("Canceled handover")
+				return
+			}
+
+			hr, err := privval.RequestHandover(handoverHeight)
+			if err != nil {
+				fmt.Printf("couldn't schedule handover: %v\n", err)
+				os.Exit(1)
+			}
+
+			fmt.Printf("Scheduled handover from rank 1 to rank 2:\n  Height %v: rank 1 stops signing\n", hr.Height)
+			if hr.PromoteHeight == 0 {
+				fmt.Printf("  Rank 2 is promoted and signs once the %v rank policy triggers a rank update, rank 1 shuts down\n", hr.Policy)
+				return
+			}
+			fmt.Printf("  Heights %v..%v: rank 1 refuses to sign, ranks 2..n count missed blocks\n  Height %v: rank 2 is promoted and signs, rank 1 shuts down\n", hr.Height, hr.PromoteHeight-1, hr.PromoteHeight)
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(handoverCmd)
+	handoverCmd.Flags().Int64Var(&handoverHeight, "height", 0, "Height at which rank 1 stops signing (defaults to the next height)")
+	if err := viper.BindPFlag("height", handoverCmd.Flags().Lookup("height")); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+	handoverCmd.Flags().BoolVar(&cancelHandover, "cancel", false, "Cancels a scheduled handover")
+	if err := viper.BindPFlag("cancel", handoverCmd.Flags().Lookup("cancel")); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
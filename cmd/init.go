@@ -13,11 +13,17 @@ import (
 
 var (
 	newPrivval bool
+	encryptKey bool
 	initCmd    = &cobra.Command{
 		Use:   "init",
 		Short: "Initializes the SignCTRL node",
 		Long:  "Creates the .signctrl/ directory, including a config.toml and a conn.key file",
 		Run: func(cmd *cobra.Command, args []string) {
+			if encryptKey && !newPrivval {
+				fmt.Println("--encrypt requires --new-pv")
+				os.Exit(1)
+			}
+
 			// Get the config directory.
 			cfgDir := config.Dir()
 
@@ -46,7 +52,7 @@ var (
 
 			// Create new priv_validator_key.json and priv_validator_state.json files if --new-pv flag is set.
 			if newPrivval {
-				if err := init_util.CreateKeyAndStateFiles(cfgDir); err != nil {
+				if err := init_util.CreateKeyAndStateFiles(cfgDir, encryptKey); err != nil {
 					fmt.Println(err)
 					os.Exit(1)
 				}
@@ -62,4 +68,9 @@ func init() {
 		fmt.Println(err)
 		os.Exit(1)
 	}
+	initCmd.Flags().BoolVar(&encryptKey, "encrypt", false, "Encrypts the new priv_validator_key.json with a passphrase (requires --new-pv)")
+	if err := viper.BindPFlag("encrypt", initCmd.Flags().Lookup("encrypt")); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
 }
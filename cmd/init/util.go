@@ -12,10 +12,10 @@ import (
 	tm_privval "github.com/tendermint/tendermint/privval"
 )
 
-// confirm asks the user for confirmation on file creation, like when a file is about
+// Confirm asks the user for confirmation on file creation, like when a file is about
 // to be overwritten. It handles "y" and "yes" for approval, and "", "n" and "no" for
 // denial.
-func confirm() bool {
+func Confirm() bool {
 	for {
 		input, err := bufio.NewReader(os.Stdin).ReadString('\n')
 		if err != nil {
@@ -41,7 +41,7 @@ func confirm() bool {
 func CreateConfigFile(cfgDir string) error {
 	if _, err := os.Stat(config.FilePath(cfgDir)); !os.IsNotExist(err) {
 		fmt.Printf("Found existing %v at %v. Do you want to overwrite it? [y(es)/N(o)]: ", config.File, cfgDir)
-		if confirm() {
+		if Confirm() {
 			os.Remove(config.FilePath(cfgDir))
 			if err := config.Create(cfgDir); err != nil {
 				return err
@@ -64,7 +64,7 @@ func CreateConfigFile(cfgDir string) error {
 func CreateConnKeyFile(cfgDir string) error {
 	if _, err := os.Stat(connection.KeyFilePath(cfgDir)); !os.IsNotExist(err) {
 		fmt.Printf("Found existing %v at %v. Do you want to overwrite it? [y(es)/N(o)]: ", connection.KeyFile, cfgDir)
-		if confirm() {
+		if Confirm() {
 			os.Remove(connection.KeyFilePath(cfgDir))
 			if err := connection.CreateBase64ConnKey(cfgDir); err != nil {
 				return err
@@ -82,21 +82,55 @@ func CreateConnKeyFile(cfgDir string) error {
 }
 
 // CreateKeyAndStateFiles creates the priv_validator_key.json and priv_validator_state.json
-// in the specified configuration directory. In case it already exists, the user is asked
-// to decide whether it should be overwritten or not.
-func CreateKeyAndStateFiles(cfgDir string) error {
+// in the specified configuration directory. If encrypt is set, the priv_validator_key.json
+// is encrypted with a passphrase. In case it already exists, the user is asked to decide
+// whether it should be overwritten or not.
+func CreateKeyAndStateFiles(cfgDir string, encrypt bool) error {
 	if _, err := os.Stat(privval.KeyFilePath(cfgDir)); !os.IsNotExist(err) {
 		fmt.Printf("Found existing priv_validator_key.json at %v. Do you want to overwrite it? [y(es)/N(o)]: ", cfgDir)
-		if confirm() {
-			os.Remove(privval.KeyFilePath(cfgDir))
-			os.Remove(privval.StateFilePath(cfgDir))
-			tm_privval.LoadOrGenFilePV(privval.KeyFilePath(cfgDir), privval.StateFilePath(cfgDir))
+		if Confirm() {
+			if err := genKeyAndStateFiles(cfgDir, encrypt); err != nil {
+				return err
+			}
 			fmt.Printf("Created new priv_validator_key.json and priv_validator_state.json at %v ✓\n", cfgDir)
 		}
 	} else {
-		tm_privval.LoadOrGenFilePV(privval.KeyFilePath(cfgDir), privval.StateFilePath(cfgDir))
+		if err := genKeyAndStateFiles(cfgDir, encrypt); err != nil {
+			return err
+		}
 		fmt.Printf("Created priv_validator_key.json and priv_validator_state.json at %v ✓\n", cfgDir)
 	}
 
 	return nil
 }
+
+// genKeyAndStateFiles generates a new key and saves it along with an empty state. An
+// encrypted key never touches the disk in plain text. The passphrase is read and
+// confirmed first, and both files are written atomically, so existing ones are only
+// replaced once the new key is ready.
+func genKeyAndStateFiles(cfgDir string, encrypt bool) error {
+	var passphrase []byte
+	if encrypt {
+		var err error
+		if passphrase, err = privval.ReadPassphrase("Enter new passphrase for priv_validator_key.json: ", true); err != nil {
+			return err
+		}
+	}
+
+	pv := tm_privval.GenFilePV(privval.KeyFilePath(cfgDir), privval.StateFilePath(cfgDir))
+	if !encrypt {
+		pv.Save()
+		return nil
+	}
+
+	k, err := privval.EncryptKey(pv.Key.PrivKey, passphrase)
+	if err != nil {
+		return err
+	}
+	if err := k.Save(privval.KeyFilePath(cfgDir)); err != nil {
+		return err
+	}
+	pv.LastSignState.Save()
+
+	return nil
+}
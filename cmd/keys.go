@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/BlockscapeNetwork/signctrl/privval"
+	"github.com/spf13/cobra"
+)
+
+var (
+	keysCmd = &cobra.Command{
+		Use:   "keys",
+		Short: "Manages the priv_validator_key.json",
+	}
+
+	keysEncryptCmd = &cobra.Command{
+		Use:   "encrypt",
+		Short: "Encrypts the priv_validator_key.json in place",
+		Long:  "Encrypts the plain text priv_validator_key.json in the configuration directory with a passphrase. The encrypted key is decrypted again and compared to the original before it replaces the original. The passphrase is read from the file descriptor in " + privval.PassphraseFDEnv + ", from " + privval.PassphraseEnv + " or from a prompt",
+		Run: func(cmd *cobra.Command, args []string) {
+			path := privval.KeyFilePath(config.Dir())
+			encrypted, err := privval.IsKeyFileEncrypted(path)
+			if err != nil {
+				fmt.Printf("couldn't load %v: %v\n", privval.KeyFile, err)
+				os.Exit(1)
+			}
+			if encrypted {
+				fmt.Printf("%v is already encrypted\n", path)
+				return
+			}
+
+			passphrase, err := privval.ReadPassphrase(fmt.Sprintf("Enter new passphrase for %v: ", privval.KeyFile), true)
+			if err != nil {
+				fmt.Println(err)
+				os.Exit(1)
+			}
+			if err := privval.EncryptKeyFile(path, passphrase); err != nil {
+				fmt.Printf("couldn't encrypt %v: %v\n", privval.KeyFile, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Encrypted %v ✓\n", path)
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(keysCmd)
+	keysCmd.AddCommand(keysEncryptCmd)
+}
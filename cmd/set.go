@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BlockscapeNetwork/signctrl/privval"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+var (
+	setURLs []string
+	setCmd  = &cobra.Command{
+		Use:   "set",
+		Short: "Inspects the SignCTRL set",
+	}
+	setCheckCmd = &cobra.Command{
+		Use:   "check",
+		Short: "Checks the ranks across the SignCTRL set",
+		Long:  "Queries the /status endpoint of every validator in the set and checks that the ranks are unique and contiguous, and that all validators agree on set_size, threshold and drained ranks",
+		Run: func(cmd *cobra.Command, args []string) {
+			if len(setURLs) == 0 {
+				fmt.Println("no status URLs given, use --urls")
+				os.Exit(1)
+			}
+
+			statuses := make(map[string]*privval.StatusResponse)
+			for _, url := range setURLs {
+				sr, err := privval.GetStatusFrom(url)
+				if err != nil {
+					fmt.Printf("couldn't get status from %v: %v\n", url, err)
+					os.Exit(1)
+				}
+				statuses[url] = sr
+				fmt.Printf("%v: rank %v/%v at height %v\n", url, sr.Rank, sr.SetSize, sr.Height)
+			}
+
+			if err := privval.CheckSet(statuses); err != nil {
+				fmt.Printf("SignCTRL set is inconsistent:\n%v", err)
+				os.Exit(1)
+			}
+
+			fmt.Println("SignCTRL set is consistent")
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(setCmd)
+	setCmd.AddCommand(setCheckCmd)
+	setCheckCmd.Flags().StringSliceVar(&setURLs, "urls", nil, "Status URLs of all validators in the set, e.g. http://10.0.0.1:8080/status")
+	if err := viper.BindPFlag("urls", setCheckCmd.Flags().Lookup("urls")); err != nil {
+		fmt.Println(err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,36 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/BlockscapeNetwork/signctrl/connection"
+	"github.com/spf13/cobra"
+)
+
+var (
+	showConnKeyCmd = &cobra.Command{
+		Use:   "show-conn-key",
+		Short: "Shows the public key of the conn.key",
+		Long:  "Prints out the public key and key ID of the conn.key, so it can be pinned on the validator's side",
+		Run: func(cmd *cobra.Command, args []string) {
+			connKey, err := connection.LoadConnKey(config.Dir())
+			if err != nil {
+				fmt.Printf("couldn't load %v: %v\n", connection.KeyFile, err)
+				os.Exit(1)
+			}
+
+			pubkey := connKey.PubKey()
+			fmt.Printf(`Public key of SignCTRL's %v:
+  Public key: %v
+  Key ID:     %v
+`, connection.KeyFile, base64.StdEncoding.EncodeToString(pubkey.Bytes()), connection.KeyID(pubkey))
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(showConnKeyCmd)
+}
@@ -9,6 +9,7 @@ import (
 	"syscall"
 	"time"
 
+	init_util "github.com/BlockscapeNetwork/signctrl/cmd/init"
 	"github.com/BlockscapeNetwork/signctrl/config"
 	"github.com/BlockscapeNetwork/signctrl/privval"
 	"github.com/BlockscapeNetwork/signctrl/types"
@@ -16,7 +17,6 @@ import (
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
-	tm_privval "github.com/tendermint/tendermint/privval"
 )
 
 var (
@@ -41,25 +41,32 @@ var (
 			}
 			logger.SetOutput(filter)
 
-			// Load the state.
-			state, err := config.LoadOrGenState(cfgDir)
+			// Load the state. If it's corrupted, ask the user whether to fall back to the
+			// backup of the previous state.
+			state, err := config.LoadOrGenState(cfgDir, func(err error) bool {
+				fmt.Printf("couldn't load %v:\n%v\nDo you want to fall back to %v? [y(es)/N(o)]: ", config.StateFile, err, config.StateBackupFile)
+				return init_util.Confirm()
+			})
 			if err != nil {
 				fmt.Printf("couldn't load %v:\n%v\n", config.StateFile, err)
 				os.Exit(1)
 			}
 
+			// Create the signing backend.
+			backend, err := privval.NewBackend(cfgDir, cfg, logger)
+			if err != nil {
+				fmt.Printf("couldn't create signing backend:\n%v\n", err)
+				os.Exit(1)
+			}
+
 			// Initialize a new SCFilePV.
 			pv := privval.NewSCFilePV(
 				logger,
 				cfg,
 				state,
-				tm_privval.LoadOrGenFilePV(
-					privval.KeyFilePath(cfgDir),
-					privval.StateFilePath(cfgDir),
-				),
+				backend,
 				&http.Server{Addr: fmt.Sprintf(":%v", privval.DefaultHTTPPort)},
 			)
-			pv.Gauges = types.RegisterGauges()
 
 			// Start the SignCTRL service.
 			if err := pv.Start(); err != nil {
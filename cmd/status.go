@@ -12,7 +12,7 @@ var (
 	statusCmd = &cobra.Command{
 		Use:   "status",
 		Short: "Shows the node's status",
-		Long:  "Prints out the current height, rank and missed block counter",
+		Long:  "Prints out the current height, rank, missed block counter and drained ranks",
 		Run: func(cmd *cobra.Command, args []string) {
 			sr, err := privval.GetStatus()
 			if err != nil {
@@ -24,7 +24,8 @@ var (
   Height:  %v
   Rank:    %v/%v
   Counter: %v/%v
-`, sr.Height, sr.Rank, sr.SetSize, sr.Counter, sr.Threshold)
+  Drained: %v
+`, sr.Height, sr.Rank, sr.SetSize, sr.Counter, sr.Threshold, sr.Drained)
 		},
 	}
 )
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/spf13/cobra"
+)
+
+var (
+	unfenceCmd = &cobra.Command{
+		Use:   "unfence",
+		Short: "Lifts the fence after a self-induced shutdown",
+		Long:  "Removes the fence from the signctrl_state.json, so SignCTRL signs again. Only use this while SignCTRL is stopped and after the validator daemon has been restarted",
+		Run: func(cmd *cobra.Command, args []string) {
+			state, err := config.LoadOrGenState(config.Dir(), nil)
+			if err != nil {
+				fmt.Printf("couldn't load %v: %v\n", config.StateFile, err)
+				os.Exit(1)
+			}
+			if state.Fence == nil {
+				fmt.Println("SignCTRL is not fenced")
+				return
+			}
+
+			height := state.Fence.Height
+			state.Fence = nil
+			if err := state.Save(config.Dir()); err != nil {
+				fmt.Printf("couldn't save %v: %v\n", config.StateFile, err)
+				os.Exit(1)
+			}
+			fmt.Printf("Lifted the fence set at block height %v\n", height)
+		},
+	}
+)
+
+func init() {
+	rootCmd.AddCommand(unfenceCmd)
+}
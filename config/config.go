@@ -1,9 +1,12 @@
 package config
 
 import (
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"net"
+	"net/url"
 	"os"
 	"path/filepath"
 	"regexp"
@@ -14,11 +17,41 @@ import (
 	"github.com/BlockscapeNetwork/signctrl/types"
 	"github.com/hashicorp/logutils"
 	"github.com/spf13/viper"
+	tm_crypto "github.com/tendermint/tendermint/crypto"
+	tm_ed25519 "github.com/tendermint/tendermint/crypto/ed25519"
+	tm_tmhash "github.com/tendermint/tendermint/crypto/tmhash"
+	tm_bytes "github.com/tendermint/tendermint/libs/bytes"
 )
 
 const (
 	// File is the full file name of the configuration file.
 	File = "config.toml"
+
+	// ModeDial makes SignCTRL dial the validator.
+	ModeDial = "dial"
+
+	// ModeListen makes SignCTRL listen for the validator to connect.
+	ModeListen = "listen"
+
+	// DefaultTrustPeriod is the trusting period of the light client if none is
+	// specified.
+	DefaultTrustPeriod = 168 * time.Hour
+
+	// DefaultPeerInterval is the interval in which the members of the set exchange
+	// their status if none is specified.
+	DefaultPeerInterval = 5 * time.Second
+
+	// DefaultUpstreamTimeout is the read/write timeout for requests to an upstream
+	// signer if none is specified.
+	DefaultUpstreamTimeout = 3 * time.Second
+
+	// MinThresholdTime is the lowest threshold_time that's accepted for the "time"
+	// rank policy. Lower values leave the validator no time to recover from a hiccup.
+	MinThresholdTime = 10 * time.Second
+
+	// MaxThresholdTime is the highest threshold_time that's accepted for the "time"
+	// rank policy. Higher values defeat the purpose of a failover.
+	MaxThresholdTime = time.Hour
 )
 
 // Base defines the base configuration parameters for SignCTRL.
@@ -30,23 +63,70 @@ type Base struct {
 	// SetSize determines the number of validators in the SignCTRL set.
 	SetSize int `mapstructure:"set_size"`
 
+	// SetChanges are the changes of the set size at pre-agreed block heights, in
+	// ascending order of their heights.
+	SetChanges []SetChange `mapstructure:"set_changes"`
+
+	// Drains take backup ranks out of the promotion line at pre-agreed block heights,
+	// in ascending order of their heights.
+	Drains []Drain `mapstructure:"drains"`
+
 	// Threshold determines the threshold value of missed blocks in a row that
 	// triggers a rank update in the SignCTRL set.
 	Threshold int `mapstructure:"threshold"`
 
+	// RankPolicy determines the rule that triggers a rank update in the SignCTRL set.
+	// Can be "consecutive", "window" or "time". Defaults to "consecutive" if empty.
+	RankPolicy string `mapstructure:"rank_policy"`
+
+	// Window is the number of last blocks in which {threshold} missed blocks trigger
+	// a rank update with the "window" rank policy.
+	Window int `mapstructure:"window"`
+
+	// ThresholdTime is the time the validator's commitsig must be missing, measured
+	// with the block times, to trigger a rank update with the "time" rank policy.
+	ThresholdTime string `mapstructure:"threshold_time"`
+
 	// StartRank determines the validator's rank on startup and therefore whether it
 	// has permission to sign votes/proposals or not.
 	StartRank int `mapstructure:"start_rank"`
 
+	// Mode determines whether SignCTRL dials the validator ("dial") or listens for
+	// the validator to connect ("listen"). Defaults to "dial" if empty.
+	Mode string `mapstructure:"mode"`
+
+	// SignerListenAddress is the TCP or unix domain socket address SignCTRL listens
+	// on for the validator to connect in listen mode.
+	SignerListenAddress string `mapstructure:"signer_laddr"`
+
+	// Rejoin determines whether SignCTRL rejoins the set on the lowest free rank
+	// instead of shutting down if its rank has been rendered obsolete.
+	Rejoin bool `mapstructure:"rejoin"`
+
 	// ValidatorListenAddress is the TCP socket address the validator listens on for
 	// an external PrivValidator process. SignCTRL dials this address to establish a
 	// connection with the validator.
 	ValidatorListenAddress string `mapstructure:"validator_laddr"`
 
+	// ValidatorConnPubKeys are the public keys of the validator's secret connection
+	// that SignCTRL accepts, either base64-encoded or as key IDs. If empty, any
+	// public key is accepted.
+	ValidatorConnPubKeys []string `mapstructure:"validator_conn_pubkeys"`
+
 	// ValidatorListenAddressRPC is the TCP socket address the validator's RPC server
 	// listens on.
 	ValidatorListenAddressRPC string `mapstructure:"validator_laddr_rpc"`
 
+	// FallbackListenAddressesRPC are the TCP socket addresses of further RPC servers
+	// of the same chain. They are queried for blocks if the validator's RPC server
+	// fails.
+	FallbackListenAddressesRPC []string `mapstructure:"fallback_laddrs_rpc"`
+
+	// RPCQuorum is the number of RPC servers that must agree that the validator's
+	// commitsig is missing from a block before it's counted as missed. 0 and 1 both
+	// let a single RPC server decide.
+	RPCQuorum int `mapstructure:"rpc_quorum"`
+
 	// RetryDialAfter is the time after which SignCTRL assumes it lost connection to
 	// the validator and retries dialing it.
 	RetryDialAfter string `mapstructure:"retry_dial_after"`
@@ -77,6 +157,37 @@ func validateAddress(addr string, addrName string) error {
 	return nil
 }
 
+// validateConnPubKey validates a pinned connection public key, which is either a
+// base64-encoded ed25519 public key or a hex-encoded key ID.
+func validateConnPubKey(pubkey string) error {
+	if id, err := hex.DecodeString(pubkey); err == nil && len(id) == tm_crypto.AddressSize {
+		return nil
+	}
+	if key, err := base64.StdEncoding.DecodeString(pubkey); err == nil && len(key) == tm_ed25519.PubKeySize {
+		return nil
+	}
+
+	return fmt.Errorf("%v is neither a base64-encoded ed25519 public key nor a key ID", pubkey)
+}
+
+// GetThresholdTime returns the parsed ThresholdTime, or 0 if it's invalid.
+func (b Base) GetThresholdTime() time.Duration {
+	threshold, _ := time.ParseDuration(b.ThresholdTime)
+	return threshold
+}
+
+// NewRankPolicy creates the rank policy specified in the config.toml.
+func (b Base) NewRankPolicy() types.RankPolicy {
+	switch b.RankPolicy {
+	case types.PolicyWindow:
+		return types.NewWindowPolicy(b.Threshold, b.Window)
+	case types.PolicyTime:
+		return types.NewTimePolicy(b.GetThresholdTime())
+	default:
+		return types.NewConsecutivePolicy(b.Threshold)
+	}
+}
+
 // validate validates the configuration's base section.
 func (b Base) validate() error {
 	var errs string
@@ -92,12 +203,49 @@ func (b Base) validate() error {
 	if b.StartRank < 1 {
 		errs += "\tstart_rank must be 1 or higher\n"
 	}
-	if err := validateAddress(b.ValidatorListenAddress, "validator_laddr"); err != nil {
-		errs += fmt.Sprintf("\t%v\n", err.Error())
+	errs += b.validateSetChanges()
+	errs += b.validateDrains()
+	switch b.RankPolicy {
+	case "", types.PolicyConsecutive:
+	case types.PolicyWindow:
+		if b.Window < b.Threshold {
+			errs += "\twindow must be equal to or higher than threshold\n"
+		}
+	case types.PolicyTime:
+		if threshold, err := time.ParseDuration(b.ThresholdTime); err != nil || threshold < MinThresholdTime || threshold > MaxThresholdTime {
+			errs += fmt.Sprintf("\tthreshold_time must be a duration between %v and %v, e.g. \"1m\"\n", MinThresholdTime, MaxThresholdTime)
+		}
+	default:
+		errs += fmt.Sprintf("\trank_policy must be either %v, %v or %v\n", types.PolicyConsecutive, types.PolicyWindow, types.PolicyTime)
+	}
+	switch b.Mode {
+	case "", ModeDial:
+		if err := validateAddress(b.ValidatorListenAddress, "validator_laddr"); err != nil {
+			errs += fmt.Sprintf("\t%v\n", err.Error())
+		}
+	case ModeListen:
+		if err := validateAddress(b.SignerListenAddress, "signer_laddr"); err != nil {
+			errs += fmt.Sprintf("\t%v\n", err.Error())
+		}
+	default:
+		errs += fmt.Sprintf("\tmode must be either %v or %v\n", ModeDial, ModeListen)
 	}
 	if err := validateAddress(b.ValidatorListenAddressRPC, "validator_laddr_rpc"); err != nil {
 		errs += fmt.Sprintf("\t%v\n", err.Error())
 	}
+	for _, pubkey := range b.ValidatorConnPubKeys {
+		if err := validateConnPubKey(pubkey); err != nil {
+			errs += fmt.Sprintf("\tvalidator_conn_pubkeys: %v\n", err.Error())
+		}
+	}
+	for i, addr := range b.FallbackListenAddressesRPC {
+		if err := validateAddress(addr, fmt.Sprintf("fallback_laddrs_rpc[%v]", i)); err != nil {
+			errs += fmt.Sprintf("\t%v\n", err.Error())
+		}
+	}
+	if b.RPCQuorum < 0 || b.RPCQuorum > 1+len(b.FallbackListenAddressesRPC) {
+		errs += "\trpc_quorum must be between 0 and the number of RPC servers\n"
+	}
 	if b.RetryDialAfter == "" {
 		errs += "\tretry_dial_after must not be empty\n"
 	} else {
@@ -122,6 +270,19 @@ func (b Base) validate() error {
 type PrivValidator struct {
 	// ChainID is the chain that the validator validates for.
 	ChainID string `mapstructure:"chain_id"`
+
+	// Backend is the signing backend that holds the validator's key. Defaults to
+	// "file" if empty.
+	Backend string `mapstructure:"backend"`
+
+	// PKCS11 defines the [privval.pkcs11] section of the configuration file.
+	PKCS11 PKCS11 `mapstructure:"pkcs11"`
+
+	// Vault defines the [privval.vault] section of the configuration file.
+	Vault Vault `mapstructure:"vault"`
+
+	// Upstream defines the [privval.upstream] section of the configuration file.
+	Upstream Upstream `mapstructure:"upstream"`
 }
 
 // validate validates the configuration's privval section.
@@ -130,6 +291,298 @@ func (p PrivValidator) validate() error {
 	if p.ChainID == "" {
 		errs += "\tchain_id must not be empty\n"
 	}
+	switch p.Backend {
+	case "pkcs11":
+		errs += p.PKCS11.validate()
+	case "vault":
+		errs += p.Vault.validate()
+	case "upstream":
+		errs += p.Upstream.validate()
+	}
+	if errs != "" {
+		return errors.New(errs)
+	}
+
+	return nil
+}
+
+// PKCS11 defines the configuration parameters for the "pkcs11" signing backend, which
+// keeps the validator's ed25519 key in an HSM.
+type PKCS11 struct {
+	// Module is the path to the HSM's PKCS#11 module.
+	Module string `mapstructure:"module"`
+
+	// Slot is the ID of the slot that holds the token with the validator's key.
+	Slot uint `mapstructure:"slot"`
+
+	// KeyLabel is the label of the validator's key pair on the token.
+	KeyLabel string `mapstructure:"key_label"`
+
+	// PINFile is the path to the file that contains the token's user PIN.
+	PINFile string `mapstructure:"pin_file"`
+}
+
+// validate validates the configuration's privval.pkcs11 section and returns the
+// errors in the same format as the other sections.
+func (p PKCS11) validate() string {
+	var errs string
+	if p.Module == "" {
+		errs += "\tpkcs11.module must not be empty\n"
+	}
+	if p.KeyLabel == "" {
+		errs += "\tpkcs11.key_label must not be empty\n"
+	}
+	if p.PINFile == "" {
+		errs += "\tpkcs11.pin_file must not be empty\n"
+	}
+
+	return errs
+}
+
+// Vault defines the configuration parameters for the "vault" signing backend, which
+// signs with an ed25519 key in HashiCorp Vault's Transit secrets engine.
+type Vault struct {
+	// Address is the URL of the Vault server.
+	Address string `mapstructure:"address"`
+
+	// Mount is the path the Transit secrets engine is mounted at. Defaults to
+	// "transit" if empty.
+	Mount string `mapstructure:"mount"`
+
+	// KeyName is the name of the validator's ed25519 key in the Transit secrets engine.
+	KeyName string `mapstructure:"key_name"`
+
+	// TokenFile is the path to the file that contains the Vault token, if token auth
+	// is used.
+	TokenFile string `mapstructure:"token_file"`
+
+	// RoleID is the role ID, if AppRole auth is used.
+	RoleID string `mapstructure:"role_id"`
+
+	// SecretIDFile is the path to the file that contains the secret ID, if AppRole
+	// auth is used.
+	SecretIDFile string `mapstructure:"secret_id_file"`
+
+	// CACert is the path to the PEM-encoded CA certificate that verifies the Vault
+	// server's certificate. The system's CAs are used if empty.
+	CACert string `mapstructure:"ca_cert"`
+
+	// ClientCert is the path to the PEM-encoded client certificate for mutual TLS.
+	ClientCert string `mapstructure:"client_cert"`
+
+	// ClientKey is the path to the PEM-encoded key of the client certificate.
+	ClientKey string `mapstructure:"client_key"`
+}
+
+// GetMount returns the mount path of the Transit secrets engine, or "transit" if
+// none is specified.
+func (v Vault) GetMount() string {
+	if v.Mount == "" {
+		return "transit"
+	}
+
+	return strings.Trim(v.Mount, "/")
+}
+
+// validate validates the configuration's privval.vault section and returns the
+// errors in the same format as the other sections.
+func (v Vault) validate() string {
+	var errs string
+	if u, err := url.Parse(v.Address); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		errs += "\tvault.address must be an http(s) URL\n"
+	}
+	if v.KeyName == "" {
+		errs += "\tvault.key_name must not be empty\n"
+	}
+	approle := v.RoleID != "" || v.SecretIDFile != ""
+	switch {
+	case v.TokenFile == "" && !approle:
+		errs += "\tvault requires either token_file or role_id and secret_id_file\n"
+	case v.TokenFile != "" && approle:
+		errs += "\tvault.token_file must not be used with role_id and secret_id_file\n"
+	case approle && (v.RoleID == "" || v.SecretIDFile == ""):
+		errs += "\tvault.role_id and vault.secret_id_file must be used together\n"
+	}
+	if (v.ClientCert == "") != (v.ClientKey == "") {
+		errs += "\tvault.client_cert and vault.client_key must be used together\n"
+	}
+
+	return errs
+}
+
+// Upstream defines the configuration parameters for the "upstream" signing backend,
+// which forwards sign requests to a remote signer like tmkms or horcrux.
+type Upstream struct {
+	// ListenAddress is the TCP or unix domain socket address the upstream signer
+	// connects to, just like it would connect to the validator's priv_validator_laddr.
+	ListenAddress string `mapstructure:"laddr"`
+
+	// ConnPubKeys are the public keys of the upstream signer's secret connection that
+	// SignCTRL accepts, either base64-encoded or as key IDs. If empty, any public key
+	// is accepted.
+	ConnPubKeys []string `mapstructure:"conn_pubkeys"`
+
+	// Timeout is the read/write timeout for requests to the upstream signer.
+	Timeout string `mapstructure:"timeout"`
+}
+
+// GetTimeout returns the read/write timeout for requests to the upstream signer, or
+// DefaultUpstreamTimeout if none is specified.
+func (u Upstream) GetTimeout() time.Duration {
+	if timeout, err := time.ParseDuration(u.Timeout); err == nil && timeout > 0 {
+		return timeout
+	}
+
+	return DefaultUpstreamTimeout
+}
+
+// validate validates the configuration's privval.upstream section and returns the
+// errors in the same format as the other sections.
+func (u Upstream) validate() string {
+	var errs string
+	if err := validateAddress(u.ListenAddress, "upstream.laddr"); err != nil {
+		errs += fmt.Sprintf("\t%v\n", err.Error())
+	}
+	for _, pubkey := range u.ConnPubKeys {
+		if err := validateConnPubKey(pubkey); err != nil {
+			errs += fmt.Sprintf("\tupstream.conn_pubkeys: %v\n", err.Error())
+		}
+	}
+	if u.Timeout != "" {
+		if timeout, err := time.ParseDuration(u.Timeout); err != nil || timeout <= 0 {
+			errs += "\tupstream.timeout must be a positive duration, e.g. \"3s\"\n"
+		}
+	}
+
+	return errs
+}
+
+// Light defines the configuration parameters for the light client that verifies
+// blocks before they are counted as missed.
+type Light struct {
+	// TrustPeriod is the light client's trusting period. It should be significantly
+	// less than the chain's unbonding period.
+	TrustPeriod string `mapstructure:"trust_period"`
+
+	// TrustHeight is the height of a trusted header. If neither TrustHeight nor
+	// TrustHash are set, the latest header of the validator's RPC server is trusted.
+	TrustHeight int64 `mapstructure:"trust_height"`
+
+	// TrustHash is the hex-encoded hash of the trusted header at TrustHeight.
+	TrustHash string `mapstructure:"trust_hash"`
+}
+
+// GetTrustPeriod returns the light client's trusting period, or DefaultTrustPeriod
+// if none is specified.
+func (l Light) GetTrustPeriod() time.Duration {
+	if period, err := time.ParseDuration(l.TrustPeriod); err == nil {
+		return period
+	}
+
+	return DefaultTrustPeriod
+}
+
+// GetTrustHash returns the decoded TrustHash.
+func (l Light) GetTrustHash() tm_bytes.HexBytes {
+	hash, _ := hex.DecodeString(l.TrustHash)
+	return hash
+}
+
+// validate validates the configuration's light section.
+func (l Light) validate() error {
+	var errs string
+	if l.TrustPeriod != "" {
+		if period, err := time.ParseDuration(l.TrustPeriod); err != nil || period <= 0 {
+			errs += "\ttrust_period must be a positive duration, e.g. \"168h\"\n"
+		}
+	}
+	if l.TrustHeight < 0 {
+		errs += "\ttrust_height must be 0 or higher\n"
+	}
+	if (l.TrustHeight == 0) != (l.TrustHash == "") {
+		errs += "\ttrust_height and trust_hash must either both be set or both be empty\n"
+	}
+	if l.TrustHash != "" {
+		if hash, err := hex.DecodeString(l.TrustHash); err != nil || len(hash) != tm_tmhash.Size {
+			errs += fmt.Sprintf("\ttrust_hash must be a hex-encoded hash of %v bytes\n", tm_tmhash.Size)
+		}
+	}
+	if errs != "" {
+		return errors.New(errs)
+	}
+
+	return nil
+}
+
+// Peers defines the configuration parameters for the optional coordination channel
+// between the members of the set.
+type Peers struct {
+	// ListenAddress is the TCP socket address SignCTRL listens on for the other
+	// members of the set. If empty, the coordination channel is disabled.
+	ListenAddress string `mapstructure:"laddr"`
+
+	// Addresses are the other members of the set in the <pubkey>@tcp://host:port
+	// format, with the pubkey being the member's conn.key public key or key ID.
+	Addresses []string `mapstructure:"addrs"`
+
+	// Interval is the interval in which the members exchange their status.
+	Interval string `mapstructure:"interval"`
+}
+
+// Enabled checks whether the coordination channel is enabled.
+func (p Peers) Enabled() bool {
+	return p.ListenAddress != ""
+}
+
+// GetInterval returns the interval in which the members exchange their status, or
+// DefaultPeerInterval if none is specified.
+func (p Peers) GetInterval() time.Duration {
+	if interval, err := time.ParseDuration(p.Interval); err == nil && interval > 0 {
+		return interval
+	}
+
+	return DefaultPeerInterval
+}
+
+// SplitPeerAddress splits a peer address in the <pubkey>@tcp://host:port format into
+// its pubkey and its TCP socket address.
+func SplitPeerAddress(addr string) (pubkey string, address string, err error) {
+	parts := strings.SplitN(addr, "@", 2)
+	if len(parts) != 2 {
+		return "", "", fmt.Errorf("%v is not in the <pubkey>@tcp://host:port format", addr)
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// validate validates the configuration's peers section.
+func (p Peers) validate() error {
+	if !p.Enabled() {
+		return nil
+	}
+
+	var errs string
+	if err := validateAddress(p.ListenAddress, "peers.laddr"); err != nil || !strings.HasPrefix(p.ListenAddress, "tcp://") {
+		errs += "\tpeers.laddr must be a TCP address in the host:port format\n"
+	}
+	for _, addr := range p.Addresses {
+		pubkey, address, err := SplitPeerAddress(addr)
+		if err != nil {
+			errs += fmt.Sprintf("\tpeers.addrs: %v\n", err)
+			continue
+		}
+		if err := validateConnPubKey(pubkey); err != nil {
+			errs += fmt.Sprintf("\tpeers.addrs: %v\n", err)
+		}
+		if err := validateAddress(address, addr); err != nil || !strings.HasPrefix(address, "tcp://") {
+			errs += fmt.Sprintf("\tpeers.addrs: %v must be a TCP address in the host:port format\n", address)
+		}
+	}
+	if p.Interval != "" {
+		if interval, err := time.ParseDuration(p.Interval); err != nil || interval <= 0 {
+			errs += "\tpeers.interval must be a positive duration, e.g. \"5s\"\n"
+		}
+	}
 	if errs != "" {
 		return errors.New(errs)
 	}
@@ -144,6 +597,12 @@ type Config struct {
 
 	// Privval defines the [privval] section of the configuration file.
 	Privval PrivValidator `mapstructure:"privval"`
+
+	// Light defines the [light] section of the configuration file.
+	Light Light `mapstructure:"light"`
+
+	// Peers defines the [peers] section of the configuration file.
+	Peers Peers `mapstructure:"peers"`
 }
 
 // validate validates the configuration.
@@ -155,6 +614,18 @@ func (c Config) validate() error {
 	if err := c.Privval.validate(); err != nil {
 		errs += err.Error()
 	}
+	if err := c.Light.validate(); err != nil {
+		errs += err.Error()
+	}
+	if err := c.Peers.validate(); err != nil {
+		errs += err.Error()
+	}
+
+	// The members of the set can only agree on set changes and drains if they can
+	// compare them.
+	if c.Base.Schedule() != "" && (!c.Peers.Enabled() || len(c.Peers.Addresses) == 0) {
+		errs += "\tpeers.laddr and peers.addrs must be set if base.set_changes or base.drains are configured\n"
+	}
 	if errs != "" {
 		return errors.New(errs)
 	}
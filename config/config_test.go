@@ -1,10 +1,13 @@
 package config
 
 import (
+	"encoding/base64"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/BlockscapeNetwork/signctrl/types"
 	"github.com/hashicorp/logutils"
 	"github.com/stretchr/testify/assert"
 )
@@ -17,6 +20,7 @@ func testConfig(t *testing.T) *Config {
 			SetSize:                   2,
 			Threshold:                 10,
 			StartRank:                 1,
+			Mode:                      ModeDial,
 			ValidatorListenAddress:    "tcp://127.0.0.1:3000",
 			ValidatorListenAddressRPC: "tcp://127.0.0.1:26657",
 			RetryDialAfter:            "15s",
@@ -24,6 +28,9 @@ func testConfig(t *testing.T) *Config {
 		Privval: PrivValidator{
 			ChainID: "testchain",
 		},
+		Light: Light{
+			TrustPeriod: "168h",
+		},
 	}
 }
 
@@ -46,6 +53,35 @@ func testInvalidBase(t *testing.T, base Base) {
 	assert.Error(t, err)
 	base.Threshold = testConfig(t).Base.Threshold
 
+	// Invalid Base.RankPolicy.
+	base.RankPolicy = "invalid"
+	err = base.validate()
+	assert.Error(t, err)
+
+	// Invalid Base.Window.
+	base.RankPolicy = types.PolicyWindow
+	base.Window = base.Threshold - 1
+	err = base.validate()
+	assert.Error(t, err)
+	base.Window = base.Threshold
+	err = base.validate()
+	assert.NoError(t, err)
+	base.RankPolicy = testConfig(t).Base.RankPolicy
+	base.Window = testConfig(t).Base.Window
+
+	// Invalid Base.ThresholdTime.
+	base.RankPolicy = types.PolicyTime
+	for _, threshold := range []string{"", "1", "5s", "2h", "-1m"} {
+		base.ThresholdTime = threshold
+		err = base.validate()
+		assert.Error(t, err, threshold)
+	}
+	base.ThresholdTime = "1m"
+	err = base.validate()
+	assert.NoError(t, err)
+	base.RankPolicy = testConfig(t).Base.RankPolicy
+	base.ThresholdTime = testConfig(t).Base.ThresholdTime
+
 	// Invalid Base.StartRank.
 	base.StartRank = 0
 	err = base.validate()
@@ -76,6 +112,36 @@ func testInvalidBase(t *testing.T, base Base) {
 	assert.Error(t, err)
 	base.ValidatorListenAddress = testConfig(t).Base.ValidatorListenAddress
 
+	// Invalid Base.Mode.
+	base.Mode = "invalid"
+	err = base.validate()
+	assert.Error(t, err)
+	base.Mode = testConfig(t).Base.Mode
+
+	// Invalid Base.SignerListenAddress in listen mode.
+	base.Mode = ModeListen
+	base.SignerListenAddress = "127.0.0.1:3000"
+	err = base.validate()
+	assert.Error(t, err)
+
+	// Valid Base.SignerListenAddress in listen mode.
+	base.SignerListenAddress = "unix:///tmp/signctrl.sock"
+	err = base.validate()
+	assert.NoError(t, err)
+	base.Mode = testConfig(t).Base.Mode
+	base.SignerListenAddress = testConfig(t).Base.SignerListenAddress
+
+	// Invalid Base.ValidatorConnPubKeys.
+	base.ValidatorConnPubKeys = []string{strings.Repeat("ab", 20), "invalid"}
+	err = base.validate()
+	assert.Error(t, err)
+
+	// Valid Base.ValidatorConnPubKeys.
+	base.ValidatorConnPubKeys = []string{strings.Repeat("ab", 20), base64.StdEncoding.EncodeToString(make([]byte, 32))}
+	err = base.validate()
+	assert.NoError(t, err)
+	base.ValidatorConnPubKeys = testConfig(t).Base.ValidatorConnPubKeys
+
 	// Invalid protocol in Base.ValidatorListenAddressRPC.
 	base.ValidatorListenAddressRPC = "invalid://127.0.0.1:26657"
 	err = base.validate()
@@ -94,6 +160,24 @@ func testInvalidBase(t *testing.T, base Base) {
 	assert.Error(t, err)
 	base.ValidatorListenAddressRPC = testConfig(t).Base.ValidatorListenAddressRPC
 
+	// Invalid address in Base.FallbackListenAddressesRPC.
+	base.FallbackListenAddressesRPC = []string{"tcp://127.0.0.1:26657", "127.0.0.1:26657"}
+	err = base.validate()
+	assert.Error(t, err)
+	base.FallbackListenAddressesRPC = testConfig(t).Base.FallbackListenAddressesRPC
+
+	// Invalid Base.RPCQuorum (more than there are RPC servers).
+	base.RPCQuorum = 2
+	err = base.validate()
+	assert.Error(t, err)
+	base.RPCQuorum = testConfig(t).Base.RPCQuorum
+
+	// Invalid Base.RPCQuorum (negative).
+	base.RPCQuorum = -1
+	err = base.validate()
+	assert.Error(t, err)
+	base.RPCQuorum = testConfig(t).Base.RPCQuorum
+
 	// Invalid Base.RetryDialAfter (empty).
 	base.RetryDialAfter = ""
 	err = base.validate()
@@ -113,6 +197,165 @@ func testInvalidPrivValidator(t *testing.T, privval PrivValidator) {
 	err := privval.validate()
 	assert.Error(t, err)
 	privval.ChainID = testConfig(t).Privval.ChainID
+
+	// Incomplete PrivValidator.PKCS11, only checked for the pkcs11 backend.
+	privval.PKCS11 = PKCS11{Module: "/usr/lib/softhsm/libsofthsm2.so", KeyLabel: "validator"}
+	err = privval.validate()
+	assert.NoError(t, err)
+	privval.Backend = "pkcs11"
+	err = privval.validate()
+	assert.Error(t, err)
+	privval.PKCS11.PINFile = "/etc/signctrl/pin"
+	err = privval.validate()
+	assert.NoError(t, err)
+
+	// Invalid PrivValidator.Vault, only checked for the vault backend.
+	privval.Backend = "vault"
+	privval.Vault = Vault{Address: "https://127.0.0.1:8200", KeyName: "validator", TokenFile: "/etc/signctrl/token"}
+	err = privval.validate()
+	assert.NoError(t, err)
+	privval.Vault.Address = "127.0.0.1:8200"
+	err = privval.validate()
+	assert.Error(t, err)
+	privval.Vault.Address = "https://127.0.0.1:8200"
+	privval.Vault.RoleID = "role"
+	err = privval.validate()
+	assert.Error(t, err)
+	privval.Vault.TokenFile = ""
+	err = privval.validate()
+	assert.Error(t, err)
+	privval.Vault.SecretIDFile = "/etc/signctrl/secret_id"
+	err = privval.validate()
+	assert.NoError(t, err)
+	privval.Vault.ClientCert = "/etc/signctrl/client.pem"
+	err = privval.validate()
+	assert.Error(t, err)
+
+	// Invalid PrivValidator.Upstream, only checked for the upstream backend.
+	privval.Backend = "upstream"
+	privval.Upstream = Upstream{ListenAddress: "tcp://127.0.0.1:3001"}
+	err = privval.validate()
+	assert.NoError(t, err)
+	privval.Upstream.ListenAddress = "127.0.0.1:3001"
+	err = privval.validate()
+	assert.Error(t, err)
+	privval.Upstream.ListenAddress = "unix:///tmp/upstream.sock"
+	privval.Upstream.ConnPubKeys = []string{"invalid"}
+	err = privval.validate()
+	assert.Error(t, err)
+	privval.Upstream.ConnPubKeys = nil
+	privval.Upstream.Timeout = "-1s"
+	err = privval.validate()
+	assert.Error(t, err)
+	privval.Backend = ""
+}
+
+func TestGetTimeout(t *testing.T) {
+	assert.Equal(t, DefaultUpstreamTimeout, Upstream{}.GetTimeout())
+	assert.Equal(t, DefaultUpstreamTimeout, Upstream{Timeout: "invalid"}.GetTimeout())
+	assert.Equal(t, 10*time.Second, Upstream{Timeout: "10s"}.GetTimeout())
+}
+
+func TestGetMount(t *testing.T) {
+	assert.Equal(t, "transit", Vault{}.GetMount())
+	assert.Equal(t, "signing/transit", Vault{Mount: "/signing/transit/"}.GetMount())
+}
+
+func testInvalidLight(t *testing.T, light Light) {
+	// Invalid Light.TrustPeriod.
+	light.TrustPeriod = "1d"
+	err := light.validate()
+	assert.Error(t, err)
+	light.TrustPeriod = testConfig(t).Light.TrustPeriod
+
+	// Invalid Light.TrustHeight (negative).
+	light.TrustHeight = -1
+	err = light.validate()
+	assert.Error(t, err)
+	light.TrustHeight = testConfig(t).Light.TrustHeight
+
+	// Light.TrustHeight without Light.TrustHash.
+	light.TrustHeight = 10
+	err = light.validate()
+	assert.Error(t, err)
+
+	// Invalid Light.TrustHash.
+	light.TrustHash = "ABCD"
+	err = light.validate()
+	assert.Error(t, err)
+
+	// Valid Light.TrustHeight and Light.TrustHash.
+	light.TrustHash = strings.Repeat("AB", 32)
+	err = light.validate()
+	assert.NoError(t, err)
+	assert.Len(t, light.GetTrustHash(), 32)
+}
+
+func testInvalidPeers(t *testing.T, peers Peers) {
+	// Disabled Peers aren't validated.
+	peers.Addresses = []string{"invalid"}
+	err := peers.validate()
+	assert.NoError(t, err)
+
+	// Valid Peers.
+	peers.ListenAddress = "tcp://127.0.0.1:4000"
+	peers.Addresses = []string{strings.Repeat("ab", 20) + "@tcp://127.0.0.1:4001"}
+	peers.Interval = "5s"
+	err = peers.validate()
+	assert.NoError(t, err)
+
+	// Invalid Peers.ListenAddress.
+	peers.ListenAddress = "unix:///tmp/peers.sock"
+	err = peers.validate()
+	assert.Error(t, err)
+	peers.ListenAddress = "tcp://127.0.0.1:4000"
+
+	// Invalid Peers.Addresses.
+	peers.Addresses = []string{"tcp://127.0.0.1:4001"}
+	err = peers.validate()
+	assert.Error(t, err)
+	peers.Addresses = []string{"ABCD@tcp://127.0.0.1:4001"}
+	err = peers.validate()
+	assert.Error(t, err)
+	peers.Addresses = []string{strings.Repeat("ab", 20) + "@127.0.0.1:4001"}
+	err = peers.validate()
+	assert.Error(t, err)
+	peers.Addresses = nil
+
+	// Invalid Peers.Interval.
+	peers.Interval = "-5s"
+	err = peers.validate()
+	assert.Error(t, err)
+}
+
+func TestNewRankPolicy(t *testing.T) {
+	base := Base{Threshold: 10}
+	assert.IsType(t, &types.ConsecutivePolicy{}, base.NewRankPolicy())
+
+	base.RankPolicy = types.PolicyWindow
+	base.Window = 20
+	assert.IsType(t, &types.WindowPolicy{}, base.NewRankPolicy())
+
+	base.RankPolicy = types.PolicyTime
+	base.ThresholdTime = "1m"
+	assert.IsType(t, &types.TimePolicy{}, base.NewRankPolicy())
+	assert.Equal(t, time.Minute, base.GetThresholdTime())
+}
+
+func TestGetPeerInterval(t *testing.T) {
+	peers := Peers{Interval: "10s"}
+	assert.Equal(t, 10*time.Second, peers.GetInterval())
+
+	peers.Interval = ""
+	assert.Equal(t, DefaultPeerInterval, peers.GetInterval())
+}
+
+func TestGetTrustPeriod(t *testing.T) {
+	light := Light{TrustPeriod: "24h"}
+	assert.Equal(t, 24*time.Hour, light.GetTrustPeriod())
+
+	light.TrustPeriod = ""
+	assert.Equal(t, DefaultTrustPeriod, light.GetTrustPeriod())
 }
 
 func TestValidateConfig(t *testing.T) {
@@ -130,6 +373,21 @@ func TestValidateConfig(t *testing.T) {
 	// Invalid Config.
 	testInvalidBase(t, cfg.Base)
 	testInvalidPrivValidator(t, cfg.Privval)
+	testInvalidLight(t, cfg.Light)
+	testInvalidPeers(t, cfg.Peers)
+
+	// Set changes and drains require the other members of the set.
+	cfg = testConfig(t)
+	cfg.Peers = Peers{}
+	cfg.Base.Drains = []Drain{{Height: 100, Ranks: []int{2}}}
+	err = cfg.validate()
+	assert.Error(t, err)
+	cfg.Peers = Peers{
+		ListenAddress: "tcp://127.0.0.1:4000",
+		Addresses:     []string{strings.Repeat("ab", 20) + "@tcp://127.0.0.1:4001"},
+	}
+	err = cfg.validate()
+	assert.NoError(t, err)
 }
 
 func TestDir(t *testing.T) {
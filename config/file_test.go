@@ -0,0 +1,44 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "test.json")
+
+	// Create the file.
+	err := WriteFileAtomic(path, []byte("first"), PermStateFile)
+	assert.NoError(t, err)
+
+	bytes, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "first", string(bytes))
+
+	// Overwrite the file.
+	err = WriteFileAtomic(path, []byte("second"), PermStateFile)
+	assert.NoError(t, err)
+
+	bytes, err = ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(bytes))
+
+	info, err := os.Stat(path)
+	assert.NoError(t, err)
+	assert.Equal(t, PermStateFile, info.Mode().Perm())
+
+	// No temporary files are left behind.
+	files, err := ioutil.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Len(t, files, 1)
+
+	// Fail to write into a nonexistent directory.
+	err = WriteFileAtomic(filepath.Join(dir, "nonexistent", "test.json"), []byte("third"), PermStateFile)
+	assert.Error(t, err)
+}
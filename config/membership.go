@@ -0,0 +1,183 @@
+package config
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// SetChange defines a change of the set size at a pre-agreed block height. It must be
+// the same across all validators in the set.
+type SetChange struct {
+	// Height is the block height from which on the new set size applies.
+	Height int64 `mapstructure:"height"`
+
+	// SetSize is the number of validators in the SignCTRL set from Height on.
+	SetSize int `mapstructure:"set_size"`
+
+	// RemoveRanks are the ranks that leave the set if it shrinks. The ranks below a
+	// removed rank move up. Defaults to the lowest ranks if empty.
+	RemoveRanks []int `mapstructure:"remove_ranks"`
+}
+
+// Drain takes backup ranks out of the promotion line from a pre-agreed block height on.
+// It must be the same across all validators in the set.
+type Drain struct {
+	// Height is the block height from which on the ranks are drained.
+	Height int64 `mapstructure:"height"`
+
+	// Ranks are the ranks that are drained from Height on, in place of the ones of the
+	// previous drain. An empty list puts all ranks back into the promotion line.
+	Ranks []int `mapstructure:"ranks"`
+}
+
+// RemovedRanks returns the ranks that leave the set if it shrinks from the given set
+// size, in ascending order.
+func (c SetChange) RemovedRanks(prevSetSize int) []int {
+	if len(c.RemoveRanks) > 0 {
+		ranks := append([]int{}, c.RemoveRanks...)
+		sort.Ints(ranks)
+		return ranks
+	}
+
+	var ranks []int
+	for rank := c.SetSize + 1; rank <= prevSetSize; rank++ {
+		ranks = append(ranks, rank)
+	}
+
+	return ranks
+}
+
+// SetSizeAt returns the set size at the given block height, taking the set changes
+// into account.
+func (b Base) SetSizeAt(height int64) int {
+	setSize := b.SetSize
+	for _, c := range b.SetChanges {
+		if c.Height <= height {
+			setSize = c.SetSize
+		}
+	}
+
+	return setSize
+}
+
+// Schedule returns a fingerprint of the set changes and drains, so the validators in
+// the set can compare their schedules. It's empty if neither are configured.
+func (b Base) Schedule() string {
+	return b.fingerprint(math.MaxInt64)
+}
+
+// ScheduleAt returns a fingerprint of the set changes and drains that activated up to
+// the given height. Unlike Schedule, it doesn't change while a set change or a drain is
+// added to the schedule ahead of its height.
+func (b Base) ScheduleAt(height int64) string {
+	return b.fingerprint(height)
+}
+
+// fingerprint returns a fingerprint of the set changes and drains up to the given
+// height, or an empty string if there are none.
+func (b Base) fingerprint(height int64) string {
+	h := sha256.New()
+	var n int
+	fmt.Fprintf(h, "%v", b.SetSize)
+	for _, c := range b.SetChanges {
+		if c.Height <= height {
+			fmt.Fprintf(h, ";%v:%v:%v", c.Height, c.SetSize, c.RemovedRanks(b.SetSizeAt(c.Height-1)))
+			n++
+		}
+	}
+	for _, d := range b.Drains {
+		if d.Height <= height {
+			ranks := append([]int{}, d.Ranks...)
+			sort.Ints(ranks)
+			fmt.Fprintf(h, ";drain:%v:%v", d.Height, ranks)
+			n++
+		}
+	}
+	if n == 0 {
+		return ""
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:16]
+}
+
+// AppendDrain appends the given drain to the config.toml in the given directory, so
+// it's scheduled again after a restart. It must be higher than the drains already in
+// the file.
+func AppendDrain(cfgDir string, d Drain) error {
+	f, err := os.OpenFile(FilePath(cfgDir), os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	ranks := make([]string, 0, len(d.Ranks))
+	for _, rank := range d.Ranks {
+		ranks = append(ranks, strconv.Itoa(rank))
+	}
+	_, err = fmt.Fprintf(f, "\n[[base.drains]]\nheight = %v\nranks = [%v]\n", d.Height, strings.Join(ranks, ", "))
+
+	return err
+}
+
+// validateSetChanges validates the set changes. They must be in ascending order of
+// their heights, and shrinking sets must remove exactly the difference in ranks, except
+// for rank 1.
+func (b Base) validateSetChanges() string {
+	var errs string
+	prevHeight, prevSetSize := int64(0), b.SetSize
+	for i, c := range b.SetChanges {
+		if c.Height <= prevHeight {
+			errs += fmt.Sprintf("\tset_changes[%v].height must be higher than the previous height\n", i)
+		}
+		if c.SetSize < 2 {
+			errs += fmt.Sprintf("\tset_changes[%v].set_size must be 2 or higher\n", i)
+		}
+		if c.SetSize >= prevSetSize && len(c.RemoveRanks) > 0 {
+			errs += fmt.Sprintf("\tset_changes[%v].remove_ranks must be empty if the set doesn't shrink\n", i)
+		}
+		if c.SetSize < prevSetSize && len(c.RemoveRanks) > 0 && len(c.RemoveRanks) != prevSetSize-c.SetSize {
+			errs += fmt.Sprintf("\tset_changes[%v].remove_ranks must contain %v ranks\n", i, prevSetSize-c.SetSize)
+		}
+		seen := make(map[int]bool)
+		for _, rank := range c.RemoveRanks {
+			if rank < 2 || rank > prevSetSize || seen[rank] {
+				errs += fmt.Sprintf("\tset_changes[%v].remove_ranks must be unique ranks between 2 and %v\n", i, prevSetSize)
+				break
+			}
+			seen[rank] = true
+		}
+		prevHeight, prevSetSize = c.Height, c.SetSize
+	}
+
+	return errs
+}
+
+// validateDrains validates the drains. They must be in ascending order of their
+// heights, and only ranks between 2 and the set size at their height can be drained.
+func (b Base) validateDrains() string {
+	var errs string
+	var prevHeight int64
+	for i, d := range b.Drains {
+		if d.Height <= prevHeight {
+			errs += fmt.Sprintf("\tdrains[%v].height must be higher than the previous height\n", i)
+		}
+		setSize := b.SetSizeAt(d.Height)
+		seen := make(map[int]bool)
+		for _, rank := range d.Ranks {
+			if rank < 2 || rank > setSize || seen[rank] {
+				errs += fmt.Sprintf("\tdrains[%v].ranks must be unique ranks between 2 and %v\n", i, setSize)
+				break
+			}
+			seen[rank] = true
+		}
+		prevHeight = d.Height
+	}
+
+	return errs
+}
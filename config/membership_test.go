@@ -0,0 +1,198 @@
+package config
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+func testSetChanges(t *testing.T) Base {
+	t.Helper()
+	return Base{
+		SetSize: 3,
+		SetChanges: []SetChange{
+			{Height: 100, SetSize: 4},
+			{Height: 200, SetSize: 2, RemoveRanks: []int{3, 2}},
+			{Height: 300, SetSize: 3},
+		},
+	}
+}
+
+func TestRemovedRanks(t *testing.T) {
+	base := testSetChanges(t)
+	assert.Empty(t, base.SetChanges[0].RemovedRanks(3))
+	assert.Equal(t, []int{2, 3}, base.SetChanges[1].RemovedRanks(4))
+
+	// The lowest ranks are removed by default.
+	c := SetChange{Height: 400, SetSize: 2}
+	assert.Equal(t, []int{3, 4}, c.RemovedRanks(4))
+}
+
+func TestSetSizeAt(t *testing.T) {
+	base := testSetChanges(t)
+	assert.Equal(t, 3, base.SetSizeAt(1))
+	assert.Equal(t, 3, base.SetSizeAt(99))
+	assert.Equal(t, 4, base.SetSizeAt(100))
+	assert.Equal(t, 2, base.SetSizeAt(250))
+	assert.Equal(t, 3, base.SetSizeAt(300))
+}
+
+func TestSchedule(t *testing.T) {
+	base := testSetChanges(t)
+	other := testSetChanges(t)
+	assert.NotEmpty(t, base.Schedule())
+	assert.Equal(t, base.Schedule(), other.Schedule())
+
+	// The order of the removed ranks doesn't matter, but their heights do.
+	other.SetChanges[1].RemoveRanks = []int{2, 3}
+	assert.Equal(t, base.Schedule(), other.Schedule())
+	other.SetChanges[1].Height = 201
+	assert.NotEqual(t, base.Schedule(), other.Schedule())
+
+	assert.Empty(t, Base{SetSize: 3}.Schedule())
+}
+
+func TestSchedule_Drains(t *testing.T) {
+	base := Base{SetSize: 3, Drains: []Drain{{Height: 100, Ranks: []int{3, 2}}}}
+	other := Base{SetSize: 3, Drains: []Drain{{Height: 100, Ranks: []int{2, 3}}}}
+	assert.NotEmpty(t, base.Schedule())
+	assert.Equal(t, base.Schedule(), other.Schedule())
+
+	// Drains at a different height or of different ranks don't match.
+	other.Drains[0].Height = 101
+	assert.NotEqual(t, base.Schedule(), other.Schedule())
+	other.Drains[0] = Drain{Height: 100, Ranks: []int{2}}
+	assert.NotEqual(t, base.Schedule(), other.Schedule())
+
+	// Drains are part of the fingerprint next to the set changes.
+	withDrains := testSetChanges(t)
+	withDrains.Drains = base.Drains
+	assert.NotEqual(t, testSetChanges(t).Schedule(), withDrains.Schedule())
+}
+
+func TestScheduleAt(t *testing.T) {
+	base := testSetChanges(t)
+	assert.Empty(t, base.ScheduleAt(99))
+	assert.NotEmpty(t, base.ScheduleAt(100))
+	assert.Equal(t, base.Schedule(), base.ScheduleAt(300))
+
+	// A drain scheduled ahead of its height only changes the fingerprint once it
+	// activates.
+	drained := testSetChanges(t)
+	drained.Drains = []Drain{{Height: 400, Ranks: []int{2}}}
+	assert.NotEqual(t, base.Schedule(), drained.Schedule())
+	assert.Equal(t, base.ScheduleAt(399), drained.ScheduleAt(399))
+	assert.NotEqual(t, base.ScheduleAt(400), drained.ScheduleAt(400))
+}
+
+func TestAppendDrain(t *testing.T) {
+	dir, err := ioutil.TempDir("", "signctrl")
+	assert.NoError(t, err)
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(FilePath(dir), []byte(`
+[base]
+set_size = 3
+
+[[base.drains]]
+height = 100
+ranks = [2]
+
+[peers]
+interval = "1s"
+`), 0600)
+	assert.NoError(t, err)
+
+	assert.NoError(t, AppendDrain(dir, Drain{Height: 200, Ranks: []int{2, 3}}))
+	assert.NoError(t, AppendDrain(dir, Drain{Height: 300}))
+
+	v := viper.New()
+	v.SetConfigFile(FilePath(dir))
+	assert.NoError(t, v.ReadInConfig())
+	var c Config
+	assert.NoError(t, v.Unmarshal(&c))
+	assert.Equal(t, 3, c.Base.SetSize)
+	assert.Equal(t, "1s", c.Peers.Interval)
+	assert.Len(t, c.Base.Drains, 3)
+	assert.Equal(t, Drain{Height: 200, Ranks: []int{2, 3}}, c.Base.Drains[1])
+	assert.Equal(t, int64(300), c.Base.Drains[2].Height)
+	assert.Empty(t, c.Base.Drains[2].Ranks)
+	assert.Empty(t, c.Base.validateDrains())
+}
+
+func TestValidateDrains(t *testing.T) {
+	base := testSetChanges(t)
+	base.Drains = []Drain{{Height: 50, Ranks: []int{3}}, {Height: 150, Ranks: []int{4}}, {Height: 250}}
+	assert.Empty(t, base.validateDrains())
+
+	// Heights out of order.
+	base.Drains[1].Height = 50
+	assert.NotEmpty(t, base.validateDrains())
+	base.Drains[1].Height = 150
+
+	// Rank 4 is gone after the set shrinks at height 200.
+	base.Drains[2].Ranks = []int{4}
+	assert.NotEmpty(t, base.validateDrains())
+
+	// Rank 1 can't be drained.
+	base.Drains[2].Ranks = []int{1}
+	assert.NotEmpty(t, base.validateDrains())
+
+	base.Drains[2].Ranks = []int{2, 2}
+	assert.NotEmpty(t, base.validateDrains())
+}
+
+func TestValidateSetChanges(t *testing.T) {
+	base := testSetChanges(t)
+	assert.Empty(t, base.validateSetChanges())
+
+	// Heights out of order.
+	base.SetChanges[2].Height = 150
+	assert.NotEmpty(t, base.validateSetChanges())
+	base = testSetChanges(t)
+
+	// Wrong number of removed ranks.
+	base.SetChanges[1].RemoveRanks = []int{2}
+	assert.NotEmpty(t, base.validateSetChanges())
+
+	// Rank 1 can't be removed.
+	base.SetChanges[1].RemoveRanks = []int{1, 2}
+	assert.NotEmpty(t, base.validateSetChanges())
+
+	// Ranks can't be removed from a growing set.
+	base = testSetChanges(t)
+	base.SetChanges[0].RemoveRanks = []int{2}
+	assert.NotEmpty(t, base.validateSetChanges())
+
+	base = testSetChanges(t)
+	base.SetChanges[0].SetSize = 1
+	assert.NotEmpty(t, base.validateSetChanges())
+}
+
+func TestUnmarshalSetChanges(t *testing.T) {
+	v := viper.New()
+	v.SetConfigType("toml")
+	err := v.ReadConfig(strings.NewReader(`
+[base]
+set_size = 3
+
+[[base.set_changes]]
+height = 100
+set_size = 2
+remove_ranks = [2]
+
+[[base.drains]]
+height = 150
+ranks = [2]
+`))
+	assert.NoError(t, err)
+
+	var c Config
+	err = v.Unmarshal(&c)
+	assert.NoError(t, err)
+	assert.Equal(t, []SetChange{{Height: 100, SetSize: 2, RemoveRanks: []int{2}}}, c.Base.SetChanges)
+	assert.Equal(t, []Drain{{Height: 150, Ranks: []int{2}}}, c.Base.Drains)
+}
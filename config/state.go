@@ -1,11 +1,13 @@
 package config
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 
+	tm_bytes "github.com/tendermint/tendermint/libs/bytes"
 	tm_json "github.com/tendermint/tendermint/libs/json"
 )
 
@@ -14,15 +16,82 @@ const (
 	// last state.
 	StateFile = "signctrl_state.json"
 
+	// StateBackupFile is the full file name of the backup of the validator's previous
+	// state.
+	StateBackupFile = StateFile + ".bak"
+
 	// PermStateFile determines the default file permissions for the
 	// signctrl_state.json file.
 	PermStateFile = os.FileMode(0644)
 )
 
+// SignState defines the height, round and step (HRS) of the last vote or proposal
+// SignCTRL signed, as well as its sign bytes and signature. It serves as a watermark
+// for double-signing protection that is independent of the PrivValidator in use.
+type SignState struct {
+	Height    int64             `json:"height"`
+	Round     int32             `json:"round"`
+	Step      int8              `json:"step"`
+	Signature []byte            `json:"signature,omitempty"`
+	SignBytes tm_bytes.HexBytes `json:"signbytes,omitempty"`
+}
+
+// CheckHRS checks the given height, round and step against the last signed ones.
+// An error is returned if they constitute a regression, or if they match but there
+// are no sign bytes or no signature to reuse.
+// The returned boolean indicates whether the given HRS matches the last signed one,
+// in which case the last signature should be reused.
+func (ss SignState) CheckHRS(height int64, round int32, step int8) (bool, error) {
+	if ss.Height > height {
+		return false, fmt.Errorf("height regression (got %v, last height %v)", height, ss.Height)
+	}
+	if ss.Height == height {
+		if ss.Round > round {
+			return false, fmt.Errorf("round regression at height %v (got %v, last round %v)", height, round, ss.Round)
+		}
+		if ss.Round == round {
+			if ss.Step > step {
+				return false, fmt.Errorf("step regression at height %v round %v (got %v, last step %v)", height, round, step, ss.Step)
+			} else if ss.Step == step {
+				if ss.SignBytes == nil || ss.Signature == nil {
+					return false, errors.New("no sign bytes or signature found for the last signed step")
+				}
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// Fence marks that SignCTRL shut itself down while the validator daemon may have
+// kept running. As long as the fence is set, SignCTRL refuses to sign.
+type Fence struct {
+	Height int64 `json:"height"`
+}
+
 // State defines the contents of the signctrl_state.json file.
 type State struct {
-	LastHeight int64 `json:"last_height"`
-	LastRank   int   `json:"last_rank"`
+	LastHeight int64     `json:"last_height"`
+	LastRank   int       `json:"last_rank"`
+	LastSigned SignState `json:"last_signed"`
+	Fence      *Fence    `json:"fence,omitempty"`
+
+	// DrainedRanks are the ranks taken out of the promotion line. They must be the
+	// same across all validators in the set.
+	DrainedRanks []int `json:"drained_ranks,omitempty"`
+
+	// DrainHeight is the height of the last drain from the config.toml that has been
+	// applied to the drained ranks.
+	DrainHeight int64 `json:"drain_height,omitempty"`
+
+	// SetChangeHeight is the height of the last set change from the config.toml that
+	// has been applied to the ranks.
+	SetChangeHeight int64 `json:"set_change_height,omitempty"`
+
+	// HandoverHeight is the height from which on rank 1 stops signing in order to hand
+	// over to rank 2, or 0 if no handover is scheduled.
+	HandoverHeight int64 `json:"handover_height,omitempty"`
 }
 
 // validate validates the contents of the signctrl_state.json file.
@@ -34,6 +103,27 @@ func (s State) validate() error {
 	if s.LastRank < 1 {
 		errs += "\tlast_rank in signctrl_state.json must be 1 or higher\n"
 	}
+	if s.LastSigned.Height < 0 || s.LastSigned.Round < 0 || s.LastSigned.Step < 0 {
+		errs += "\tlast_signed in signctrl_state.json must not contain negative values\n"
+	}
+	for _, rank := range s.DrainedRanks {
+		if rank < 2 {
+			errs += "\tdrained_ranks in signctrl_state.json must be 2 or higher\n"
+			break
+		}
+	}
+	if s.SetChangeHeight < 0 {
+		errs += "\tset_change_height in signctrl_state.json must be 0 or higher\n"
+	}
+	if s.DrainHeight < 0 {
+		errs += "\tdrain_height in signctrl_state.json must be 0 or higher\n"
+	}
+	if s.HandoverHeight < 0 {
+		errs += "\thandover_height in signctrl_state.json must be 0 or higher\n"
+	}
+	if s.Fence != nil && s.Fence.Height < 1 {
+		errs += "\tfence.height in signctrl_state.json must be 1 or higher\n"
+	}
 	if errs != "" {
 		return fmt.Errorf(errs)
 	}
@@ -46,9 +136,40 @@ func StateFilePath(cfgDir string) string {
 	return filepath.Join(cfgDir, StateFile)
 }
 
+// StateBackupFilePath returns the absolute path to the signctrl_state.json.bak file.
+func StateBackupFilePath(cfgDir string) string {
+	return filepath.Join(cfgDir, StateBackupFile)
+}
+
+// loadStateFile loads and validates the state from the file at the given path.
+func loadStateFile(path string) (State, error) {
+	bytes, err := ioutil.ReadFile(path)
+	if err != nil {
+		return State{}, err
+	}
+
+	return parseState(bytes)
+}
+
+// parseState parses and validates the given state file contents.
+func parseState(bytes []byte) (State, error) {
+	var s State
+	if err := tm_json.Unmarshal(bytes, &s); err != nil {
+		return State{}, err
+	}
+	if err := s.validate(); err != nil {
+		return State{}, err
+	}
+
+	return s, nil
+}
+
 // LoadOrGenState loads the contents of the signctrl_state.json file and returns them
 // if it exists, or generetas a new one.
-func LoadOrGenState(cfgDir string) (State, error) {
+// If the signctrl_state.json file can't be loaded and a signctrl_state.json.bak file
+// exists, fallback is called with the error to decide whether the backup should be
+// restored. A nil fallback never restores the backup.
+func LoadOrGenState(cfgDir string, fallback func(err error) bool) (State, error) {
 	if _, err := os.Stat(StateFilePath(cfgDir)); os.IsNotExist(err) {
 		state := State{
 			LastHeight: 1,
@@ -61,31 +182,53 @@ func LoadOrGenState(cfgDir string) (State, error) {
 		return state, nil
 	}
 
-	bytes, err := ioutil.ReadFile(StateFilePath(cfgDir))
-	if err != nil {
+	s, err := loadStateFile(StateFilePath(cfgDir))
+	if err == nil {
+		return s, nil
+	}
+	if _, statErr := os.Stat(StateBackupFilePath(cfgDir)); os.IsNotExist(statErr) || fallback == nil || !fallback(err) {
 		return State{}, err
 	}
 
-	var s State
-	if err := tm_json.Unmarshal(bytes, &s); err != nil {
-		return State{}, err
+	// Restore the backup.
+	s, err = loadStateFile(StateBackupFilePath(cfgDir))
+	if err != nil {
+		return State{}, fmt.Errorf("couldn't load %v: %v", StateBackupFile, err)
 	}
-	if err := s.validate(); err != nil {
+	if err := s.Save(cfgDir); err != nil {
 		return State{}, err
 	}
 
 	return s, nil
 }
 
-// Save saves the current state to the signctrl_state.json file.
+// Save saves the current state to the signctrl_state.json file. The file is written
+// atomically, and its previous contents are kept in the signctrl_state.json.bak file
+// if they are valid.
 func (s *State) Save(cfgDir string) error {
 	lrFile, err := tm_json.MarshalIndent(&State{
-		LastRank:   s.LastRank,
-		LastHeight: s.LastHeight,
+		LastRank:        s.LastRank,
+		LastHeight:      s.LastHeight,
+		LastSigned:      s.LastSigned,
+		Fence:           s.Fence,
+		DrainedRanks:    s.DrainedRanks,
+		SetChangeHeight: s.SetChangeHeight,
+		DrainHeight:     s.DrainHeight,
+		HandoverHeight:  s.HandoverHeight,
 	}, "", "\t")
 	if err != nil {
 		return err
 	}
 
-	return ioutil.WriteFile(StateFilePath(cfgDir), lrFile, PermStateFile)
+	// Back up the previous state, unless it's invalid, so it can't overwrite a valid
+	// backup.
+	if prev, err := ioutil.ReadFile(StateFilePath(cfgDir)); err == nil {
+		if _, err := parseState(prev); err == nil {
+			if err := WriteFileAtomic(StateBackupFilePath(cfgDir), prev, PermStateFile); err != nil {
+				return err
+			}
+		}
+	}
+
+	return WriteFileAtomic(StateFilePath(cfgDir), lrFile, PermStateFile)
 }
@@ -1,6 +1,7 @@
 package config
 
 import (
+	"io/ioutil"
 	"os"
 	"testing"
 
@@ -12,6 +13,13 @@ func testState(t *testing.T) *State {
 	return &State{
 		LastHeight: 10,
 		LastRank:   1,
+		LastSigned: SignState{
+			Height:    9,
+			Round:     0,
+			Step:      3,
+			Signature: []byte("Signature"),
+			SignBytes: []byte("SignBytes"),
+		},
 	}
 }
 
@@ -32,6 +40,63 @@ func TestValidateState(t *testing.T) {
 	err = state.validate()
 	assert.Error(t, err)
 	state.LastRank = testState(t).LastRank
+
+	// Invalid State.LastSigned.
+	state.LastSigned.Round = -1
+	err = state.validate()
+	assert.Error(t, err)
+	state.LastSigned = testState(t).LastSigned
+
+	// Invalid State.Fence.
+	state.Fence = &Fence{Height: 0}
+	err = state.validate()
+	assert.Error(t, err)
+	state.Fence = nil
+
+	// Invalid State.DrainedRanks.
+	state.DrainedRanks = []int{2, 1}
+	err = state.validate()
+	assert.Error(t, err)
+}
+
+func TestCheckHRS(t *testing.T) {
+	ss := SignState{Height: 10, Round: 1, Step: 2}
+
+	// Height regression.
+	sameHRS, err := ss.CheckHRS(9, 1, 2)
+	assert.False(t, sameHRS)
+	assert.Error(t, err)
+
+	// Round regression.
+	sameHRS, err = ss.CheckHRS(10, 0, 2)
+	assert.False(t, sameHRS)
+	assert.Error(t, err)
+
+	// Step regression.
+	sameHRS, err = ss.CheckHRS(10, 1, 1)
+	assert.False(t, sameHRS)
+	assert.Error(t, err)
+
+	// Same HRS without sign bytes.
+	sameHRS, err = ss.CheckHRS(10, 1, 2)
+	assert.False(t, sameHRS)
+	assert.Error(t, err)
+
+	// Same HRS with sign bytes and signature.
+	ss.SignBytes = []byte("SignBytes")
+	ss.Signature = []byte("Signature")
+	sameHRS, err = ss.CheckHRS(10, 1, 2)
+	assert.True(t, sameHRS)
+	assert.NoError(t, err)
+
+	// Progression.
+	sameHRS, err = ss.CheckHRS(10, 1, 3)
+	assert.False(t, sameHRS)
+	assert.NoError(t, err)
+
+	sameHRS, err = ss.CheckHRS(11, 0, 1)
+	assert.False(t, sameHRS)
+	assert.NoError(t, err)
 }
 
 func TestStateFilePath(t *testing.T) {
@@ -41,13 +106,14 @@ func TestStateFilePath(t *testing.T) {
 
 func TestLoadOrGenState(t *testing.T) {
 	// Generate.
-	state, err := LoadOrGenState(".")
+	state, err := LoadOrGenState(".", nil)
 	defer os.Remove("./signctrl_state.json")
+	defer os.Remove("./signctrl_state.json.bak")
 	assert.NotNil(t, state)
 	assert.NoError(t, err)
 
 	// Load invalid.
-	state, err = LoadOrGenState(".")
+	state, err = LoadOrGenState(".", nil)
 	assert.Equal(t, state, State{})
 	assert.Error(t, err)
 
@@ -56,7 +122,74 @@ func TestLoadOrGenState(t *testing.T) {
 	err = state.Save(".")
 	assert.NoError(t, err)
 
-	state, err = LoadOrGenState(".")
+	state, err = LoadOrGenState(".", nil)
 	assert.Equal(t, state, *testState(t))
 	assert.NoError(t, err)
 }
+
+func TestSaveFence(t *testing.T) {
+	cfgDir := t.TempDir()
+	state := *testState(t)
+	state.Fence = &Fence{Height: 42}
+	err := state.Save(cfgDir)
+	assert.NoError(t, err)
+
+	loaded, err := LoadOrGenState(cfgDir, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, state.Fence, loaded.Fence)
+
+	// Lift the fence.
+	loaded.Fence = nil
+	err = loaded.Save(cfgDir)
+	assert.NoError(t, err)
+
+	loaded, err = LoadOrGenState(cfgDir, nil)
+	assert.NoError(t, err)
+	assert.Nil(t, loaded.Fence)
+}
+
+func TestLoadOrGenState_Backup(t *testing.T) {
+	cfgDir := t.TempDir()
+
+	// Save two valid states, so the first one is backed up.
+	state := *testState(t)
+	err := state.Save(cfgDir)
+	assert.NoError(t, err)
+	_, err = os.Stat(StateBackupFilePath(cfgDir))
+	assert.True(t, os.IsNotExist(err))
+
+	state.LastHeight++
+	err = state.Save(cfgDir)
+	assert.NoError(t, err)
+
+	backup, err := loadStateFile(StateBackupFilePath(cfgDir))
+	assert.NoError(t, err)
+	assert.Equal(t, *testState(t), backup)
+
+	// Truncate the state file.
+	err = ioutil.WriteFile(StateFilePath(cfgDir), []byte(`{"last_height":`), PermStateFile)
+	assert.NoError(t, err)
+
+	// Don't fall back to the backup.
+	state, err = LoadOrGenState(cfgDir, nil)
+	assert.Equal(t, State{}, state)
+	assert.Error(t, err)
+
+	state, err = LoadOrGenState(cfgDir, func(err error) bool { return false })
+	assert.Equal(t, State{}, state)
+	assert.Error(t, err)
+
+	// Fall back to the backup, which also restores it.
+	state, err = LoadOrGenState(cfgDir, func(err error) bool { return true })
+	assert.Equal(t, *testState(t), state)
+	assert.NoError(t, err)
+
+	state, err = LoadOrGenState(cfgDir, nil)
+	assert.Equal(t, *testState(t), state)
+	assert.NoError(t, err)
+}
+
+func TestStateBackupFilePath(t *testing.T) {
+	path := StateBackupFilePath("/tmp")
+	assert.Equal(t, "/tmp/signctrl_state.json.bak", path)
+}
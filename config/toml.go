@@ -25,6 +25,14 @@ var (
 	// Embed the privval.toml into the SignCTRL binary.
 	//go:embed templates/privval.toml
 	privvalTemplate embed.FS
+
+	// Embed the light.toml into the SignCTRL binary.
+	//go:embed templates/light.toml
+	lightTemplate embed.FS
+
+	// Embed the peers.toml into the SignCTRL binary.
+	//go:embed templates/peers.toml
+	peersTemplate embed.FS
 )
 
 // Section is a custom type for specific sections in the configuration file.
@@ -36,10 +44,17 @@ const (
 
 	// PrivvalSection defines the [privval] section of the configuration file.
 	PrivvalSection
+
+	// LightSection defines the [light] section of the configuration file.
+	LightSection
+
+	// PeersSection defines the [peers] section of the configuration file.
+	PeersSection
 )
 
 // Create writes configuration templates to the configuration file at the specified
-// configuration directory. The base and privval sections are created by default.
+// configuration directory. The base, privval, light and peers sections are created
+// by default.
 func Create(cfgDir string, sections ...Section) error {
 	var cfg bytes.Buffer
 	baseBytes, err := baseTemplate.ReadFile("templates/base.toml")
@@ -56,6 +71,20 @@ func Create(cfgDir string, sections ...Section) error {
 	if _, err := cfg.Write(privvalBytes); err != nil {
 		return err
 	}
+	lightBytes, err := lightTemplate.ReadFile("templates/light.toml")
+	if err != nil {
+		return err
+	}
+	if _, err := cfg.Write(lightBytes); err != nil {
+		return err
+	}
+	peersBytes, err := peersTemplate.ReadFile("templates/peers.toml")
+	if err != nil {
+		return err
+	}
+	if _, err := cfg.Write(peersBytes); err != nil {
+		return err
+	}
 	if err := ioutil.WriteFile(FilePath(cfgDir), cfg.Bytes(), PermConfigToml); err != nil {
 		return err
 	}
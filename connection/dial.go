@@ -11,9 +11,9 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/BlockscapeNetwork/signctrl/metrics"
 	"github.com/BlockscapeNetwork/signctrl/types"
 	tm_ed25519 "github.com/tendermint/tendermint/crypto/ed25519"
-	tm_p2pconn "github.com/tendermint/tendermint/p2p/conn"
 )
 
 var (
@@ -28,17 +28,27 @@ var (
 )
 
 // retryDialTCP keeps dialing the given TCP socket address until success, using the
-// given connkey for encryption and returns the secret connection.
-func retryDialTCP(address string, connkey tm_ed25519.PrivKey, sigs chan os.Signal, logger *types.SyncLogger) (net.Conn, error) {
+// given connkey for encryption and returns the secret connection. Connections to
+// remote public keys that aren't pinned, or whose handshake fails or doesn't complete
+// within the handshake timeout, are dropped and dialed again.
+func retryDialTCP(address string, connkey tm_ed25519.PrivKey, pinned []string, sigs chan os.Signal, logger *types.SyncLogger, m *metrics.Metrics) (net.Conn, error) {
 	for {
 		select {
 		case <-sigs:
 			return nil, ErrAbortDial
 
 		case <-time.After(RetryDialInterval):
+			m.DialAttempts.Inc()
 			if conn, err := net.Dial("tcp", strings.TrimPrefix(address, "tcp://")); err == nil {
 				logger.Info("Successfully dialed the validator ✓")
-				return tm_p2pconn.MakeSecretConnection(conn, connkey)
+				secretConn, err := makeSecretConn(conn, connkey, pinned)
+				if err != nil {
+					logger.Error("%v\n", err)
+					RetryDialInterval = time.Second
+					continue
+				}
+				m.Connected.Set(1)
+				return secretConn, nil
 			}
 
 			// After the first dial, dial in intervals of 1 second.
@@ -50,7 +60,7 @@ func retryDialTCP(address string, connkey tm_ed25519.PrivKey, sigs chan os.Signa
 
 // retryDialUnix keeps dialing the given unix domain socket address until success and
 // returns the connection.
-func retryDialUnix(address string, sigs chan os.Signal, logger *types.SyncLogger) (net.Conn, error) {
+func retryDialUnix(address string, sigs chan os.Signal, logger *types.SyncLogger, m *metrics.Metrics) (net.Conn, error) {
 	addrWithoutProtocol := strings.TrimPrefix(address, "unix://")
 
 	for {
@@ -59,9 +69,11 @@ func retryDialUnix(address string, sigs chan os.Signal, logger *types.SyncLogger
 			return nil, ErrAbortDial
 
 		case <-time.After(RetryDialInterval):
+			m.DialAttempts.Inc()
 			unixAddr := &net.UnixAddr{Name: addrWithoutProtocol, Net: "unix"}
 			if conn, err := net.DialUnix("unix", nil, unixAddr); err == nil {
 				logger.Info("Successfully dialed the validator ✓")
+				m.Connected.Set(1)
 				return conn, nil
 			}
 
@@ -74,7 +86,10 @@ func retryDialUnix(address string, sigs chan os.Signal, logger *types.SyncLogger
 }
 
 // RetryDial keeps dialing the given address until success and returns the connection.
-func RetryDial(cfgDir, address string, logger *types.SyncLogger) (net.Conn, error) {
+// Via TCP, only connections to one of the pinned public keys are accepted, unless
+// none are pinned. Dial attempts and the resulting connection state are reported to
+// the given metrics.
+func RetryDial(cfgDir, address string, pinned []string, logger *types.SyncLogger, m *metrics.Metrics) (net.Conn, error) {
 	logger.Info("Dialing %v... (Use Ctrl+C to abort)", address)
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
@@ -88,10 +103,10 @@ func RetryDial(cfgDir, address string, logger *types.SyncLogger) (net.Conn, erro
 		if err != nil {
 			return nil, fmt.Errorf("couldn't load conn.key: %v", err)
 		}
-		return retryDialTCP(address, connKey, sigs, logger)
+		return retryDialTCP(address, connKey, pinned, sigs, logger, m)
 
 	case "unix":
-		return retryDialUnix(address, sigs, logger)
+		return retryDialUnix(address, sigs, logger, m)
 
 	default:
 		return nil, fmt.Errorf("unknown protocol in address: %v", protocol)
@@ -11,7 +11,9 @@ import (
 	"testing"
 	"time"
 
+	"github.com/BlockscapeNetwork/signctrl/metrics"
 	"github.com/BlockscapeNetwork/signctrl/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	tm_ed25519 "github.com/tendermint/tendermint/crypto/ed25519"
 	tm_p2pconn "github.com/tendermint/tendermint/p2p/conn"
@@ -70,7 +72,7 @@ func TestRetryDialTCP_NoConnKey(t *testing.T) {
 		assert.NoError(t, err)
 	}()
 
-	conn, err := RetryDial(cfgDir, "tcp://"+laddr, types.NewSyncLogger(ioutil.Discard, "", 0))
+	conn, err := RetryDial(cfgDir, "tcp://"+laddr, nil, types.NewSyncLogger(ioutil.Discard, "", 0), metrics.Nop())
 	assert.Nil(t, conn)
 	assert.Error(t, err)
 }
@@ -92,11 +94,51 @@ func TestRetryDialTCP_WithConnKey(t *testing.T) {
 		assert.NoError(t, err)
 	}()
 
-	conn, err := RetryDial(cfgDir, "tcp://"+laddr, types.NewSyncLogger(ioutil.Discard, "", 0))
+	conn, err := RetryDial(cfgDir, "tcp://"+laddr, nil, types.NewSyncLogger(ioutil.Discard, "", 0), metrics.Nop())
 	assert.NotNil(t, conn)
 	assert.NoError(t, err)
 }
 
+func TestRetryDialTCP_StalledHandshake(t *testing.T) {
+	cfgDir := t.TempDir()
+	err := CreateBase64ConnKey(cfgDir)
+	assert.NoError(t, err)
+
+	port, _ := getFreePort(t)
+	laddr := fmt.Sprintf("127.0.0.1:%v", port)
+	listener, err := net.Listen("tcp", laddr)
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	defer func(timeout time.Duration) { handshakeTimeout = timeout }(handshakeTimeout)
+	handshakeTimeout = 200 * time.Millisecond
+
+	// The validator never starts the handshake on the first connection, so it must be
+	// dropped and dialed again.
+	key := tm_ed25519.GenPrivKey()
+	go func() {
+		stalled, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer stalled.Close()
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		if secretConn, err := tm_p2pconn.MakeSecretConnection(conn, key); err == nil {
+			defer secretConn.Close()
+			time.Sleep(100 * time.Millisecond)
+		}
+	}()
+
+	conn, err := RetryDial(cfgDir, "tcp://"+laddr, nil, types.NewSyncLogger(ioutil.Discard, "", 0), metrics.Nop())
+	assert.NoError(t, err)
+	secretConn, ok := conn.(*tm_p2pconn.SecretConnection)
+	assert.True(t, ok)
+	assert.True(t, key.PubKey().Equals(secretConn.RemotePubKey()))
+}
+
 func startMockUnixServer(t *testing.T, laddr string, delay time.Duration, wg *sync.WaitGroup) error {
 	t.Helper()
 	time.Sleep(delay)
@@ -131,15 +173,17 @@ func TestRetryDialUnix(t *testing.T) {
 		assert.NoError(t, err)
 	}()
 
-	conn, err := RetryDial(cfgDir, "unix://"+sockAddr, types.NewSyncLogger(ioutil.Discard, "", 0))
+	m := metrics.Nop()
+	conn, err := RetryDial(cfgDir, "unix://"+sockAddr, nil, types.NewSyncLogger(ioutil.Discard, "", 0), m)
 	assert.NotNil(t, conn)
 	assert.NoError(t, err)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.Connected))
 
 	wg.Wait()
 }
 
 func TestRetryDialUnknown(t *testing.T) {
-	conn, err := RetryDial(".", "invalid://127.0.0.1:3000", types.NewSyncLogger(ioutil.Discard, "", 0))
+	conn, err := RetryDial(".", "invalid://127.0.0.1:3000", nil, types.NewSyncLogger(ioutil.Discard, "", 0), metrics.Nop())
 	assert.Nil(t, conn)
 	assert.Error(t, err)
 }
@@ -2,10 +2,15 @@ package connection
 
 import (
 	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strings"
 
+	tm_crypto "github.com/tendermint/tendermint/crypto"
 	tm_ed25519 "github.com/tendermint/tendermint/crypto/ed25519"
 )
 
@@ -18,6 +23,12 @@ const (
 	PermConnKeyFile = os.FileMode(0700)
 )
 
+var (
+	// ErrUnpinnedPubKey is returned if the remote public key of a secret connection
+	// matches none of the pinned public keys.
+	ErrUnpinnedPubKey = errors.New("remote public key is not pinned")
+)
+
 // KeyFilePath returns the absolute path to the connection key file.
 func KeyFilePath(cfgDir string) string {
 	return filepath.Join(cfgDir, KeyFile)
@@ -46,3 +57,27 @@ func CreateBase64ConnKey(cfgDir string) error {
 
 	return ioutil.WriteFile(KeyFilePath(cfgDir), encKey, PermConnKeyFile)
 }
+
+// KeyID returns the ID of the given connection public key. Just like Tendermint's
+// node IDs, it's the hex-encoded address of the public key.
+func KeyID(pubkey tm_crypto.PubKey) string {
+	return hex.EncodeToString(pubkey.Address())
+}
+
+// CheckRemotePubKey checks whether the remote public key matches one of the pinned
+// public keys, which are either base64-encoded public keys or key IDs. If no public
+// keys are pinned, any remote public key is accepted.
+func CheckRemotePubKey(remote tm_crypto.PubKey, pinned []string) error {
+	if len(pinned) == 0 {
+		return nil
+	}
+
+	encPubKey := base64.StdEncoding.EncodeToString(remote.Bytes())
+	for _, pubkey := range pinned {
+		if pubkey == encPubKey || strings.EqualFold(pubkey, KeyID(remote)) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: %v (ID %v)", ErrUnpinnedPubKey, encPubKey, KeyID(remote))
+}
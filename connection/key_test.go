@@ -1,10 +1,13 @@
 package connection
 
 import (
+	"encoding/base64"
 	"os"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	tm_ed25519 "github.com/tendermint/tendermint/crypto/ed25519"
 )
 
 func TestKeyFilePath(t *testing.T) {
@@ -31,3 +34,29 @@ func TestCreateAndLoadConnKey(t *testing.T) {
 	assert.NotNil(t, key)
 	assert.NoError(t, err)
 }
+
+func TestKeyID(t *testing.T) {
+	pubkey := tm_ed25519.GenPrivKey().PubKey()
+	assert.Equal(t, strings.ToLower(pubkey.Address().String()), KeyID(pubkey))
+}
+
+func TestCheckRemotePubKey(t *testing.T) {
+	pubkey := tm_ed25519.GenPrivKey().PubKey()
+	other := tm_ed25519.GenPrivKey().PubKey()
+
+	// No pinned public keys.
+	err := CheckRemotePubKey(pubkey, nil)
+	assert.NoError(t, err)
+
+	// Pinned base64-encoded public key.
+	err = CheckRemotePubKey(pubkey, []string{base64.StdEncoding.EncodeToString(pubkey.Bytes())})
+	assert.NoError(t, err)
+
+	// Pinned key ID, case-insensitive.
+	err = CheckRemotePubKey(pubkey, []string{KeyID(other), strings.ToUpper(KeyID(pubkey))})
+	assert.NoError(t, err)
+
+	// Not pinned.
+	err = CheckRemotePubKey(pubkey, []string{KeyID(other)})
+	assert.ErrorIs(t, err, ErrUnpinnedPubKey)
+}
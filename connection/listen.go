@@ -0,0 +1,177 @@
+package connection
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/BlockscapeNetwork/signctrl/metrics"
+	"github.com/BlockscapeNetwork/signctrl/types"
+	tm_ed25519 "github.com/tendermint/tendermint/crypto/ed25519"
+	tm_p2pconn "github.com/tendermint/tendermint/p2p/conn"
+)
+
+// acceptInterval is the interval in which SignCTRL stops waiting for the validator
+// to connect in order to check whether it should abort.
+const acceptInterval = time.Second
+
+// handshakeTimeout is the time an accepted or dialed TCP connection has to complete
+// the secret connection handshake, so a stalled peer can't block the listener or the
+// dialer.
+var handshakeTimeout = 10 * time.Second
+
+// deadlineListener is a listener whose Accept can time out. Both TCP and unix domain
+// socket listeners implement it.
+type deadlineListener interface {
+	net.Listener
+	SetDeadline(t time.Time) error
+}
+
+// Listen binds a listener to the given TCP or unix domain socket address that the
+// validator can connect to.
+func Listen(address string) (net.Listener, error) {
+	protocol := regexp.MustCompile(`tcp|unix`).FindString(address)
+	switch protocol {
+	case "tcp":
+		return net.Listen("tcp", strings.TrimPrefix(address, "tcp://"))
+
+	case "unix":
+		// Remove the socket file a previous run might have left behind.
+		addrWithoutProtocol := strings.TrimPrefix(address, "unix://")
+		os.RemoveAll(addrWithoutProtocol)
+		return net.Listen("unix", addrWithoutProtocol)
+
+	default:
+		return nil, fmt.Errorf("unknown protocol in address: %v", protocol)
+	}
+}
+
+// RetryAccept waits until the validator connects to the given listener and returns the
+// connection. Connections via TCP are upgraded to secret connections, using the
+// connection key from the config directory, and dropped if the remote public key
+// isn't pinned. The resulting connection state is reported to the given metrics.
+func RetryAccept(cfgDir string, listener net.Listener, pinned []string, logger *types.SyncLogger, m *metrics.Metrics) (net.Conn, error) {
+	logger.Info("Waiting for the validator to connect to %v... (Use Ctrl+C to abort)", listener.Addr())
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(sigs)
+
+	dl, ok := listener.(deadlineListener)
+	if !ok {
+		return nil, fmt.Errorf("unsupported listener: %T", listener)
+	}
+
+	for {
+		select {
+		case <-sigs:
+			return nil, ErrAbortDial
+
+		default:
+			if err := dl.SetDeadline(time.Now().Add(acceptInterval)); err != nil {
+				return nil, err
+			}
+			conn, err := dl.Accept()
+			if err != nil {
+				var netErr net.Error
+				if errors.As(err, &netErr) && netErr.Timeout() {
+					logger.Debug("Still waiting for the validator...")
+					continue
+				}
+				return nil, err
+			}
+			logger.Info("Accepted connection from the validator ✓")
+
+			if listener.Addr().Network() == "tcp" {
+				// Load the connection key from the config directory which is needed to
+				// establish a secret/encrypted connection with the validator.
+				connKey, err := LoadConnKey(cfgDir)
+				if err != nil {
+					conn.Close()
+					return nil, fmt.Errorf("couldn't load conn.key: %v", err)
+				}
+				secretConn, err := makeSecretConn(conn, connKey, pinned)
+				if err != nil {
+					logger.Error("%v\n", err)
+					continue
+				}
+				m.Connected.Set(1)
+				return secretConn, nil
+			}
+
+			m.Connected.Set(1)
+			return conn, nil
+		}
+	}
+}
+
+// makeSecretConn upgrades the given connection to a secret connection within the
+// handshake timeout and checks the remote public key against the pinned ones. The
+// connection is closed if either fails.
+func makeSecretConn(conn net.Conn, connKey tm_ed25519.PrivKey, pinned []string) (net.Conn, error) {
+	if err := conn.SetDeadline(time.Now().Add(handshakeTimeout)); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("couldn't set handshake deadline: %v", err)
+	}
+	secretConn, err := tm_p2pconn.MakeSecretConnection(conn, connKey)
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("couldn't establish secret connection: %v", err)
+	}
+	if err := CheckRemotePubKey(secretConn.RemotePubKey(), pinned); err != nil {
+		secretConn.Close()
+		return nil, fmt.Errorf("dropped connection with %v: %v", conn.RemoteAddr(), err)
+	}
+	if err := conn.SetDeadline(time.Time{}); err != nil {
+		secretConn.Close()
+		return nil, fmt.Errorf("couldn't clear handshake deadline: %v", err)
+	}
+
+	return secretConn, nil
+}
+
+// secretListener upgrades the connections it accepts to secret connections and drops
+// those whose remote public key isn't pinned.
+type secretListener struct {
+	net.Listener
+	connKey tm_ed25519.PrivKey
+	pinned  []string
+	logger  *types.SyncLogger
+}
+
+// NewSecretListener returns a listener that upgrades the connections accepted by the
+// given TCP listener to secret connections, using the given connection key. Connections
+// whose remote public key isn't pinned are dropped.
+func NewSecretListener(listener net.Listener, connKey tm_ed25519.PrivKey, pinned []string, logger *types.SyncLogger) net.Listener {
+	return &secretListener{
+		Listener: listener,
+		connKey:  connKey,
+		pinned:   pinned,
+		logger:   logger,
+	}
+}
+
+// Accept waits for the next connection that completes the secret connection handshake
+// with a pinned public key.
+// Implements the net.Listener interface.
+func (l *secretListener) Accept() (net.Conn, error) {
+	for {
+		conn, err := l.Listener.Accept()
+		if err != nil {
+			return nil, err
+		}
+
+		secretConn, err := makeSecretConn(conn, l.connKey, l.pinned)
+		if err != nil {
+			l.logger.Error("%v\n", err)
+			continue
+		}
+
+		return secretConn, nil
+	}
+}
@@ -0,0 +1,213 @@
+package connection
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/BlockscapeNetwork/signctrl/metrics"
+	"github.com/BlockscapeNetwork/signctrl/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	tm_ed25519 "github.com/tendermint/tendermint/crypto/ed25519"
+	tm_p2pconn "github.com/tendermint/tendermint/p2p/conn"
+)
+
+// dialMockValidator dials the given address after the delay, like a validator that
+// dials out to its remote signer. Via TCP, it uses the given key for the secret
+// connection.
+func dialMockValidator(t *testing.T, network, address string, key tm_ed25519.PrivKey, delay time.Duration) error {
+	t.Helper()
+	time.Sleep(delay)
+
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if network == "tcp" {
+		secretConn, err := tm_p2pconn.MakeSecretConnection(conn, key)
+		if err != nil {
+			return err
+		}
+		defer secretConn.Close()
+	}
+
+	return nil
+}
+
+func TestRetryAcceptTCP(t *testing.T) {
+	cfgDir := t.TempDir()
+	err := CreateBase64ConnKey(cfgDir)
+	assert.NoError(t, err)
+
+	port, _ := getFreePort(t)
+	laddr := fmt.Sprintf("127.0.0.1:%v", port)
+	listener, err := Listen("tcp://" + laddr)
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- dialMockValidator(t, "tcp", laddr, tm_ed25519.GenPrivKey(), 1100*time.Millisecond)
+	}()
+
+	m := metrics.Nop()
+	conn, err := RetryAccept(cfgDir, listener, nil, types.NewSyncLogger(ioutil.Discard, "", 0), m)
+	assert.NotNil(t, conn)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.Connected))
+	assert.NoError(t, <-errCh)
+}
+
+func TestRetryAcceptTCP_Pinned(t *testing.T) {
+	cfgDir := t.TempDir()
+	err := CreateBase64ConnKey(cfgDir)
+	assert.NoError(t, err)
+
+	port, _ := getFreePort(t)
+	laddr := fmt.Sprintf("127.0.0.1:%v", port)
+	listener, err := Listen("tcp://" + laddr)
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	// The first connection uses a key that isn't pinned and is dropped.
+	pinnedKey := tm_ed25519.GenPrivKey()
+	go func() {
+		_ = dialMockValidator(t, "tcp", laddr, tm_ed25519.GenPrivKey(), 0)
+		_ = dialMockValidator(t, "tcp", laddr, pinnedKey, 0)
+	}()
+
+	conn, err := RetryAccept(cfgDir, listener, []string{KeyID(pinnedKey.PubKey())}, types.NewSyncLogger(ioutil.Discard, "", 0), metrics.Nop())
+	assert.NotNil(t, conn)
+	assert.NoError(t, err)
+	secretConn, ok := conn.(*tm_p2pconn.SecretConnection)
+	assert.True(t, ok)
+	assert.True(t, pinnedKey.PubKey().Equals(secretConn.RemotePubKey()))
+}
+
+func TestRetryAcceptTCP_StalledHandshake(t *testing.T) {
+	cfgDir := t.TempDir()
+	err := CreateBase64ConnKey(cfgDir)
+	assert.NoError(t, err)
+
+	port, _ := getFreePort(t)
+	laddr := fmt.Sprintf("127.0.0.1:%v", port)
+	listener, err := Listen("tcp://" + laddr)
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	defer func(timeout time.Duration) { handshakeTimeout = timeout }(handshakeTimeout)
+	handshakeTimeout = 200 * time.Millisecond
+
+	// The first connection never starts the handshake and must not block the second.
+	stalled, err := net.Dial("tcp", laddr)
+	assert.NoError(t, err)
+	defer stalled.Close()
+	key := tm_ed25519.GenPrivKey()
+	go func() {
+		_ = dialMockValidator(t, "tcp", laddr, key, 0)
+	}()
+
+	conn, err := RetryAccept(cfgDir, listener, nil, types.NewSyncLogger(ioutil.Discard, "", 0), metrics.Nop())
+	assert.NoError(t, err)
+	secretConn, ok := conn.(*tm_p2pconn.SecretConnection)
+	assert.True(t, ok)
+	assert.True(t, key.PubKey().Equals(secretConn.RemotePubKey()))
+}
+
+func TestSecretListener(t *testing.T) {
+	port, _ := getFreePort(t)
+	laddr := fmt.Sprintf("127.0.0.1:%v", port)
+	ln, err := Listen("tcp://" + laddr)
+	assert.NoError(t, err)
+	pinnedKey := tm_ed25519.GenPrivKey()
+	listener := NewSecretListener(ln, tm_ed25519.GenPrivKey(), []string{KeyID(pinnedKey.PubKey())}, types.NewSyncLogger(ioutil.Discard, "", 0))
+	defer listener.Close()
+
+	// The first connection uses a key that isn't pinned and is dropped.
+	go func() {
+		_ = dialMockValidator(t, "tcp", laddr, tm_ed25519.GenPrivKey(), 0)
+		_ = dialMockValidator(t, "tcp", laddr, pinnedKey, 0)
+	}()
+
+	conn, err := listener.Accept()
+	assert.NoError(t, err)
+	secretConn, ok := conn.(*tm_p2pconn.SecretConnection)
+	assert.True(t, ok)
+	assert.True(t, pinnedKey.PubKey().Equals(secretConn.RemotePubKey()))
+}
+
+func TestSecretListener_StalledHandshake(t *testing.T) {
+	port, _ := getFreePort(t)
+	laddr := fmt.Sprintf("127.0.0.1:%v", port)
+	ln, err := Listen("tcp://" + laddr)
+	assert.NoError(t, err)
+	key := tm_ed25519.GenPrivKey()
+	listener := NewSecretListener(ln, tm_ed25519.GenPrivKey(), []string{KeyID(key.PubKey())}, types.NewSyncLogger(ioutil.Discard, "", 0))
+	defer listener.Close()
+
+	defer func(timeout time.Duration) { handshakeTimeout = timeout }(handshakeTimeout)
+	handshakeTimeout = 200 * time.Millisecond
+
+	// The first connection never starts the handshake and must not block the second.
+	stalled, err := net.Dial("tcp", laddr)
+	assert.NoError(t, err)
+	defer stalled.Close()
+	go func() {
+		_ = dialMockValidator(t, "tcp", laddr, key, 0)
+	}()
+
+	conn, err := listener.Accept()
+	assert.NoError(t, err)
+	secretConn, ok := conn.(*tm_p2pconn.SecretConnection)
+	assert.True(t, ok)
+	assert.True(t, key.PubKey().Equals(secretConn.RemotePubKey()))
+}
+
+func TestRetryAcceptTCP_NoConnKey(t *testing.T) {
+	port, _ := getFreePort(t)
+	laddr := fmt.Sprintf("127.0.0.1:%v", port)
+	listener, err := Listen("tcp://" + laddr)
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	go func() {
+		_ = dialMockValidator(t, "tcp", laddr, tm_ed25519.GenPrivKey(), 0)
+	}()
+
+	conn, err := RetryAccept(t.TempDir(), listener, nil, types.NewSyncLogger(ioutil.Discard, "", 0), metrics.Nop())
+	assert.Nil(t, conn)
+	assert.Error(t, err)
+}
+
+func TestRetryAcceptUnix(t *testing.T) {
+	sockAddr := fmt.Sprintf("%v/test.sock", t.TempDir())
+
+	// A stale socket file is removed before listening.
+	err := ioutil.WriteFile(sockAddr, []byte{}, 0600)
+	assert.NoError(t, err)
+
+	listener, err := Listen("unix://" + sockAddr)
+	assert.NoError(t, err)
+	defer listener.Close()
+
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- dialMockValidator(t, "unix", sockAddr, nil, 0)
+	}()
+
+	conn, err := RetryAccept(".", listener, nil, types.NewSyncLogger(ioutil.Discard, "", 0), metrics.Nop())
+	assert.NotNil(t, conn)
+	assert.NoError(t, err)
+	assert.NoError(t, <-errCh)
+}
+
+func TestListenUnknown(t *testing.T) {
+	listener, err := Listen("invalid://127.0.0.1:3000")
+	assert.Nil(t, listener)
+	assert.Error(t, err)
+}
@@ -0,0 +1,371 @@
+package coordination
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/BlockscapeNetwork/signctrl/connection"
+	"github.com/BlockscapeNetwork/signctrl/metrics"
+	"github.com/BlockscapeNetwork/signctrl/types"
+	tm_ed25519 "github.com/tendermint/tendermint/crypto/ed25519"
+	tm_p2pconn "github.com/tendermint/tendermint/p2p/conn"
+)
+
+const (
+	// IntentHandover is announced by rank 1 while it hands over to rank 2.
+	IntentHandover = "handover"
+
+	// IntentDrain is announced by members whose rank is drained.
+	IntentDrain = "drain"
+
+	// maxStatusAge is the number of intervals after which a member's status is
+	// considered stale and no longer checked for conflicts.
+	maxStatusAge = 3
+)
+
+var (
+	// ErrRankConflict is returned if another member of the set claims the same rank.
+	ErrRankConflict = errors.New("another member of the set claims the same rank")
+)
+
+// Status defines the status the members of the set exchange.
+type Status struct {
+	Rank    int    `json:"rank"`
+	Height  int64  `json:"height"`
+	Counter int    `json:"counter"`
+	Intent  string `json:"intent,omitempty"`
+
+	// Schedule is the fingerprint of the member's set changes and drains.
+	Schedule string `json:"schedule,omitempty"`
+
+	// ActiveSchedule is the fingerprint of the member's set changes and drains that
+	// activated up to Height.
+	ActiveSchedule string `json:"active_schedule,omitempty"`
+}
+
+// peer defines another member of the set.
+type peer struct {
+	pubkey  string
+	address string
+}
+
+// peerStatus defines the last status received from a member of the set.
+type peerStatus struct {
+	Status
+	received time.Time
+}
+
+// Node is a member of the set's side channel to the other members. It periodically
+// exchanges its status with them over secret connections, using the conn.key, and
+// checks their statuses for conflicts. The chain remains the source of truth for the
+// ranks, the side channel only raises alerts.
+type Node struct {
+	types.BaseService
+	Logger   *types.SyncLogger
+	Metrics  *metrics.Metrics
+	connKey  tm_ed25519.PrivKey
+	laddr    string
+	peers    []peer
+	interval time.Duration
+	status   func() Status
+
+	mtx      sync.Mutex
+	statuses map[string]peerStatus
+	listener net.Listener
+}
+
+// NewNode creates a new instance of Node. The given status function returns the
+// status that is shared with the other members of the set.
+func NewNode(cfgDir string, cfg config.Peers, status func() Status, logger *types.SyncLogger, m *metrics.Metrics) (*Node, error) {
+	connKey, err := connection.LoadConnKey(cfgDir)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't load %v: %v", connection.KeyFile, err)
+	}
+
+	n := &Node{
+		Logger:   logger,
+		Metrics:  m,
+		connKey:  connKey,
+		laddr:    strings.TrimPrefix(cfg.ListenAddress, "tcp://"),
+		interval: cfg.GetInterval(),
+		status:   status,
+		statuses: make(map[string]peerStatus),
+	}
+	for _, addr := range cfg.Addresses {
+		pubkey, address, err := config.SplitPeerAddress(addr)
+		if err != nil {
+			return nil, err
+		}
+		n.peers = append(n.peers, peer{pubkey: pubkey, address: strings.TrimPrefix(address, "tcp://")})
+	}
+	n.BaseService = *types.NewBaseService(logger, "Coordination", n)
+
+	return n, nil
+}
+
+// pinned returns the public keys of all members of the set.
+func (n *Node) pinned() []string {
+	pinned := make([]string, 0, len(n.peers))
+	for _, p := range n.peers {
+		pinned = append(pinned, p.pubkey)
+	}
+
+	return pinned
+}
+
+// secretConn upgrades the given connection to a secret connection with one of the
+// given members of the set.
+func (n *Node) secretConn(conn net.Conn, pinned []string) (*tm_p2pconn.SecretConnection, error) {
+	if err := conn.SetDeadline(time.Now().Add(n.interval)); err != nil {
+		return nil, err
+	}
+	secretConn, err := tm_p2pconn.MakeSecretConnection(conn, n.connKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// An empty list of pinned public keys would accept anyone.
+	if len(pinned) == 0 {
+		secretConn.Close()
+		return nil, connection.ErrUnpinnedPubKey
+	}
+	if err := connection.CheckRemotePubKey(secretConn.RemotePubKey(), pinned); err != nil {
+		secretConn.Close()
+		return nil, err
+	}
+
+	return secretConn, nil
+}
+
+// handle answers the status of a member of the set that dialed the node.
+func (n *Node) handle(conn net.Conn) {
+	defer conn.Close()
+	secretConn, err := n.secretConn(conn, n.pinned())
+	if err != nil {
+		n.Logger.Error("dropped connection from member %v: %v\n", conn.RemoteAddr(), err)
+		return
+	}
+	defer secretConn.Close()
+
+	var s Status
+	if err := json.NewDecoder(secretConn).Decode(&s); err != nil {
+		n.Logger.Error("couldn't read status from member %v: %v\n", conn.RemoteAddr(), err)
+		return
+	}
+	if err := json.NewEncoder(secretConn).Encode(n.status()); err != nil {
+		n.Logger.Error("couldn't write status to member %v: %v\n", conn.RemoteAddr(), err)
+		return
+	}
+	n.record(connection.KeyID(secretConn.RemotePubKey()), s)
+}
+
+// exchange sends the node's status to the given member of the set and records the
+// status it answers with.
+func (n *Node) exchange(p peer) error {
+	conn, err := net.DialTimeout("tcp", p.address, n.interval)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	secretConn, err := n.secretConn(conn, []string{p.pubkey})
+	if err != nil {
+		return err
+	}
+	defer secretConn.Close()
+
+	if err := json.NewEncoder(secretConn).Encode(n.status()); err != nil {
+		return err
+	}
+	var s Status
+	if err := json.NewDecoder(secretConn).Decode(&s); err != nil {
+		return err
+	}
+	n.record(connection.KeyID(secretConn.RemotePubKey()), s)
+
+	return nil
+}
+
+// record records the status of the member of the set with the given key ID and
+// raises an alert if it conflicts with the node's own status.
+func (n *Node) record(id string, s Status) {
+	n.mtx.Lock()
+	prev, ok := n.statuses[id]
+	n.statuses[id] = peerStatus{Status: s, received: time.Now()}
+	n.mtx.Unlock()
+
+	n.Logger.Debug("Member %v: rank %v, height %v, counter %v, intent %q", id, s.Rank, s.Height, s.Counter, s.Intent)
+	if (!ok || prev.Intent != s.Intent) && s.Intent != "" {
+		n.Logger.Info("Member %v on rank %v announced %v", id, s.Rank, s.Intent)
+	}
+	if err := n.CheckConflict(n.status()); err != nil {
+		n.Logger.Error("ALERT: %v\n", err)
+	}
+	if own := n.status().Schedule; s.Schedule != own {
+		n.Logger.Error("ALERT: member %v has set changes and drains %q, while this node has %q\n", id, s.Schedule, own)
+	}
+}
+
+// CheckConflict checks the given status against the recent statuses of the other
+// members of the set. It returns ErrRankConflict if a member claims the same rank at
+// the same or a higher height. Members at a lower height might not have seen the
+// latest rank update yet, so they are skipped.
+func (n *Node) CheckConflict(s Status) error {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	for id, ps := range n.statuses {
+		if time.Since(ps.received) > maxStatusAge*n.interval || ps.Height < s.Height {
+			continue
+		}
+		if ps.Rank == s.Rank {
+			n.Metrics.PeerConflict.Set(1)
+			return fmt.Errorf("%w: member %v claims rank %v at height %v", ErrRankConflict, id, ps.Rank, ps.Height)
+		}
+	}
+	n.Metrics.PeerConflict.Set(0)
+
+	return nil
+}
+
+// Forget drops the recorded statuses of the other members of the set. It's called after
+// the node's rank changed, as the statuses recorded before might predate the rank update,
+// e.g. the one of a former rank 1 that is shutting down.
+func (n *Node) Forget() {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	n.statuses = make(map[string]peerStatus)
+	n.Metrics.PeerConflict.Set(0)
+}
+
+// CheckSchedule checks the given fingerprint of the node's set changes and drains
+// against the ones the other members of the set recently reported. Stale statuses are
+// skipped, as the member might have updated its schedule since.
+func (n *Node) CheckSchedule(schedule string) error {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	for id, ps := range n.statuses {
+		if time.Since(ps.received) > maxStatusAge*n.interval {
+			continue
+		}
+		if ps.Schedule != schedule {
+			return fmt.Errorf("member %v has set changes and drains %q, while this node has %q", id, ps.Schedule, schedule)
+		}
+	}
+
+	return nil
+}
+
+// CheckActiveSchedule checks the fingerprints of the set changes and drains that
+// activated up to the heights the other members of the set reported against the ones
+// of the node, which are returned by the given function. Unlike CheckSchedule, it
+// doesn't fail while a set change or a drain is added to the schedules one member
+// after another ahead of its height. Stale statuses are skipped.
+func (n *Node) CheckActiveSchedule(scheduleAt func(height int64) string) error {
+	n.mtx.Lock()
+	defer n.mtx.Unlock()
+
+	for id, ps := range n.statuses {
+		if time.Since(ps.received) > maxStatusAge*n.interval {
+			continue
+		}
+		if schedule := scheduleAt(ps.Height); ps.ActiveSchedule != schedule {
+			return fmt.Errorf("member %v has set changes and drains %q at height %v, while this node has %q", id, ps.ActiveSchedule, ps.Height, schedule)
+		}
+	}
+
+	return nil
+}
+
+// Sync exchanges the node's status with all other members of the set at once and
+// waits for them to answer, or for the context to be done. It returns the number of
+// members that answered.
+func (n *Node) Sync(ctx context.Context) int {
+	results := make(chan error, len(n.peers))
+	for _, p := range n.peers {
+		go func(p peer) {
+			results <- n.exchange(p)
+		}(p)
+	}
+
+	var reached int
+	for range n.peers {
+		select {
+		case <-ctx.Done():
+			return reached
+		case err := <-results:
+			if err == nil {
+				reached++
+			}
+		}
+	}
+
+	return reached
+}
+
+// accept accepts connections from the other members of the set until the listener
+// is closed.
+func (n *Node) accept() {
+	for {
+		conn, err := n.listener.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			n.Logger.Error("couldn't accept connection from member: %v\n", err)
+			continue
+		}
+		go n.handle(conn)
+	}
+}
+
+// gossip exchanges the node's status with the other members of the set in intervals
+// until the node is stopped.
+func (n *Node) gossip() {
+	ticker := time.NewTicker(n.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-n.Quit():
+			return
+
+		case <-ticker.C:
+			for _, p := range n.peers {
+				go func(p peer) {
+					if err := n.exchange(p); err != nil {
+						n.Logger.Debug("Couldn't exchange status with member %v: %v", p.address, err)
+					}
+				}(p)
+			}
+		}
+	}
+}
+
+// OnStart starts listening for the other members of the set and exchanging statuses
+// with them.
+// Implements the Service interface.
+func (n *Node) OnStart() (err error) {
+	n.Logger.Info("Listening for members of the set on %v...", n.laddr)
+	if n.listener, err = net.Listen("tcp", n.laddr); err != nil {
+		return err
+	}
+	go n.accept()
+	go n.gossip()
+
+	return nil
+}
+
+// OnStop stops listening for the other members of the set.
+// Implements the Service interface.
+func (n *Node) OnStop() error {
+	return n.listener.Close()
+}
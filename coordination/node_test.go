@@ -0,0 +1,186 @@
+package coordination
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/BlockscapeNetwork/signctrl/connection"
+	"github.com/BlockscapeNetwork/signctrl/metrics"
+	"github.com/BlockscapeNetwork/signctrl/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func getFreePort(t *testing.T) (port int, err error) {
+	t.Helper()
+	var a *net.TCPAddr
+	if a, err = net.ResolveTCPAddr("tcp", "localhost:0"); err == nil {
+		var l *net.TCPListener
+		if l, err = net.ListenTCP("tcp", a); err == nil {
+			defer l.Close()
+			return l.Addr().(*net.TCPAddr).Port, nil
+		}
+	}
+
+	return
+}
+
+// testMember creates a config directory with a conn.key and returns it along with
+// the member's listen address and key ID.
+func testMember(t *testing.T) (cfgDir string, laddr string, id string) {
+	t.Helper()
+	cfgDir = t.TempDir()
+	err := connection.CreateBase64ConnKey(cfgDir)
+	assert.NoError(t, err)
+	connKey, err := connection.LoadConnKey(cfgDir)
+	assert.NoError(t, err)
+	port, _ := getFreePort(t)
+
+	return cfgDir, fmt.Sprintf("tcp://127.0.0.1:%v", port), connection.KeyID(connKey.PubKey())
+}
+
+// testNode creates a node with the given status that knows the given peers.
+func testNode(t *testing.T, cfgDir, laddr string, s Status, peers ...string) *Node {
+	t.Helper()
+	n, err := NewNode(cfgDir, config.Peers{
+		ListenAddress: laddr,
+		Addresses:     peers,
+		Interval:      "100ms",
+	}, func() Status { return s }, types.NewSyncLogger(ioutil.Discard, "", 0), metrics.Nop())
+	assert.NoError(t, err)
+
+	return n
+}
+
+func TestNode_Exchange(t *testing.T) {
+	dirA, laddrA, idA := testMember(t)
+	dirB, laddrB, idB := testMember(t)
+
+	a := testNode(t, dirA, laddrA, Status{Rank: 1, Height: 10}, fmt.Sprintf("%v@%v", idB, laddrB))
+	b := testNode(t, dirB, laddrB, Status{Rank: 2, Height: 10, Intent: IntentDrain}, fmt.Sprintf("%v@%v", idA, laddrA))
+	assert.NoError(t, a.Start())
+	defer a.Stop()
+	assert.NoError(t, b.Start())
+	defer b.Stop()
+
+	time.Sleep(500 * time.Millisecond)
+	a.mtx.Lock()
+	assert.Equal(t, IntentDrain, a.statuses[idB].Intent)
+	a.mtx.Unlock()
+	b.mtx.Lock()
+	assert.Equal(t, 1, b.statuses[idA].Rank)
+	b.mtx.Unlock()
+
+	// No conflict for distinct ranks.
+	assert.NoError(t, a.CheckConflict(Status{Rank: 1, Height: 10}))
+
+	// Member B claims rank 2 as well.
+	err := a.CheckConflict(Status{Rank: 2, Height: 10})
+	assert.ErrorIs(t, err, ErrRankConflict)
+	assert.Equal(t, float64(1), testutil.ToFloat64(a.Metrics.PeerConflict))
+
+	// Member B might not have seen the rank update at height 11 yet.
+	assert.NoError(t, a.CheckConflict(Status{Rank: 2, Height: 11}))
+}
+
+func TestNode_Unpinned(t *testing.T) {
+	dirA, laddrA, _ := testMember(t)
+	dirB, laddrB, idB := testMember(t)
+
+	// Member A doesn't know member B.
+	a := testNode(t, dirA, laddrA, Status{Rank: 1, Height: 10})
+	b := testNode(t, dirB, laddrB, Status{Rank: 1, Height: 10}, fmt.Sprintf("%v@%v", idB, laddrA))
+	assert.NoError(t, a.Start())
+	defer a.Stop()
+
+	err := b.exchange(b.peers[0])
+	assert.Error(t, err)
+	a.mtx.Lock()
+	assert.Empty(t, a.statuses)
+	a.mtx.Unlock()
+}
+
+func TestCheckConflict_Stale(t *testing.T) {
+	n := &Node{
+		Metrics:  metrics.Nop(),
+		interval: time.Second,
+		statuses: map[string]peerStatus{
+			"stale": {Status: Status{Rank: 1, Height: 10}, received: time.Now().Add(-maxStatusAge * 2 * time.Second)},
+		},
+	}
+	assert.NoError(t, n.CheckConflict(Status{Rank: 1, Height: 10}))
+}
+
+func TestCheckSchedule_Stale(t *testing.T) {
+	n := &Node{
+		Metrics:  metrics.Nop(),
+		interval: time.Second,
+		statuses: map[string]peerStatus{
+			"stale":  {Status: Status{Rank: 2, Height: 10, Schedule: "old"}, received: time.Now().Add(-maxStatusAge * 2 * time.Second)},
+			"recent": {Status: Status{Rank: 3, Height: 10, Schedule: "abc"}, received: time.Now()},
+		},
+	}
+	assert.NoError(t, n.CheckSchedule("abc"))
+	assert.Error(t, n.CheckSchedule("def"))
+}
+
+func TestForget(t *testing.T) {
+	n := &Node{
+		Metrics:  metrics.Nop(),
+		interval: time.Second,
+		statuses: map[string]peerStatus{
+			"former": {Status: Status{Rank: 1, Height: 10}, received: time.Now()},
+		},
+	}
+	assert.ErrorIs(t, n.CheckConflict(Status{Rank: 1, Height: 10}), ErrRankConflict)
+
+	// The status recorded before the promotion no longer blocks the new rank 1.
+	n.Forget()
+	assert.NoError(t, n.CheckConflict(Status{Rank: 1, Height: 10}))
+	assert.Equal(t, float64(0), testutil.ToFloat64(n.Metrics.PeerConflict))
+}
+
+func TestNode_SyncSchedule(t *testing.T) {
+	dirA, laddrA, idA := testMember(t)
+	dirB, laddrB, idB := testMember(t)
+	_, laddrC, idC := testMember(t)
+
+	// Member C is never started, so it can't be reached.
+	a := testNode(t, dirA, laddrA, Status{Rank: 1, Height: 10, Schedule: "abc"}, fmt.Sprintf("%v@%v", idB, laddrB), fmt.Sprintf("%v@%v", idC, laddrC))
+	b := testNode(t, dirB, laddrB, Status{Rank: 2, Height: 10, Schedule: "def"}, fmt.Sprintf("%v@%v", idA, laddrA))
+	assert.NoError(t, b.Start())
+	defer b.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	assert.Equal(t, 1, a.Sync(ctx))
+	assert.Error(t, a.CheckSchedule("abc"))
+	assert.NoError(t, a.CheckSchedule("def"))
+}
+
+func TestCheckActiveSchedule(t *testing.T) {
+	n := &Node{
+		Metrics:  metrics.Nop(),
+		interval: time.Second,
+		statuses: map[string]peerStatus{
+			"member": {Status: Status{Rank: 2, Height: 10, Schedule: "new", ActiveSchedule: "abc"}, received: time.Now()},
+			"stale":  {Status: Status{Rank: 3, Height: 5, ActiveSchedule: "old"}, received: time.Now().Add(-maxStatusAge * 2 * time.Second)},
+		},
+	}
+
+	// The member has already added a drain ahead of its height, which doesn't matter
+	// as long as the schedules that activated up to its height match.
+	scheduleAt := func(height int64) string {
+		if height >= 10 {
+			return "abc"
+		}
+		return ""
+	}
+	assert.NoError(t, n.CheckActiveSchedule(scheduleAt))
+	assert.Error(t, n.CheckActiveSchedule(func(int64) string { return "def" }))
+}
@@ -4,10 +4,15 @@ go 1.16
 
 require (
 	github.com/gogo/protobuf v1.3.2
+	github.com/gorilla/websocket v1.4.2
 	github.com/hashicorp/logutils v1.0.0
+	github.com/miekg/pkcs11 v1.1.2
 	github.com/prometheus/client_golang v1.8.0
 	github.com/spf13/cobra v1.1.3
 	github.com/spf13/viper v1.7.1
 	github.com/stretchr/testify v1.7.0
 	github.com/tendermint/tendermint v0.34.8
+	github.com/tendermint/tm-db v0.6.4
+	golang.org/x/crypto v0.0.0-20201117144127-c1f2f97bffc9
+	golang.org/x/term v0.0.0-20201117132131-f5c789dd3221
 )
@@ -0,0 +1,183 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const (
+	// ReasonWrongChainID is the reason for refusing sign requests for a chain ID
+	// other than the one in the config.toml.
+	ReasonWrongChainID = "wrong_chain_id"
+
+	// ReasonRankObsolete is the reason for refusing sign requests if the validator's
+	// rank has been rendered obsolete by a rank update in the set.
+	ReasonRankObsolete = "rank_obsolete"
+
+	// ReasonQueryBlock is the reason for refusing sign requests if the block of the
+	// previous height couldn't be queried.
+	ReasonQueryBlock = "query_block"
+
+	// ReasonMustShutdown is the reason for refusing sign requests if rank 1 missed
+	// too many blocks in a row and must be shut down.
+	ReasonMustShutdown = "must_shutdown"
+
+	// ReasonNoPermission is the reason for refusing sign requests if the validator
+	// is not ranked first in the set.
+	ReasonNoPermission = "no_permission"
+
+	// ReasonRemovedFromSet is the reason for refusing sign requests if the validator's
+	// rank has been removed from the set by a set change.
+	ReasonRemovedFromSet = "removed_from_set"
+
+	// ReasonHandover is the reason for refusing sign requests if rank 1 hands over to
+	// rank 2.
+	ReasonHandover = "handover"
+
+	// ReasonFenced is the reason for refusing sign requests if SignCTRL shut itself
+	// down before and the fence hasn't been lifted via signctrl unfence yet.
+	ReasonFenced = "fenced"
+
+	// ReasonPeerConflict is the reason for refusing sign requests if another member
+	// of the set claims rank 1 as well.
+	ReasonPeerConflict = "peer_conflict"
+
+	// ReasonScheduleMismatch is the reason for refusing sign requests if another member
+	// of the set has different set changes or drains.
+	ReasonScheduleMismatch = "schedule_mismatch"
+
+	// ReasonDuplicateRank is the reason for refusing sign requests if another node in
+	// the set signs as rank 1 as well.
+	ReasonDuplicateRank = "duplicate_rank"
+
+	// ReasonDoubleSign is the reason for refusing sign requests if they regress the
+	// last signed height, round and step, or conflict with the last signed data.
+	ReasonDoubleSign = "double_sign"
+
+	// ReasonSignFailed is the reason for refusing sign requests if the underlying
+	// PrivValidator failed to sign the vote/proposal.
+	ReasonSignFailed = "sign_failed"
+)
+
+// Metrics wraps SignCTRL's prometheus counters, histograms and connection state
+// gauge.
+type Metrics struct {
+	// SignedMsgs counts the signed votes and proposals by their SignedMsgType.
+	SignedMsgs *prometheus.CounterVec
+
+	// RefusedSignRequests counts the refused sign requests by their reason.
+	RefusedSignRequests *prometheus.CounterVec
+
+	// SignLatency measures the time it takes to handle a sign request that results
+	// in a signature, by SignedMsgType.
+	SignLatency *prometheus.HistogramVec
+
+	// QueryBlockFailures counts the failed queries to the /block endpoint.
+	QueryBlockFailures prometheus.Counter
+
+	// QueryBlockLatency measures the time it takes to query the /block endpoint.
+	QueryBlockLatency prometheus.Histogram
+
+	// BlockCacheHits counts the block lookups served from the RPC client's cache.
+	BlockCacheHits prometheus.Counter
+
+	// BlockCacheMisses counts the block lookups that fell back to querying the
+	// /block endpoint.
+	BlockCacheMisses prometheus.Counter
+
+	// RPCEndpointUp is 1 if the RPC server at the given address is considered
+	// healthy, and 0 if not.
+	RPCEndpointUp *prometheus.GaugeVec
+
+	// UnverifiedBlocks counts the blocks lacking the validator's commitsig that
+	// failed light client verification and were therefore not counted as missed.
+	UnverifiedBlocks prometheus.Counter
+
+	// DialAttempts counts the attempts to dial the validator.
+	DialAttempts prometheus.Counter
+
+	// Reconnects counts the reconnects to the validator after the connection has
+	// been lost.
+	Reconnects prometheus.Counter
+
+	// Connected is 1 if SignCTRL is connected to the validator, and 0 if not.
+	Connected prometheus.Gauge
+
+	// ForeignSignatures counts the heights at which the validator's signature was
+	// found on chain although this node didn't sign as rank 1.
+	ForeignSignatures prometheus.Counter
+
+	// PeerConflict is 1 if another member of the set claims the same rank, and 0 if
+	// not.
+	PeerConflict prometheus.Gauge
+}
+
+// New registers SignCTRL's metrics with the given registerer and returns them.
+func New(reg prometheus.Registerer) *Metrics {
+	return &Metrics{
+		SignedMsgs: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "signctrl_signed_msgs_total",
+			Help: "Number of signed votes and proposals.",
+		}, []string{"type"}),
+		RefusedSignRequests: promauto.With(reg).NewCounterVec(prometheus.CounterOpts{
+			Name: "signctrl_refused_sign_requests_total",
+			Help: "Number of refused sign requests.",
+		}, []string{"reason"}),
+		SignLatency: promauto.With(reg).NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "signctrl_sign_latency_seconds",
+			Help:    "Time it takes to handle a sign request that results in a signature.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"type"}),
+		QueryBlockFailures: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "signctrl_query_block_failures_total",
+			Help: "Number of failed queries to the validator's /block endpoint.",
+		}),
+		QueryBlockLatency: promauto.With(reg).NewHistogram(prometheus.HistogramOpts{
+			Name:    "signctrl_query_block_latency_seconds",
+			Help:    "Time it takes to query the validator's /block endpoint.",
+			Buckets: prometheus.DefBuckets,
+		}),
+		BlockCacheHits: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "signctrl_block_cache_hits_total",
+			Help: "Number of block lookups served from the cache of NewBlock events.",
+		}),
+		BlockCacheMisses: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "signctrl_block_cache_misses_total",
+			Help: "Number of block lookups that fell back to the validator's /block endpoint.",
+		}),
+		RPCEndpointUp: promauto.With(reg).NewGaugeVec(prometheus.GaugeOpts{
+			Name: "signctrl_rpc_endpoint_up",
+			Help: "Whether the RPC server is considered healthy (1) or not (0).",
+		}, []string{"addr"}),
+		UnverifiedBlocks: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "signctrl_unverified_blocks_total",
+			Help: "Number of blocks lacking the validator's commitsig that failed light client verification.",
+		}),
+		DialAttempts: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "signctrl_dial_attempts_total",
+			Help: "Number of attempts to dial the validator.",
+		}),
+		Reconnects: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "signctrl_reconnects_total",
+			Help: "Number of reconnects to the validator after the connection was lost.",
+		}),
+		Connected: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "signctrl_connected",
+			Help: "Whether SignCTRL is connected to the validator (1) or not (0).",
+		}),
+		ForeignSignatures: promauto.With(reg).NewCounter(prometheus.CounterOpts{
+			Name: "signctrl_foreign_signatures_total",
+			Help: "Number of heights at which the validator's signature was found on chain although this node didn't sign as rank 1.",
+		}),
+		PeerConflict: promauto.With(reg).NewGauge(prometheus.GaugeOpts{
+			Name: "signctrl_peer_conflict",
+			Help: "Whether another member of the set claims the same rank (1) or not (0).",
+		}),
+	}
+}
+
+// Nop returns metrics that are not registered anywhere and are therefore never
+// exposed.
+func Nop() *Metrics {
+	return New(prometheus.NewRegistry())
+}
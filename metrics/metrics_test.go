@@ -0,0 +1,35 @@
+package metrics
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNew(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	m := New(reg)
+	assert.NotNil(t, m)
+
+	m.SignedMsgs.WithLabelValues("SIGNED_MSG_TYPE_PREVOTE").Inc()
+	m.RefusedSignRequests.WithLabelValues(ReasonNoPermission).Inc()
+	m.SignLatency.WithLabelValues("SIGNED_MSG_TYPE_PREVOTE").Observe(0.01)
+	m.QueryBlockLatency.Observe(0.01)
+	m.RPCEndpointUp.WithLabelValues("tcp://127.0.0.1:26657").Set(1)
+
+	mfs, err := reg.Gather()
+	assert.NoError(t, err)
+	assert.Len(t, mfs, 14)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.SignedMsgs.WithLabelValues("SIGNED_MSG_TYPE_PREVOTE")))
+}
+
+func TestNop(t *testing.T) {
+	m := Nop()
+	assert.NotNil(t, m)
+	assert.NotPanics(t, func() {
+		m.Reconnects.Inc()
+		m.Connected.Set(1)
+	})
+}
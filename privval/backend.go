@@ -0,0 +1,110 @@
+package privval
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"sync"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/BlockscapeNetwork/signctrl/types"
+	tm_privval "github.com/tendermint/tendermint/privval"
+	tm_types "github.com/tendermint/tendermint/types"
+)
+
+const (
+	// BackendFile is the name of the signing backend that keeps the validator's key in
+	// the priv_validator_key.json and its state in the priv_validator_state.json.
+	BackendFile = "file"
+
+	// BackendPKCS11 is the name of the signing backend that keeps the validator's key
+	// in an HSM and its state in the priv_validator_state.json. It requires cgo.
+	BackendPKCS11 = "pkcs11"
+)
+
+// BackendConstructor creates a signing backend from the config.toml in the given
+// configuration directory. Backends that hold resources like connections or sessions
+// should implement io.Closer, so they are closed when SignCTRL stops.
+type BackendConstructor func(cfgDir string, cfg config.Config, logger *types.SyncLogger) (tm_types.PrivValidator, error)
+
+var (
+	backendsMtx sync.RWMutex
+	backends    = map[string]BackendConstructor{
+		BackendFile: newFileBackend,
+	}
+)
+
+// RegisterBackend makes a signing backend available under the given name, so it can
+// be selected via the backend in the [privval] section of the config.toml. It panics
+// if a backend with the same name is already registered.
+func RegisterBackend(name string, constructor BackendConstructor) {
+	backendsMtx.Lock()
+	defer backendsMtx.Unlock()
+
+	if _, ok := backends[name]; ok {
+		panic(fmt.Sprintf("signing backend %q is already registered", name))
+	}
+	backends[name] = constructor
+}
+
+// Backends returns the names of the registered signing backends in ascending order.
+func Backends() []string {
+	backendsMtx.RLock()
+	defer backendsMtx.RUnlock()
+
+	var names []string
+	for name := range backends {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// NewBackend creates the signing backend specified in the [privval] section of the
+// config.toml. It defaults to the file backend.
+func NewBackend(cfgDir string, cfg config.Config, logger *types.SyncLogger) (tm_types.PrivValidator, error) {
+	name := cfg.Privval.Backend
+	if name == "" {
+		name = BackendFile
+	}
+
+	backendsMtx.RLock()
+	constructor, ok := backends[name]
+	backendsMtx.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown signing backend %q, must be one of %v", name, Backends())
+	}
+
+	return constructor(cfgDir, cfg, logger)
+}
+
+// newFileBackend loads the priv_validator_key.json and priv_validator_state.json from
+// the given configuration directory, or generates them if they don't exist. If the
+// priv_validator_key.json is encrypted, the key is decrypted with the passphrase from
+// ReadPassphrase and only kept in memory.
+func newFileBackend(cfgDir string, cfg config.Config, logger *types.SyncLogger) (tm_types.PrivValidator, error) {
+	encrypted, err := IsKeyFileEncrypted(KeyFilePath(cfgDir))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if !encrypted {
+		return tm_privval.LoadOrGenFilePV(KeyFilePath(cfgDir), StateFilePath(cfgDir)), nil
+	}
+
+	k, err := LoadEncryptedKey(KeyFilePath(cfgDir))
+	if err != nil {
+		return nil, err
+	}
+	passphrase, err := ReadPassphrase(fmt.Sprintf("Enter passphrase for %v: ", KeyFile), false)
+	if err != nil {
+		return nil, err
+	}
+	privKey, err := k.Decrypt(passphrase)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Decrypted %v", KeyFile)
+
+	return newSignerPV(privKeySigner{privKey}, StateFilePath(cfgDir))
+}
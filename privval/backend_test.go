@@ -0,0 +1,51 @@
+package privval
+
+import (
+	"io/ioutil"
+	"testing"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/BlockscapeNetwork/signctrl/types"
+	"github.com/stretchr/testify/assert"
+	tm_privval "github.com/tendermint/tendermint/privval"
+	tm_types "github.com/tendermint/tendermint/types"
+)
+
+func TestNewBackend(t *testing.T) {
+	dir := t.TempDir()
+	logger := types.NewSyncLogger(ioutil.Discard, "", 0)
+	cfg := testConfig(t)
+
+	// The file backend is the default.
+	cfg.Privval.Backend = ""
+	backend, err := NewBackend(dir, cfg, logger)
+	assert.NoError(t, err)
+	assert.IsType(t, &tm_privval.FilePV{}, backend)
+	assert.FileExists(t, KeyFilePath(dir))
+
+	cfg.Privval.Backend = "unknown"
+	backend, err = NewBackend(dir, cfg, logger)
+	assert.Error(t, err)
+	assert.Nil(t, backend)
+}
+
+func TestRegisterBackend(t *testing.T) {
+	mock := tm_types.NewMockPV()
+	RegisterBackend("test-mock", func(cfgDir string, cfg config.Config, logger *types.SyncLogger) (tm_types.PrivValidator, error) {
+		return mock, nil
+	})
+	defer func() {
+		backendsMtx.Lock()
+		delete(backends, "test-mock")
+		backendsMtx.Unlock()
+	}()
+	assert.Contains(t, Backends(), "test-mock")
+
+	cfg := testConfig(t)
+	cfg.Privval.Backend = "test-mock"
+	backend, err := NewBackend(t.TempDir(), cfg, types.NewSyncLogger(ioutil.Discard, "", 0))
+	assert.NoError(t, err)
+	assert.Equal(t, mock, backend)
+
+	assert.Panics(t, func() { RegisterBackend(BackendFile, newFileBackend) })
+}
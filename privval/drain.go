@@ -0,0 +1,207 @@
+package privval
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/BlockscapeNetwork/signctrl/types"
+	tm_json "github.com/tendermint/tendermint/libs/json"
+)
+
+// applyDrains applies the drains that activate after the given height of the last
+// applied drain, up to the given height, to the drained ranks of bsc. It returns the
+// height of the last applied drain, which is the given one if none activated.
+func applyDrains(bsc *types.BaseSignCtrled, base config.Base, applied, height int64) int64 {
+	for _, d := range base.Drains {
+		if d.Height <= applied || d.Height > height {
+			continue
+		}
+
+		bsc.Logger.Info("Drain at block height %v: drained ranks %v -> %v", d.Height, bsc.GetDrainedRanks(), d.Ranks)
+		bsc.SetDrainedRanks(d.Ranks)
+		applied = d.Height
+	}
+
+	return applied
+}
+
+// updateDrains applies the drains that activate up to the given height and persists
+// the drained ranks.
+func (pv *SCFilePV) updateDrains(height int64) error {
+	applied := applyDrains(&pv.BaseSignCtrled, pv.Config.Base, pv.State.DrainHeight, height)
+	if applied == pv.State.DrainHeight {
+		return nil
+	}
+	pv.State.DrainHeight = applied
+
+	return pv.saveState()
+}
+
+// skipDrains applies the last drain that activated up to the given height without
+// replaying the ones before. It's used for a fresh state, whose start_rank already
+// refers to the current set.
+func (pv *SCFilePV) skipDrains(height int64) {
+	for _, d := range pv.Config.Base.Drains {
+		if d.Height <= height {
+			pv.SetDrainedRanks(d.Ranks)
+			pv.State.DrainHeight = d.Height
+		}
+	}
+}
+
+// DrainResponse defines the response JSON for drain requests.
+type DrainResponse struct {
+	Height int64 `json:"height"`
+	Ranks  []int `json:"ranks"`
+}
+
+// base returns the [base] section of the config.toml. It must be used instead of
+// pv.Config.Base outside of the sign requests, as the drains scheduled via the /drain
+// endpoint are merged into it while handling them.
+func (pv *SCFilePV) base() config.Base {
+	pv.drainMtx.Lock()
+	defer pv.drainMtx.Unlock()
+
+	return pv.Config.Base
+}
+
+// mergeDrains merges the drains scheduled via the /drain endpoint into the config, so
+// they're applied once they activate.
+func (pv *SCFilePV) mergeDrains() {
+	pv.drainMtx.Lock()
+	defer pv.drainMtx.Unlock()
+
+	if len(pv.pendingDrains) == 0 {
+		return
+	}
+	drains := append([]config.Drain{}, pv.Config.Base.Drains...)
+	pv.Config.Base.Drains = append(drains, pv.pendingDrains...)
+	pv.pendingDrains = nil
+}
+
+// scheduleDrain schedules a drain at the given height that drains the given rank on
+// top of the last scheduled drain, or undrains it. The drain is appended to the
+// config.toml, so it's the same as if it had been configured there in the first place.
+// As the drains must be the same across all validators in the set, it has to be
+// scheduled on every node before its height. If the rank is 0, the node's own rank is
+// drained.
+func (pv *SCFilePV) scheduleDrain(rank int, drained bool, height int64) (config.Drain, error) {
+	pv.drainMtx.Lock()
+	defer pv.drainMtx.Unlock()
+
+	if pv.Peers == nil {
+		return config.Drain{}, errors.New("drains can only be scheduled if the [peers] section is configured")
+	}
+	snapshot := pv.GetSnapshot()
+	if height <= snapshot.Height {
+		return config.Drain{}, fmt.Errorf("drain height %v must be higher than the current height %v", height, snapshot.Height)
+	}
+	var last config.Drain
+	if drains := append(append([]config.Drain{}, pv.Config.Base.Drains...), pv.pendingDrains...); len(drains) > 0 {
+		last = drains[len(drains)-1]
+	}
+	if height <= last.Height {
+		return config.Drain{}, fmt.Errorf("drain height %v must be higher than the last scheduled drain at block height %v", height, last.Height)
+	}
+	if rank == 0 {
+		rank = snapshot.Rank
+	}
+	setSize := pv.Config.Base.SetSizeAt(height)
+	if rank < 2 || rank > setSize {
+		return config.Drain{}, fmt.Errorf("rank %v must be between 2 and %v (set size at block height %v)", rank, setSize, height)
+	}
+
+	// Carry over the drained ranks of the last drain that are still in the set.
+	d := config.Drain{Height: height, Ranks: []int{}}
+	var found bool
+	for _, r := range last.Ranks {
+		if r == rank {
+			found = true
+		} else if r <= setSize {
+			d.Ranks = append(d.Ranks, r)
+		}
+	}
+	if found == drained {
+		if drained {
+			return config.Drain{}, fmt.Errorf("rank %v is already drained by the drain at block height %v", rank, last.Height)
+		}
+		return config.Drain{}, fmt.Errorf("rank %v isn't drained by the drain at block height %v", rank, last.Height)
+	}
+	if drained {
+		d.Ranks = append(d.Ranks, rank)
+	}
+	sort.Ints(d.Ranks)
+
+	if err := config.AppendDrain(config.Dir(), d); err != nil {
+		return config.Drain{}, fmt.Errorf("couldn't append drain to %v: %v", config.File, err)
+	}
+	pv.pendingDrains = append(pv.pendingDrains, d)
+	pv.Logger.Info("Scheduled drain at block height %v: drained ranks %v", d.Height, d.Ranks)
+
+	return d, nil
+}
+
+// drainHandler schedules a drain of a rank on POST and an undrain on DELETE. The
+// height and the rank are passed via the height and rank query parameters. The rank
+// defaults to the node's own rank.
+func (pv *SCFilePV) drainHandler(rw http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	h := r.URL.Query().Get("height")
+	height, err := strconv.ParseInt(h, 10, 64)
+	if err != nil || height <= 0 {
+		http.Error(rw, fmt.Sprintf("invalid height: %v", h), http.StatusBadRequest)
+		return
+	}
+	var rank int
+	if rk := r.URL.Query().Get("rank"); rk != "" {
+		if rank, err = strconv.Atoi(rk); err != nil {
+			http.Error(rw, fmt.Sprintf("invalid rank: %v", rk), http.StatusBadRequest)
+			return
+		}
+	}
+
+	d, err := pv.scheduleDrain(rank, r.Method == http.MethodPost, height)
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusConflict)
+		return
+	}
+	bytes, err := tm_json.Marshal(DrainResponse{Height: d.Height, Ranks: d.Ranks})
+	if err != nil {
+		http.Error(rw, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	_, _ = rw.Write(bytes)
+}
+
+// RequestDrain asks the local node to schedule a drain of the given rank at the given
+// height, or an undrain. If the rank is 0, the node's own rank is used. The scheduled
+// drain is returned.
+func RequestDrain(rank int, drained bool, height int64) (*DrainResponse, error) {
+	method := http.MethodPost
+	if !drained {
+		method = http.MethodDelete
+	}
+	url := fmt.Sprintf("http://127.0.0.1:%v/drain?height=%v", DefaultHTTPPort, height)
+	if rank != 0 {
+		url = fmt.Sprintf("%v&rank=%v", url, rank)
+	}
+	bytes, err := adminRequest(method, url)
+	if err != nil {
+		return nil, err
+	}
+
+	var dr DrainResponse
+	if err := tm_json.Unmarshal(bytes, &dr); err != nil {
+		return nil, err
+	}
+
+	return &dr, nil
+}
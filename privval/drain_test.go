@@ -0,0 +1,192 @@
+package privval
+
+import (
+	"context"
+	"testing"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/BlockscapeNetwork/signctrl/coordination"
+	"github.com/spf13/viper"
+	"github.com/stretchr/testify/assert"
+)
+
+// setDrains configures the SignCTRL set of 3 validators to drain rank 2 at block
+// height 5 and to put it back into the promotion line at block height 30.
+func setDrains(t *testing.T, pv *SCFilePV) {
+	t.Helper()
+	pv.Config.Base.SetSize = 3
+	pv.Config.Base.Drains = []config.Drain{{Height: 5, Ranks: []int{2}}, {Height: 30}}
+}
+
+func TestUpdateDrains(t *testing.T) {
+	pv := mockSCFilePV(t)
+	setDrains(t, pv)
+
+	err := pv.updateDrains(4)
+	assert.NoError(t, err)
+	assert.Empty(t, pv.GetDrainedRanks())
+
+	err = pv.updateDrains(5)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2}, pv.GetDrainedRanks())
+	assert.Equal(t, int64(5), pv.State.DrainHeight)
+
+	state, err := config.LoadOrGenState(config.Dir(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2}, state.DrainedRanks)
+	assert.Equal(t, int64(5), state.DrainHeight)
+
+	err = pv.updateDrains(40)
+	assert.NoError(t, err)
+	assert.Empty(t, pv.GetDrainedRanks())
+	assert.Equal(t, int64(30), pv.State.DrainHeight)
+}
+
+func TestReplay_Drain(t *testing.T) {
+	pv := mockSCFilePV(t)
+	setDrains(t, pv)
+	pv.SetRank(3)
+	quitCh := startSignedBlockEndpoint(t, pv, false)
+	defer close(quitCh)
+
+	// Rank 2 is drained from height 5 on, so rank 3 is promoted straight to rank 1.
+	res, err := replay(context.Background(), 1, 12, pv)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res.rank)
+	assert.Equal(t, []int{2}, res.drained)
+	assert.Equal(t, int64(5), res.drainHeight)
+}
+
+func TestCatchUp_FreshStateSkipsDrains(t *testing.T) {
+	pv := mockSCFilePV(t)
+	setDrains(t, pv)
+	pv.SetRank(3)
+	pv.freshState = true
+
+	err := pv.catchUp(context.Background(), 20)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2}, pv.GetDrainedRanks())
+	assert.Equal(t, int64(5), pv.State.DrainHeight)
+}
+
+func TestCheckSchedule_Drain(t *testing.T) {
+	pv := mockSCFilePV(t)
+	setDrains(t, pv)
+	pv.State.DrainHeight = 5
+	assert.NoError(t, pv.checkSchedule())
+
+	// The applied drain was removed from the config.toml.
+	pv.Config.Base.Drains = nil
+	assert.ErrorIs(t, pv.checkSchedule(), ErrScheduleMismatch)
+}
+
+func TestHandleSignRequest_ScheduleMismatch(t *testing.T) {
+	// Initialize mock SCFilePV with valid values.
+	pv := mockSCFilePV(t)
+	setDrains(t, pv)
+
+	// Start mock endpoint for the block query.
+	quitCh := startSignedBlockEndpoint(t, pv, true)
+	defer close(quitCh)
+
+	// Start another member of the set that doesn't drain rank 2, although it's beyond
+	// the height of the drain.
+	stop := startPeer(t, pv, func() coordination.Status {
+		return coordination.Status{Rank: 2, Height: 10}
+	})
+	defer stop()
+
+	// Handle the request.
+	msg, err := HandleRequest(context.Background(), testSignVoteRequest(t), pv)
+	assert.NotNil(t, msg)
+	assert.ErrorIs(t, err, ErrScheduleMismatch)
+}
+
+func TestHandleSignRequest_DrainRollout(t *testing.T) {
+	// Initialize mock SCFilePV with valid values.
+	pv := mockSCFilePV(t)
+	pv.TMFilePV = freshFilePV(t, pv)
+	setDrains(t, pv)
+
+	// Start mock endpoint for the block query.
+	quitCh := startSignedBlockEndpoint(t, pv, true)
+	defer close(quitCh)
+
+	// Start another member of the set that hasn't scheduled the drains yet. As none
+	// of them activated at its height, it doesn't block signing.
+	stop := startPeer(t, pv, func() coordination.Status {
+		return coordination.Status{Rank: 2, Height: 2, Schedule: "other"}
+	})
+	defer stop()
+
+	// Handle the request.
+	msg, err := HandleRequest(context.Background(), testSignVoteRequest(t), pv)
+	assert.NotNil(t, msg)
+	assert.NoError(t, err)
+}
+
+func TestRequestDrain(t *testing.T) {
+	pv := mockSCFilePV(t)
+	pv.Config.Base.SetSize = 3
+	assert.NoError(t, config.Create(config.Dir(), config.PeersSection))
+	err := pv.StartHTTPServer()
+	assert.NoError(t, err)
+	defer pv.HTTP.Close()
+
+	// Drains require the [peers] section.
+	_, err = RequestDrain(2, true, 10)
+	assert.Error(t, err)
+	pv.Peers = &coordination.Node{}
+
+	dr, err := RequestDrain(2, true, 10)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), dr.Height)
+	assert.Equal(t, []int{2}, dr.Ranks)
+
+	// The drains must be in ascending order of their heights, and only drained ranks
+	// can be undrained.
+	_, err = RequestDrain(3, true, 10)
+	assert.Error(t, err)
+	_, err = RequestDrain(2, true, 20)
+	assert.Error(t, err)
+	_, err = RequestDrain(1, true, 20)
+	assert.Error(t, err)
+	_, err = RequestDrain(3, false, 20)
+	assert.Error(t, err)
+
+	dr, err = RequestDrain(3, true, 20)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{2, 3}, dr.Ranks)
+	dr, err = RequestDrain(2, false, 30)
+	assert.NoError(t, err)
+	assert.Equal(t, []int{3}, dr.Ranks)
+
+	// The drains are merged into the config with the next sign request.
+	assert.Empty(t, pv.base().Drains)
+	pv.mergeDrains()
+	drains := []config.Drain{{Height: 10, Ranks: []int{2}}, {Height: 20, Ranks: []int{2, 3}}, {Height: 30, Ranks: []int{3}}}
+	assert.Equal(t, drains, pv.base().Drains)
+
+	// The drains are appended to the config.toml.
+	v := viper.New()
+	v.SetConfigFile(config.FilePath(config.Dir()))
+	assert.NoError(t, v.ReadInConfig())
+	var c config.Config
+	assert.NoError(t, v.Unmarshal(&c))
+	assert.Equal(t, drains, c.Base.Drains)
+
+	// Invalid height.
+	_, err = RequestDrain(2, true, 0)
+	assert.Error(t, err)
+}
+
+func TestRejoin_Drained(t *testing.T) {
+	pv := mockSCFilePV(t)
+	pv.Config.Base.SetSize = 3
+	pv.SetDrainedRanks([]int{3})
+
+	// The last rank is drained, so the validator rejoins in front of it.
+	err := pv.rejoin(5, ErrRankObsolete)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, pv.GetRank())
+}
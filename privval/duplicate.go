@@ -0,0 +1,49 @@
+package privval
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	// ErrDuplicateRank is returned if the validator's signature shows up on chain for a
+	// height this node didn't sign, although it's ranked first in the set.
+	ErrDuplicateRank = errors.New("another node in the set signs as rank 1")
+)
+
+// checkForeignSignature checks whether the validator's signature for the given height,
+// which was found on chain, was made by this node. If the node is ranked first in the
+// set but didn't sign the height, another node must have signed it, so the foreign
+// signature is reported and ErrDuplicateRank is returned.
+func (pv *SCFilePV) checkForeignSignature(height int64) error {
+	if pv.GetRank() != 1 || pv.State.LastSigned.Height >= height {
+		return nil
+	}
+
+	pv.Metrics.ForeignSignatures.Inc()
+	err := fmt.Errorf("%w: the validator's commitsig for block height %v wasn't signed by this node (last signed height: %v)", ErrDuplicateRank, height, pv.State.LastSigned.Height)
+	pv.Logger.Error("ALERT: %v\n", err)
+
+	return err
+}
+
+// checkDuplicateRank checks whether another node in the set signs as rank 1 before
+// this node signs the given height. This is the case if the validator's commitsig for
+// a height this node didn't sign was found when the height was checked for missed
+// blocks, or if the next block has already arrived with a commitsig for the height.
+func (pv *SCFilePV) checkDuplicateRank(height int64) error {
+	if pv.foreignHeight == height {
+		return fmt.Errorf("%w: the validator's commitsig for block height %v wasn't signed by this node", ErrDuplicateRank, height-2)
+	}
+
+	rb, ok := pv.RPC.Cached(height + 1)
+	if !ok {
+		return nil
+	}
+	pub, _ := pv.TMFilePV.GetPubKey()
+	if !hasSignedCommit(pub.Address(), &rb.Block.LastCommit.Signatures) {
+		return nil
+	}
+
+	return pv.checkForeignSignature(height)
+}
@@ -0,0 +1,72 @@
+package privval
+
+import (
+	"context"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckForeignSignature(t *testing.T) {
+	pv := mockSCFilePV(t)
+	pv.State.LastSigned.Height = 5
+
+	// Heights signed by this node aren't foreign.
+	assert.NoError(t, pv.checkForeignSignature(5))
+	assert.ErrorIs(t, pv.checkForeignSignature(6), ErrDuplicateRank)
+
+	// Backups don't sign, so any signature is foreign to them.
+	pv.SetRank(2)
+	assert.NoError(t, pv.checkForeignSignature(6))
+}
+
+func TestHandleSignRequest_DuplicateRank(t *testing.T) {
+	pv := mockSCFilePV(t)
+	pv.TMFilePV = freshFilePV(t, pv)
+	pv.State.LastSigned.Height = 1
+
+	// Start mock endpoint for the block query. The last commit of block 3 carries the
+	// commitsig for height 2, although rank 1 only signed up to height 1.
+	quitCh := startSignedBlockEndpoint(t, pv, true)
+	defer close(quitCh)
+
+	// Handle the request.
+	req := testSignVoteRequest(t)
+	req.GetSignVoteRequest().Vote.Height = 4
+	msg, err := HandleRequest(context.Background(), req, pv)
+	assert.NotNil(t, msg)
+	assert.ErrorIs(t, err, ErrDuplicateRank)
+	assert.Equal(t, int64(1), pv.State.LastSigned.Height)
+}
+
+func TestHandleSignRequest_ForeignSignatureSequence(t *testing.T) {
+	pv := mockSCFilePV(t)
+	pv.TMFilePV = freshFilePV(t, pv)
+	assert.NoError(t, pv.saveState())
+
+	// The validator's commitsig is on chain for every height.
+	quitCh := startChainEndpoint(t, pv, func(height int64) bool { return true })
+	defer close(quitCh)
+
+	// Rank 1 signs up to height 5, then stops signing due to a handover.
+	for height, err := range signHeights(t, pv, 2, 5) {
+		assert.NoError(t, err, "height %v", height)
+	}
+	_, err := pv.scheduleHandover(6)
+	assert.NoError(t, err)
+
+	// Block 6 carries the commitsig for height 5, which rank 1 signed itself.
+	errs := signHeights(t, pv, 6, 7)
+	assert.ErrorIs(t, errs[6], ErrHandover)
+	assert.ErrorIs(t, errs[7], ErrHandover)
+	assert.Equal(t, float64(0), testutil.ToFloat64(pv.Metrics.ForeignSignatures))
+
+	// Block 7 carries the commitsig for height 6, which another node signed.
+	pv.cancelHandover()
+	errs = signHeights(t, pv, 8, 8)
+	assert.ErrorIs(t, errs[8], ErrDuplicateRank)
+	assert.Contains(t, errs[8].Error(), "block height 6")
+	assert.Equal(t, float64(1), testutil.ToFloat64(pv.Metrics.ForeignSignatures))
+	assert.Equal(t, int64(5), pv.State.LastSigned.Height)
+}
@@ -0,0 +1,35 @@
+package privval
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+)
+
+var (
+	// ErrFenced is returned if SignCTRL shut itself down before and the fence hasn't
+	// been lifted via signctrl unfence yet.
+	ErrFenced = errors.New("fenced after a self-induced shutdown")
+)
+
+// fence persists a fence in the signctrl_state.json file, so that SignCTRL refuses to
+// sign after its next start until the fence is lifted via signctrl unfence. Neither the
+// validator's node ID, its reconnect nor the heights passed since tell a restart of the
+// validator daemon apart from SignCTRL's own, so there's no evidence to lift the fence
+// on automatically.
+func (pv *SCFilePV) fence() error {
+	pv.Logger.Info("Fencing at block height %v...", pv.State.LastHeight)
+	pv.State.Fence = &config.Fence{Height: pv.State.LastHeight}
+
+	return pv.saveState()
+}
+
+// checkFence returns ErrFenced if the fence is set.
+func (pv *SCFilePV) checkFence() error {
+	if fence := pv.State.Fence; fence != nil {
+		return fmt.Errorf("%w at block height %v (restart the validator and use signctrl unfence)", ErrFenced, fence.Height)
+	}
+
+	return nil
+}
@@ -0,0 +1,73 @@
+package privval
+
+import (
+	"context"
+	"testing"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFence(t *testing.T) {
+	pv := mockSCFilePV(t)
+	pv.State.LastHeight = 20
+
+	err := pv.fence()
+	assert.NoError(t, err)
+	assert.Equal(t, &config.Fence{Height: 20}, pv.State.Fence)
+
+	state, err := config.LoadOrGenState(config.Dir(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, pv.State.Fence, state.Fence)
+}
+
+func TestCheckFence(t *testing.T) {
+	pv := mockSCFilePV(t)
+	err := pv.checkFence()
+	assert.NoError(t, err)
+
+	pv.State.Fence = &config.Fence{Height: 20}
+	err = pv.checkFence()
+	assert.ErrorIs(t, err, ErrFenced)
+	assert.NotNil(t, pv.State.Fence)
+}
+
+func TestFence_Restart(t *testing.T) {
+	pv := mockSCFilePV(t)
+	pv.State.LastHeight = 20
+	err := pv.fence()
+	assert.NoError(t, err)
+
+	// After a restart, the validator reports the same node ID whether or not its
+	// daemon was restarted, so the fence holds until it's lifted manually, no matter
+	// how many heights have passed.
+	state, err := config.LoadOrGenState(config.Dir(), nil)
+	assert.NoError(t, err)
+	restarted := mockSCFilePV(t)
+	restarted.State = state
+	err = restarted.checkFence()
+	assert.ErrorIs(t, err, ErrFenced)
+	assert.NotNil(t, restarted.State.Fence)
+}
+
+func TestHandleSignRequest_Fenced(t *testing.T) {
+	// Initialize mock SCFilePV with valid values.
+	pv := mockSCFilePV(t)
+	pv.State.Fence = &config.Fence{Height: 1}
+
+	// Start mock endpoint for the block query.
+	quitCh := startSignedBlockEndpoint(t, pv, true)
+	defer close(quitCh)
+
+	// Handle the request.
+	msg, err := HandleRequest(context.Background(), testSignVoteRequest(t), pv)
+	assert.NotNil(t, msg)
+	assert.ErrorIs(t, err, ErrFenced)
+
+	// The fence doesn't lift itself, no matter how many heights have passed.
+	req := testSignVoteRequest(t)
+	req.GetSignVoteRequest().Vote.Height = 50
+	msg, err = HandleRequest(context.Background(), req, pv)
+	assert.NotNil(t, msg)
+	assert.ErrorIs(t, err, ErrFenced)
+}
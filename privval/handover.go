@@ -0,0 +1,195 @@
+package privval
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	tm_json "github.com/tendermint/tendermint/libs/json"
+)
+
+var (
+	// ErrHandover is returned if rank 1 refuses to sign because it hands over to rank 2.
+	ErrHandover = errors.New("handing over to rank 2")
+)
+
+// HandoverResponse defines the response JSON for handover requests.
+type HandoverResponse struct {
+	Height int64  `json:"height"`
+	Policy string `json:"policy"`
+
+	// PromoteHeight is the height at which rank 2 is promoted and signs in place of
+	// rank 1, which is also the height at which rank 1 shuts down. It's 0 if the rank
+	// policy can't tell the height in advance.
+	PromoteHeight int64 `json:"promote_height"`
+}
+
+// getHandoverHeight returns the height from which on rank 1 stops signing, or 0 if no
+// handover is scheduled.
+func (pv *SCFilePV) getHandoverHeight() int64 {
+	return atomic.LoadInt64(&pv.handoverHeight)
+}
+
+// promoteHeight asks the rank policy for the height at which rank 2 is promoted if
+// rank 1 stops signing at the given height, or returns 0 if it can't tell. The missing
+// commitsig for a height shows up in the next block, which is checked on the sign
+// request for the height after, so the first missed block is block height+1 and rank 2
+// is promoted on the request that counts the last missed block, one height later.
+func (pv *SCFilePV) promoteHeight(height int64) int64 {
+	misses := pv.GetSnapshot().Policy.MissesUntilUpdate(height + 1)
+	if misses == 0 {
+		return 0
+	}
+
+	return height + int64(misses) + 1
+}
+
+// scheduleHandover makes rank 1 stop signing from the given height on and persists the
+// handover. Rank 2 then counts the missed blocks and promotes once its rank policy
+// triggers a rank update, while rank 1 shuts down at the same height due to its rank
+// being obsolete. If the height is 0, the handover starts at the next height.
+func (pv *SCFilePV) scheduleHandover(height int64) (HandoverResponse, error) {
+	snapshot := pv.GetSnapshot()
+	if snapshot.Rank != 1 {
+		return HandoverResponse{}, fmt.Errorf("only rank 1 can hand over (rank: %v)", snapshot.Rank)
+	}
+	if height == 0 {
+		height = snapshot.Height + 1
+	}
+	if height <= snapshot.Height {
+		return HandoverResponse{}, fmt.Errorf("handover height %v must be higher than the current height %v", height, snapshot.Height)
+	}
+
+	atomic.StoreInt64(&pv.handoverHeight, height)
+	if err := pv.saveHandover(); err != nil {
+		atomic.StoreInt64(&pv.handoverHeight, 0)
+		return HandoverResponse{}, fmt.Errorf("couldn't save state to %v: %v", config.StateFile, err)
+	}
+	pv.Logger.Info("Scheduled handover to rank 2, stop signing at block height %v", height)
+
+	return HandoverResponse{
+		Height:        height,
+		Policy:        pv.Config.Base.RankPolicy,
+		PromoteHeight: pv.promoteHeight(height),
+	}, nil
+}
+
+// cancelHandover cancels a scheduled handover. It's persisted with the next state.
+func (pv *SCFilePV) cancelHandover() {
+	if atomic.SwapInt64(&pv.handoverHeight, 0) != 0 {
+		pv.Logger.Info("Canceled handover to rank 2")
+	}
+}
+
+// saveHandover persists the scheduled handover to the signctrl_state.json file. As it's
+// called from the HTTP server, it updates the state file as last saved instead of the
+// state the sign requests work on.
+func (pv *SCFilePV) saveHandover() error {
+	pv.saveMtx.Lock()
+	defer pv.saveMtx.Unlock()
+
+	state, err := config.LoadOrGenState(config.Dir(), nil)
+	if err != nil {
+		return err
+	}
+	state.HandoverHeight = pv.getHandoverHeight()
+
+	return state.Save(config.Dir())
+}
+
+// checkHandover returns ErrHandover if a handover is scheduled at or below the given
+// height.
+func (pv *SCFilePV) checkHandover(height int64) error {
+	if handover := pv.getHandoverHeight(); handover > 0 && height >= handover {
+		return fmt.Errorf("%w since block height %v", ErrHandover, handover)
+	}
+
+	return nil
+}
+
+// handoverHandler schedules a handover on POST and cancels it on DELETE. The height is
+// passed via the height query parameter.
+func (pv *SCFilePV) handoverHandler(rw http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		var height int64
+		if h := r.URL.Query().Get("height"); h != "" {
+			var err error
+			if height, err = strconv.ParseInt(h, 10, 64); err != nil || height < 0 {
+				http.Error(rw, fmt.Sprintf("invalid height: %v", h), http.StatusBadRequest)
+				return
+			}
+		}
+		hr, err := pv.scheduleHandover(height)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusConflict)
+			return
+		}
+		bytes, err := tm_json.Marshal(hr)
+		if err != nil {
+			http.Error(rw, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		_, _ = rw.Write(bytes)
+
+	case http.MethodDelete:
+		pv.cancelHandover()
+		if err := pv.saveHandover(); err != nil {
+			http.Error(rw, fmt.Sprintf("couldn't save state to %v: %v", config.StateFile, err), http.StatusInternalServerError)
+		}
+
+	default:
+		http.Error(rw, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// RequestHandover asks the local node to hand over to rank 2 at the given height. If
+// the height is 0, the node picks the next height.
+func RequestHandover(height int64) (*HandoverResponse, error) {
+	url := fmt.Sprintf("http://127.0.0.1:%v/handover?height=%v", DefaultHTTPPort, height)
+	bytes, err := adminRequest(http.MethodPost, url)
+	if err != nil {
+		return nil, err
+	}
+
+	var hr HandoverResponse
+	if err := tm_json.Unmarshal(bytes, &hr); err != nil {
+		return nil, err
+	}
+
+	return &hr, nil
+}
+
+// CancelHandover asks the local node to cancel a scheduled handover.
+func CancelHandover() error {
+	_, err := adminRequest(http.MethodDelete, fmt.Sprintf("http://127.0.0.1:%v/handover", DefaultHTTPPort))
+	return err
+}
+
+// adminRequest sends a request to one of the node's admin endpoints and returns the
+// response body. Responses other than 200 OK are returned as errors.
+func adminRequest(method, url string) ([]byte, error) {
+	req, err := http.NewRequest(method, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%v: %s", resp.Status, bytes)
+	}
+
+	return bytes, nil
+}
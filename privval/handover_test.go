@@ -0,0 +1,155 @@
+package privval
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/BlockscapeNetwork/signctrl/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScheduleHandover(t *testing.T) {
+	pv := mockSCFilePV(t)
+	assert.NoError(t, pv.saveState())
+	pv.SetCurrentHeight(10)
+
+	// The height must be ahead of the current height.
+	_, err := pv.scheduleHandover(10)
+	assert.Error(t, err)
+
+	hr, err := pv.scheduleHandover(0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(11), hr.Height)
+	assert.Equal(t, int64(22), hr.PromoteHeight)
+	assert.NoError(t, pv.checkHandover(10))
+	assert.ErrorIs(t, pv.checkHandover(11), ErrHandover)
+
+	// The handover survives a restart.
+	state, err := config.LoadOrGenState(config.Dir(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(11), state.HandoverHeight)
+	restarted := NewSCFilePV(pv.Logger, pv.Config, state, pv.TMFilePV, pv.HTTP)
+	assert.ErrorIs(t, restarted.checkHandover(11), ErrHandover)
+
+	pv.cancelHandover()
+	assert.NoError(t, pv.checkHandover(11))
+
+	// Only rank 1 can hand over.
+	pv.SetRank(2)
+	_, err = pv.scheduleHandover(20)
+	assert.Error(t, err)
+}
+
+// signHeights feeds the given validator sign requests for the given heights and returns
+// the errors it refused them with, which are nil for the heights it signed.
+func signHeights(t *testing.T, pv *SCFilePV, from, to int64) map[int64]error {
+	t.Helper()
+	errs := make(map[int64]error)
+	for height := from; height <= to; height++ {
+		req := testSignVoteRequest(t)
+		req.GetSignVoteRequest().Vote.Height = height
+		_, errs[height] = HandleRequest(context.Background(), req, pv)
+	}
+
+	return errs
+}
+
+func TestHandover_PromoteHeight(t *testing.T) {
+	// Rank 1 hands over at height 11.
+	rank1 := mockSCFilePV(t)
+	rank1.TMFilePV = freshFilePV(t, rank1)
+	assert.NoError(t, rank1.saveState())
+	rank1.SetCurrentHeight(10)
+	hr, err := rank1.scheduleHandover(11)
+	assert.NoError(t, err)
+	rank1.SetCurrentHeight(1)
+
+	// The validator's commitsigs are missing from height 11 on.
+	quitCh := startChainEndpoint(t, rank1, func(height int64) bool { return height < 11 })
+	defer close(quitCh)
+
+	// Rank 2 signs first at the reported height.
+	rank2 := mockSCFilePV(t)
+	rank2.TMFilePV = freshFilePV(t, rank1)
+	rank2.SetRank(2)
+	rank2.RPC = rank1.RPC
+	errs := signHeights(t, rank2, 2, hr.PromoteHeight)
+	for height := int64(2); height < hr.PromoteHeight; height++ {
+		assert.Error(t, errs[height])
+	}
+	assert.NoError(t, errs[hr.PromoteHeight])
+
+	// Rank 1 signs up to height 10 and refuses to sign from height 11 on, until it shuts
+	// down at the same height.
+	errs = signHeights(t, rank1, 2, hr.PromoteHeight)
+	assert.NoError(t, errs[10])
+	for height := int64(11); height < hr.PromoteHeight; height++ {
+		assert.ErrorIs(t, errs[height], ErrHandover)
+	}
+	assert.ErrorIs(t, errs[hr.PromoteHeight], types.ErrMustShutdown)
+}
+
+func TestPromoteHeight(t *testing.T) {
+	pv := mockSCFilePV(t)
+
+	// The window policy still counts the block missed at height 8, so blocks 11 and 12
+	// trigger the rank update on the request for height 13.
+	policy := types.NewWindowPolicy(3, 5)
+	policy.Missed(types.Block{Height: 8})
+	pv.SetRankPolicy(policy)
+	assert.Equal(t, int64(13), pv.promoteHeight(10))
+
+	// The time policy depends on the block times.
+	pv.SetRankPolicy(types.NewTimePolicy(time.Minute))
+	assert.Equal(t, int64(0), pv.promoteHeight(10))
+}
+
+func TestRequestHandover(t *testing.T) {
+	pv := mockSCFilePV(t)
+	assert.NoError(t, pv.saveState())
+	err := pv.StartHTTPServer()
+	assert.NoError(t, err)
+	defer pv.HTTP.Close()
+
+	hr, err := RequestHandover(5)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(5), hr.Height)
+	assert.Equal(t, int64(5)+int64(pv.GetThreshold())+1, hr.PromoteHeight)
+	assert.Equal(t, int64(5), pv.getHandoverHeight())
+
+	err = CancelHandover()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), pv.getHandoverHeight())
+	state, err := config.LoadOrGenState(config.Dir(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), state.HandoverHeight)
+
+	// Invalid height.
+	_, err = RequestHandover(1)
+	assert.Error(t, err)
+
+	resp, err := http.DefaultClient.Get(fmt.Sprintf("http://127.0.0.1:%v/handover", DefaultHTTPPort))
+	assert.NoError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.StatusCode)
+}
+
+func TestHandleSignRequest_Handover(t *testing.T) {
+	// Initialize mock SCFilePV with valid values.
+	pv := mockSCFilePV(t)
+	_, err := pv.scheduleHandover(2)
+	assert.NoError(t, err)
+
+	// Start mock endpoint for the block query.
+	quitCh := startSignedBlockEndpoint(t, pv, true)
+	defer close(quitCh)
+
+	// Handle the request.
+	msg, err := HandleRequest(context.Background(), testSignVoteRequest(t), pv)
+	assert.NotNil(t, msg)
+	assert.ErrorIs(t, err, ErrHandover)
+}
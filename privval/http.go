@@ -3,9 +3,11 @@ package privval
 import (
 	"fmt"
 	"io/ioutil"
+	"net"
 	"net/http"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	tm_json "github.com/tendermint/tendermint/libs/json"
 )
 
@@ -21,12 +23,21 @@ type StatusResponse struct {
 	SetSize   int   `json:"set_size"`
 	Counter   int   `json:"counter"`
 	Threshold int   `json:"threshold"`
+	Drained   []int `json:"drained"`
+
+	// Schedule is the fingerprint of the node's set changes and drains.
+	Schedule string `json:"schedule"`
 }
 
 // GetStatus retrieves the node's status in terms of current height, rank
 // and blocks missed in a row.
 func GetStatus() (*StatusResponse, error) {
-	resp, err := http.DefaultClient.Get(fmt.Sprintf("http://127.0.0.1:%v/status", DefaultHTTPPort))
+	return GetStatusFrom(fmt.Sprintf("http://127.0.0.1:%v/status", DefaultHTTPPort))
+}
+
+// GetStatusFrom retrieves the status of the node serving the given /status URL.
+func GetStatusFrom(url string) (*StatusResponse, error) {
+	resp, err := http.DefaultClient.Get(url)
 	if err != nil {
 		return nil, err
 	}
@@ -46,12 +57,16 @@ func GetStatus() (*StatusResponse, error) {
 }
 
 func (pv *SCFilePV) statusHandler(rw http.ResponseWriter, r *http.Request) {
+	snapshot := pv.GetSnapshot()
+	base := pv.base()
 	bytes, err := tm_json.Marshal(StatusResponse{
-		Height:    pv.GetCurrentHeight(),
-		Rank:      pv.GetRank(),
-		SetSize:   pv.Config.Base.SetSize,
-		Counter:   pv.GetMissedInARow(),
+		Height:    snapshot.Height,
+		Rank:      snapshot.Rank,
+		SetSize:   base.SetSizeAt(snapshot.Height),
+		Counter:   snapshot.Counter,
 		Threshold: pv.GetThreshold(),
+		Drained:   pv.GetDrainedRanks(),
+		Schedule:  base.Schedule(),
 	})
 	if err != nil {
 		_, _ = rw.Write(nil)
@@ -61,14 +76,35 @@ func (pv *SCFilePV) statusHandler(rw http.ResponseWriter, r *http.Request) {
 	_, _ = rw.Write(bytes)
 }
 
-// StartHTTPServer starts an HTTP server.
+// localOnly only passes requests from the loopback interface on to the given handler.
+// It guards the admin endpoints, as the HTTP server listens on all interfaces.
+func localOnly(handler http.HandlerFunc) http.HandlerFunc {
+	return func(rw http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if ip := net.ParseIP(host); err != nil || ip == nil || !ip.IsLoopback() {
+			http.Error(rw, "admin endpoints are only served on the loopback interface", http.StatusForbidden)
+			return
+		}
+		handler(rw, r)
+	}
+}
+
+// StartHTTPServer starts an HTTP server. It serves the node's status on /status
+// and the prometheus metrics of SCFilePV's own registry on /metrics. The admin
+// endpoints /handover and /drain are only served to local requests.
 func (pv *SCFilePV) StartHTTPServer() error {
 	pv.Logger.Info("Starting HTTP server...")
 
-	var errCh chan error
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", pv.statusHandler)
+	mux.Handle("/metrics", promhttp.HandlerFor(pv.Registry, promhttp.HandlerOpts{}))
+	mux.HandleFunc("/handover", localOnly(pv.handoverHandler))
+	mux.HandleFunc("/drain", localOnly(pv.drainHandler))
+	pv.HTTP.Handler = mux
+
+	errCh := make(chan error, 1)
 	go func() {
-		http.HandleFunc("/status", pv.statusHandler)
-		if err := pv.HTTP.ListenAndServe(); err != nil {
+		if err := pv.HTTP.ListenAndServe(); err != nil && err != http.ErrServerClosed {
 			errCh <- err
 		}
 	}()
@@ -1,6 +1,10 @@
 package privval
 
 import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -10,8 +14,27 @@ func TestGetStatus(t *testing.T) {
 	pv := mockSCFilePV(t)
 	err := pv.StartHTTPServer()
 	assert.NoError(t, err)
+	defer pv.HTTP.Close()
 
 	sr, err := GetStatus()
 	assert.NotNil(t, sr)
 	assert.NoError(t, err)
 }
+
+func TestMetricsHandler(t *testing.T) {
+	pv := mockSCFilePV(t)
+	pv.Gauges.RankGauge.Set(2)
+
+	err := pv.StartHTTPServer()
+	assert.NoError(t, err)
+	defer pv.HTTP.Close()
+
+	resp, err := http.DefaultClient.Get(fmt.Sprintf("http://127.0.0.1:%v/metrics", DefaultHTTPPort))
+	assert.NoError(t, err)
+	defer resp.Body.Close()
+
+	bytes, err := ioutil.ReadAll(resp.Body)
+	assert.NoError(t, err)
+	assert.True(t, strings.Contains(string(bytes), "signctrl_rank 2"))
+	assert.True(t, strings.Contains(string(bytes), "signctrl_missed_blocks_in_a_row 0"))
+}
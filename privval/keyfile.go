@@ -0,0 +1,235 @@
+package privval
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	tm_crypto "github.com/tendermint/tendermint/crypto"
+	tm_json "github.com/tendermint/tendermint/libs/json"
+	tm_tempfile "github.com/tendermint/tendermint/libs/tempfile"
+	tm_privval "github.com/tendermint/tendermint/privval"
+	tm_types "github.com/tendermint/tendermint/types"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	// EncryptedKeyType is the type of an encrypted priv_validator_key.json.
+	EncryptedKeyType = "signctrl/EncryptedPrivValidatorKey"
+
+	// The scrypt parameters used for new encrypted keys. Deriving the key takes about
+	// a second and 128 MiB of memory, which is only done once on startup.
+	scryptN      = 1 << 17
+	scryptR      = 8
+	scryptP      = 1
+	scryptKeyLen = 32
+	saltSize     = 32
+
+	// PermKeyFile is the permission of the priv_validator_key.json.
+	PermKeyFile = 0600
+)
+
+var (
+	// ErrWrongPassphrase is returned if an encrypted key can't be decrypted with the
+	// given passphrase.
+	ErrWrongPassphrase = errors.New("wrong passphrase or corrupted key file")
+)
+
+// ScryptParams defines the parameters of the scrypt key derivation.
+type ScryptParams struct {
+	N    int    `json:"n"`
+	R    int    `json:"r"`
+	P    int    `json:"p"`
+	Salt []byte `json:"salt"`
+}
+
+// EncryptedKey defines the contents of an encrypted priv_validator_key.json. The
+// address and the public key are kept in plain text, while the private key is
+// encrypted with AES-256-GCM under a key derived from a passphrase via scrypt.
+type EncryptedKey struct {
+	Type       string           `json:"type"`
+	Address    tm_types.Address `json:"address"`
+	PubKey     tm_crypto.PubKey `json:"pub_key"`
+	KDF        string           `json:"kdf"`
+	KDFParams  ScryptParams     `json:"kdf_params"`
+	Cipher     string           `json:"cipher"`
+	Nonce      []byte           `json:"nonce"`
+	Ciphertext []byte           `json:"ciphertext"`
+}
+
+// newGCM derives the key from the given passphrase and returns the AES-256-GCM cipher.
+func newGCM(passphrase []byte, params ScryptParams) (cipher.AEAD, error) {
+	key, err := scrypt.Key(passphrase, params.Salt, params.N, params.R, params.P, scryptKeyLen)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// EncryptKey encrypts the given private key with the given passphrase.
+func EncryptKey(privKey tm_crypto.PrivKey, passphrase []byte) (*EncryptedKey, error) {
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase must not be empty")
+	}
+
+	k := &EncryptedKey{
+		Type:      EncryptedKeyType,
+		Address:   privKey.PubKey().Address(),
+		PubKey:    privKey.PubKey(),
+		KDF:       "scrypt",
+		KDFParams: ScryptParams{N: scryptN, R: scryptR, P: scryptP, Salt: make([]byte, saltSize)},
+		Cipher:    "aes-256-gcm",
+	}
+	if _, err := rand.Read(k.KDFParams.Salt); err != nil {
+		return nil, err
+	}
+	gcm, err := newGCM(passphrase, k.KDFParams)
+	if err != nil {
+		return nil, err
+	}
+	k.Nonce = make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(k.Nonce); err != nil {
+		return nil, err
+	}
+	plaintext, err := tm_json.Marshal(privKey)
+	if err != nil {
+		return nil, err
+	}
+
+	// The public key is authenticated along with the private key, so it can't be
+	// swapped without the passphrase.
+	k.Ciphertext = gcm.Seal(nil, k.Nonce, plaintext, k.PubKey.Bytes())
+
+	return k, nil
+}
+
+// Decrypt decrypts the private key with the given passphrase.
+func (k *EncryptedKey) Decrypt(passphrase []byte) (tm_crypto.PrivKey, error) {
+	if k.Type != EncryptedKeyType || k.KDF != "scrypt" || k.Cipher != "aes-256-gcm" {
+		return nil, fmt.Errorf("unsupported key encryption (type %q, kdf %q, cipher %q)", k.Type, k.KDF, k.Cipher)
+	}
+	if k.PubKey == nil {
+		return nil, errors.New("pub_key must not be empty")
+	}
+	gcm, err := newGCM(passphrase, k.KDFParams)
+	if err != nil {
+		return nil, err
+	}
+	if len(k.Nonce) != gcm.NonceSize() {
+		return nil, fmt.Errorf("invalid nonce size %v", len(k.Nonce))
+	}
+	plaintext, err := gcm.Open(nil, k.Nonce, k.Ciphertext, k.PubKey.Bytes())
+	if err != nil {
+		return nil, ErrWrongPassphrase
+	}
+
+	var privKey tm_crypto.PrivKey
+	if err := tm_json.Unmarshal(plaintext, &privKey); err != nil {
+		return nil, fmt.Errorf("couldn't unmarshal private key: %v", err)
+	}
+	if !privKey.PubKey().Equals(k.PubKey) {
+		return nil, errors.New("private key doesn't match pub_key")
+	}
+
+	return privKey, nil
+}
+
+// Save writes the encrypted key to the given path.
+func (k *EncryptedKey) Save(path string) error {
+	data, err := tm_json.MarshalIndent(k, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return tm_tempfile.WriteFileAtomic(path, data, PermKeyFile)
+}
+
+// LoadEncryptedKey loads the encrypted key at the given path.
+func LoadEncryptedKey(path string) (*EncryptedKey, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var k EncryptedKey
+	if err := tm_json.Unmarshal(data, &k); err != nil {
+		return nil, fmt.Errorf("couldn't unmarshal %v: %v", path, err)
+	}
+
+	return &k, nil
+}
+
+// IsKeyFileEncrypted checks whether the key file at the given path is encrypted.
+func IsKeyFileEncrypted(path string) (bool, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return false, err
+	}
+	var k struct {
+		Type string `json:"type"`
+	}
+	if err := json.Unmarshal(data, &k); err != nil {
+		return false, fmt.Errorf("couldn't unmarshal %v: %v", path, err)
+	}
+
+	return k.Type == EncryptedKeyType, nil
+}
+
+// EncryptKeyFile encrypts the plain text key file at the given path in place. The
+// encrypted key is written next to the original and decrypted again before it
+// replaces the original, so the key can't get lost on the way.
+func EncryptKeyFile(path string, passphrase []byte) error {
+	encrypted, err := IsKeyFileEncrypted(path)
+	if err != nil {
+		return err
+	}
+	if encrypted {
+		return fmt.Errorf("%v is already encrypted", path)
+	}
+
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var pvKey tm_privval.FilePVKey
+	if err := tm_json.Unmarshal(data, &pvKey); err != nil {
+		return fmt.Errorf("couldn't unmarshal %v: %v", path, err)
+	}
+	if pvKey.PrivKey == nil {
+		return fmt.Errorf("%v doesn't contain a priv_key", path)
+	}
+
+	k, err := EncryptKey(pvKey.PrivKey, passphrase)
+	if err != nil {
+		return err
+	}
+	tmpPath := path + ".encrypted"
+	if err := k.Save(tmpPath); err != nil {
+		return err
+	}
+
+	// Verify the written file before it replaces the original.
+	loaded, err := LoadEncryptedKey(tmpPath)
+	if err == nil {
+		var privKey tm_crypto.PrivKey
+		if privKey, err = loaded.Decrypt(passphrase); err == nil && !bytes.Equal(privKey.Bytes(), pvKey.PrivKey.Bytes()) {
+			err = errors.New("decrypted key doesn't match the original")
+		}
+	}
+	if err != nil {
+		os.Remove(tmpPath)
+		return fmt.Errorf("couldn't verify encrypted key: %v", err)
+	}
+
+	return os.Rename(tmpPath, path)
+}
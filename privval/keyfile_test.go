@@ -0,0 +1,87 @@
+package privval
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/BlockscapeNetwork/signctrl/types"
+	"github.com/stretchr/testify/assert"
+	tm_ed25519 "github.com/tendermint/tendermint/crypto/ed25519"
+	tm_privval "github.com/tendermint/tendermint/privval"
+	tm_types "github.com/tendermint/tendermint/types"
+)
+
+func TestEncryptKey(t *testing.T) {
+	privKey := tm_ed25519.GenPrivKey()
+	k, err := EncryptKey(privKey, []byte("passphrase"))
+	assert.NoError(t, err)
+	assert.Equal(t, privKey.PubKey(), k.PubKey)
+
+	decrypted, err := k.Decrypt([]byte("passphrase"))
+	assert.NoError(t, err)
+	assert.Equal(t, privKey, decrypted)
+
+	_, err = k.Decrypt([]byte("wrong"))
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+
+	// The public key can't be swapped without the passphrase.
+	k.PubKey = tm_ed25519.GenPrivKey().PubKey()
+	_, err = k.Decrypt([]byte("passphrase"))
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+
+	_, err = EncryptKey(privKey, nil)
+	assert.Error(t, err)
+}
+
+func TestEncryptKeyFile(t *testing.T) {
+	dir := t.TempDir()
+	filePV := tm_privval.GenFilePV(filepath.Join(dir, KeyFile), filepath.Join(dir, StateFile))
+	filePV.Save()
+
+	encrypted, err := IsKeyFileEncrypted(filepath.Join(dir, KeyFile))
+	assert.NoError(t, err)
+	assert.False(t, encrypted)
+
+	err = EncryptKeyFile(filepath.Join(dir, KeyFile), []byte("passphrase"))
+	assert.NoError(t, err)
+	encrypted, err = IsKeyFileEncrypted(filepath.Join(dir, KeyFile))
+	assert.NoError(t, err)
+	assert.True(t, encrypted)
+	assert.NoFileExists(t, filepath.Join(dir, KeyFile+".encrypted"))
+
+	k, err := LoadEncryptedKey(filepath.Join(dir, KeyFile))
+	assert.NoError(t, err)
+	assert.Equal(t, filePV.Key.Address, k.Address)
+	privKey, err := k.Decrypt([]byte("passphrase"))
+	assert.NoError(t, err)
+	assert.Equal(t, filePV.Key.PrivKey, privKey)
+
+	// An encrypted key file isn't encrypted twice.
+	err = EncryptKeyFile(filepath.Join(dir, KeyFile), []byte("passphrase"))
+	assert.Error(t, err)
+}
+
+func TestNewBackend_EncryptedKey(t *testing.T) {
+	dir := t.TempDir()
+	filePV := tm_privval.GenFilePV(KeyFilePath(dir), StateFilePath(dir))
+	filePV.Save()
+	assert.NoError(t, EncryptKeyFile(KeyFilePath(dir), []byte("passphrase")))
+
+	os.Setenv(PassphraseEnv, "passphrase")
+	defer os.Unsetenv(PassphraseEnv)
+	backend, err := NewBackend(dir, testConfig(t), types.NewSyncLogger(ioutil.Discard, "", 0))
+	assert.NoError(t, err)
+	pub, err := backend.GetPubKey()
+	assert.NoError(t, err)
+	assert.Equal(t, filePV.Key.PubKey, pub)
+
+	vote := testVote(t)
+	assert.NoError(t, backend.SignVote("testchain", vote))
+	assert.True(t, pub.VerifySignature(tm_types.VoteSignBytes("testchain", vote), vote.Signature))
+
+	os.Setenv(PassphraseEnv, "wrong")
+	_, err = NewBackend(dir, testConfig(t), types.NewSyncLogger(ioutil.Discard, "", 0))
+	assert.ErrorIs(t, err, ErrWrongPassphrase)
+}
@@ -0,0 +1,126 @@
+package privval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/BlockscapeNetwork/signctrl/types"
+)
+
+var (
+	// ErrScheduleMismatch is returned if the set changes or drains in the config.toml
+	// disagree with the signctrl_state.json file or with the other members of the set.
+	ErrScheduleMismatch = errors.New("set changes or drains disagree")
+
+	// ErrScheduleUnconfirmed is returned if the set changes and drains in the
+	// config.toml can't be compared with all other members of the set.
+	ErrScheduleUnconfirmed = errors.New("couldn't compare set changes and drains with all members of the set")
+)
+
+// applySetChanges applies the set changes that activate after the given height of the
+// last applied set change, up to the given height, to the ranks of bsc. It returns the
+// height of the last applied set change, which is the given one if none activated.
+func applySetChanges(bsc *types.BaseSignCtrled, base config.Base, applied, height int64) (int64, error) {
+	for _, c := range base.SetChanges {
+		if c.Height <= applied || c.Height > height {
+			continue
+		}
+
+		prevSetSize := base.SetSizeAt(applied)
+		removed := c.RemovedRanks(prevSetSize)
+		bsc.Logger.Info("Set change at block height %v: set_size %v -> %v (removed ranks: %v)", c.Height, prevSetSize, c.SetSize, removed)
+		if err := bsc.RemoveRanks(removed); err != nil {
+			return applied, fmt.Errorf("%w at block height %v", err, c.Height)
+		}
+		applied = c.Height
+	}
+
+	return applied, nil
+}
+
+// setSize returns the number of validators in the set, taking the applied set changes
+// into account.
+func (pv *SCFilePV) setSize() int {
+	return pv.Config.Base.SetSizeAt(pv.State.SetChangeHeight)
+}
+
+// updateSetSize applies the set changes that activate up to the given height and
+// persists the new ranks. If the validator's rank is removed from the set, the state is
+// left as is, so the set change is applied again after a restart.
+func (pv *SCFilePV) updateSetSize(height int64) error {
+	applied, err := applySetChanges(&pv.BaseSignCtrled, pv.Config.Base, pv.State.SetChangeHeight, height)
+	if err != nil {
+		return err
+	}
+	if applied == pv.State.SetChangeHeight {
+		return nil
+	}
+
+	pv.State.SetChangeHeight = applied
+	pv.Gauges.RankGauge.Set(float64(pv.GetRank()))
+
+	return pv.saveState()
+}
+
+// skipSetChanges marks the set changes that activated up to the given height as applied
+// without changing the ranks. It's used for a fresh state, whose start_rank already
+// refers to the current set.
+func (pv *SCFilePV) skipSetChanges(height int64) {
+	for _, c := range pv.Config.Base.SetChanges {
+		if c.Height <= height {
+			pv.State.SetChangeHeight = c.Height
+		}
+	}
+}
+
+// checkSchedule checks whether the set change and the drain persisted in the
+// signctrl_state.json file are still part of the set changes and drains in the
+// config.toml.
+func (pv *SCFilePV) checkSchedule() error {
+	if height := pv.State.SetChangeHeight; height != 0 {
+		var found bool
+		for _, c := range pv.Config.Base.SetChanges {
+			found = found || c.Height == height
+		}
+		if !found {
+			return fmt.Errorf("%w: the set change at block height %v applied according to %v is missing in the %v", ErrScheduleMismatch, height, config.StateFile, config.File)
+		}
+	}
+	if height := pv.State.DrainHeight; height != 0 {
+		var found bool
+		for _, d := range pv.Config.Base.Drains {
+			found = found || d.Height == height
+		}
+		if !found {
+			return fmt.Errorf("%w: the drain at block height %v applied according to %v is missing in the %v", ErrScheduleMismatch, height, config.StateFile, config.File)
+		}
+	}
+
+	return nil
+}
+
+// checkPeerSchedules exchanges statuses with the other members of the set and checks
+// whether they have the same set changes and drains configured. If any are configured,
+// all members must be reached, as a single member with a different schedule would end
+// up with conflicting ranks. Otherwise, members that can't be reached are skipped.
+func (pv *SCFilePV) checkPeerSchedules(ctx context.Context) error {
+	if pv.Peers == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, 3*pv.Config.Peers.GetInterval())
+	defer cancel()
+	if reached := pv.Peers.Sync(ctx); reached < len(pv.Config.Peers.Addresses) {
+		if pv.Config.Base.Schedule() != "" {
+			return fmt.Errorf("%w (reached %v of %v)", ErrScheduleUnconfirmed, reached, len(pv.Config.Peers.Addresses))
+		}
+		pv.Logger.Warn("Only reached %v of %v members of the set, couldn't compare set changes and drains with all of them", reached, len(pv.Config.Peers.Addresses))
+	}
+	if err := pv.Peers.CheckSchedule(pv.Config.Base.Schedule()); err != nil {
+		return fmt.Errorf("%w: %v", ErrScheduleMismatch, err)
+	}
+
+	return nil
+}
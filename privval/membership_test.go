@@ -0,0 +1,103 @@
+package privval
+
+import (
+	"context"
+	"testing"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/BlockscapeNetwork/signctrl/types"
+	"github.com/stretchr/testify/assert"
+)
+
+// setSetChanges configures the SignCTRL set to shrink from 3 to 2 validators at block
+// height 10 by removing rank 2.
+func setSetChanges(t *testing.T, pv *SCFilePV) {
+	t.Helper()
+	pv.Config.Base.SetSize = 3
+	pv.Config.Base.SetChanges = []config.SetChange{{Height: 10, SetSize: 2, RemoveRanks: []int{2}}}
+}
+
+func TestUpdateSetSize(t *testing.T) {
+	pv := mockSCFilePV(t)
+	setSetChanges(t, pv)
+	pv.SetRank(3)
+
+	err := pv.updateSetSize(9)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, pv.GetRank())
+	assert.Equal(t, 3, pv.setSize())
+
+	// Rank 3 moves up to the removed rank 2.
+	err = pv.updateSetSize(10)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, pv.GetRank())
+	assert.Equal(t, 2, pv.setSize())
+	assert.Equal(t, int64(10), pv.State.SetChangeHeight)
+
+	state, err := config.LoadOrGenState(config.Dir(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10), state.SetChangeHeight)
+	assert.Equal(t, 2, state.LastRank)
+}
+
+func TestUpdateSetSize_Removed(t *testing.T) {
+	pv := mockSCFilePV(t)
+	setSetChanges(t, pv)
+	pv.SetRank(2)
+
+	// The state is left as is, so the removal is applied again after a restart.
+	err := pv.updateSetSize(12)
+	assert.ErrorIs(t, err, types.ErrRemovedFromSet)
+	assert.Equal(t, int64(0), pv.State.SetChangeHeight)
+}
+
+func TestReplay_SetChange(t *testing.T) {
+	pv := mockSCFilePV(t)
+	setSetChanges(t, pv)
+	pv.SetRank(3)
+	pv.SetDrainedRanks([]int{3})
+	quitCh := startSignedBlockEndpoint(t, pv, true)
+	defer close(quitCh)
+
+	err := pv.catchUp(context.Background(), 20)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, pv.GetRank())
+	assert.Equal(t, []int{2}, pv.GetDrainedRanks())
+	assert.Equal(t, int64(10), pv.State.SetChangeHeight)
+
+	// The removed rank doesn't catch up.
+	pv = mockSCFilePV(t)
+	setSetChanges(t, pv)
+	pv.SetRank(2)
+	quitCh2 := startSignedBlockEndpoint(t, pv, true)
+	defer close(quitCh2)
+	err = pv.catchUp(context.Background(), 20)
+	assert.ErrorIs(t, err, types.ErrRemovedFromSet)
+}
+
+func TestCatchUp_FreshStateSkipsSetChanges(t *testing.T) {
+	pv := mockSCFilePV(t)
+	setSetChanges(t, pv)
+	pv.SetRank(2)
+	pv.freshState = true
+
+	// The start_rank of a fresh state refers to the set after the set change.
+	err := pv.catchUp(context.Background(), 20)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, pv.GetRank())
+	assert.Equal(t, int64(10), pv.State.SetChangeHeight)
+	assert.Equal(t, 2, pv.setSize())
+}
+
+func TestCheckSchedule(t *testing.T) {
+	pv := mockSCFilePV(t)
+	setSetChanges(t, pv)
+	assert.NoError(t, pv.checkSchedule())
+
+	pv.State.SetChangeHeight = 10
+	assert.NoError(t, pv.checkSchedule())
+
+	// The applied set change was removed from the config.toml.
+	pv.Config.Base.SetChanges = nil
+	assert.ErrorIs(t, pv.checkSchedule(), ErrScheduleMismatch)
+}
@@ -0,0 +1,99 @@
+package privval
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"golang.org/x/term"
+)
+
+const (
+	// PassphraseEnv is the environment variable that holds the passphrase of an
+	// encrypted priv_validator_key.json.
+	PassphraseEnv = "SIGNCTRL_KEY_PASSPHRASE"
+
+	// PassphraseFDEnv is the environment variable that holds the file descriptor the
+	// passphrase of an encrypted priv_validator_key.json is read from.
+	PassphraseFDEnv = "SIGNCTRL_KEY_PASSPHRASE_FD"
+)
+
+var (
+	// ErrNoPassphrase is returned if no passphrase is given and there is no terminal
+	// to prompt for it.
+	ErrNoPassphrase = fmt.Errorf("no passphrase given, set %v or %v", PassphraseEnv, PassphraseFDEnv)
+)
+
+// ReadPassphrase reads the passphrase of an encrypted priv_validator_key.json from the
+// file descriptor in SIGNCTRL_KEY_PASSPHRASE_FD, from SIGNCTRL_KEY_PASSPHRASE or from
+// an interactive prompt, in that order. If confirm is set, the user is asked to enter
+// the passphrase twice on the prompt.
+func ReadPassphrase(prompt string, confirm bool) ([]byte, error) {
+	if fdStr := os.Getenv(PassphraseFDEnv); fdStr != "" {
+		fd, err := strconv.Atoi(fdStr)
+		if err != nil || fd < 0 {
+			return nil, fmt.Errorf("invalid %v: %v", PassphraseFDEnv, fdStr)
+		}
+		return readPassphraseFD(uintptr(fd))
+	}
+	if passphrase := os.Getenv(PassphraseEnv); passphrase != "" {
+		return []byte(passphrase), nil
+	}
+
+	if !term.IsTerminal(int(os.Stdin.Fd())) {
+		return nil, ErrNoPassphrase
+	}
+	passphrase, err := promptPassphrase(prompt)
+	if err != nil {
+		return nil, err
+	}
+	if confirm {
+		again, err := promptPassphrase("Repeat passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(passphrase, again) {
+			return nil, errors.New("passphrases don't match")
+		}
+	}
+
+	return passphrase, nil
+}
+
+// readPassphraseFD reads the first line from the given file descriptor.
+func readPassphraseFD(fd uintptr) ([]byte, error) {
+	f := os.NewFile(fd, "passphrase")
+	if f == nil {
+		return nil, fmt.Errorf("invalid file descriptor %v", fd)
+	}
+	defer f.Close()
+
+	line, err := bufio.NewReader(f).ReadBytes('\n')
+	if err != nil && len(line) == 0 {
+		return nil, fmt.Errorf("couldn't read passphrase from file descriptor %v: %v", fd, err)
+	}
+	passphrase := bytes.TrimRight(line, "\r\n")
+	if len(passphrase) == 0 {
+		return nil, ErrNoPassphrase
+	}
+
+	return passphrase, nil
+}
+
+// promptPassphrase prompts the user for a passphrase without echoing it.
+func promptPassphrase(prompt string) ([]byte, error) {
+	fmt.Fprint(os.Stderr, prompt)
+	passphrase, err := term.ReadPassword(int(os.Stdin.Fd()))
+	fmt.Fprintln(os.Stderr)
+	if err != nil {
+		return nil, err
+	}
+	if len(passphrase) == 0 {
+		return nil, errors.New("passphrase must not be empty")
+	}
+
+	return passphrase, nil
+}
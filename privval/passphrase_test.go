@@ -0,0 +1,43 @@
+package privval
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/term"
+)
+
+func TestReadPassphrase(t *testing.T) {
+	defer os.Unsetenv(PassphraseEnv)
+	defer os.Unsetenv(PassphraseFDEnv)
+
+	os.Setenv(PassphraseEnv, "from env")
+	passphrase, err := ReadPassphrase("", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("from env"), passphrase)
+
+	// The file descriptor takes precedence over the passphrase in the environment.
+	r, w, err := os.Pipe()
+	assert.NoError(t, err)
+	fmt.Fprint(w, "from fd\r\nignored\n")
+	w.Close()
+	os.Setenv(PassphraseFDEnv, fmt.Sprint(r.Fd()))
+	passphrase, err = ReadPassphrase("", false)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("from fd"), passphrase)
+
+	os.Setenv(PassphraseFDEnv, "invalid")
+	_, err = ReadPassphrase("", false)
+	assert.Error(t, err)
+
+	// Without a terminal, there's nothing to prompt.
+	if term.IsTerminal(int(os.Stdin.Fd())) {
+		t.Skip("stdin is a terminal")
+	}
+	os.Unsetenv(PassphraseFDEnv)
+	os.Unsetenv(PassphraseEnv)
+	_, err = ReadPassphrase("", false)
+	assert.ErrorIs(t, err, ErrNoPassphrase)
+}
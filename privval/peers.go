@@ -0,0 +1,34 @@
+package privval
+
+import (
+	"github.com/BlockscapeNetwork/signctrl/coordination"
+)
+
+// peerStatus returns the status that is shared with the other members of the set. It's
+// called from the gossip goroutines, so it's built from the last published snapshot.
+func (pv *SCFilePV) peerStatus() coordination.Status {
+	snapshot := pv.GetSnapshot()
+	base := pv.base()
+	s := coordination.Status{
+		Rank:           snapshot.Rank,
+		Height:         snapshot.Height,
+		Counter:        snapshot.Counter,
+		Schedule:       base.Schedule(),
+		ActiveSchedule: base.ScheduleAt(snapshot.Height),
+	}
+	if pv.getHandoverHeight() > 0 {
+		s.Intent = coordination.IntentHandover
+	} else if pv.IsDrained(s.Rank) {
+		s.Intent = coordination.IntentDrain
+	}
+
+	return s
+}
+
+// forgetPeers drops the statuses recorded from the other members of the set before a
+// rank update, so they can't block the validator on its new rank.
+func (pv *SCFilePV) forgetPeers() {
+	if pv.Peers != nil {
+		pv.Peers.Forget()
+	}
+}
@@ -0,0 +1,133 @@
+package privval
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/BlockscapeNetwork/signctrl/connection"
+	"github.com/BlockscapeNetwork/signctrl/coordination"
+	"github.com/BlockscapeNetwork/signctrl/metrics"
+	"github.com/BlockscapeNetwork/signctrl/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPeerStatus(t *testing.T) {
+	pv := mockSCFilePV(t)
+	pv.SetCurrentHeight(10)
+	assert.Equal(t, coordination.Status{Rank: 1, Height: 10}, pv.peerStatus())
+
+	_, err := pv.scheduleHandover(11)
+	assert.NoError(t, err)
+	assert.Equal(t, coordination.IntentHandover, pv.peerStatus().Intent)
+
+	pv.cancelHandover()
+	pv.SetRank(2)
+	pv.SetDrainedRanks([]int{2})
+	assert.Equal(t, coordination.IntentDrain, pv.peerStatus().Intent)
+}
+
+// startPeer connects the mock SCFilePV to another member of the set, which reports the
+// given status. It returns a function that stops both ends of the side channel.
+func startPeer(t *testing.T, pv *SCFilePV, status func() coordination.Status) func() {
+	t.Helper()
+	err := connection.CreateBase64ConnKey(config.Dir())
+	assert.NoError(t, err)
+	connKey, err := connection.LoadConnKey(config.Dir())
+	assert.NoError(t, err)
+
+	peerDir := t.TempDir()
+	err = connection.CreateBase64ConnKey(peerDir)
+	assert.NoError(t, err)
+	peerKey, err := connection.LoadConnKey(peerDir)
+	assert.NoError(t, err)
+	port, _ := getFreePort(t)
+	peerPort, _ := getFreePort(t)
+	peer, err := coordination.NewNode(peerDir, config.Peers{
+		ListenAddress: fmt.Sprintf("tcp://127.0.0.1:%v", peerPort),
+		Addresses:     []string{fmt.Sprintf("%v@tcp://127.0.0.1:%v", connection.KeyID(connKey.PubKey()), port)},
+		Interval:      "100ms",
+	}, status, types.NewSyncLogger(ioutil.Discard, "", 0), metrics.Nop())
+	assert.NoError(t, err)
+	assert.NoError(t, peer.Start())
+
+	pv.Config.Peers = config.Peers{
+		ListenAddress: fmt.Sprintf("tcp://127.0.0.1:%v", port),
+		Addresses:     []string{fmt.Sprintf("%v@tcp://127.0.0.1:%v", connection.KeyID(peerKey.PubKey()), peerPort)},
+		Interval:      "100ms",
+	}
+	pv.Peers, err = coordination.NewNode(config.Dir(), pv.Config.Peers, pv.peerStatus, pv.Logger, pv.Metrics)
+	assert.NoError(t, err)
+	assert.NoError(t, pv.Peers.Start())
+	time.Sleep(500 * time.Millisecond)
+
+	return func() {
+		_ = pv.Peers.Stop()
+		_ = peer.Stop()
+	}
+}
+
+func TestHandleSignRequest_PeerConflict(t *testing.T) {
+	// Initialize mock SCFilePV with valid values.
+	pv := mockSCFilePV(t)
+
+	// Start mock endpoint for the block query.
+	quitCh := startSignedBlockEndpoint(t, pv, true)
+	defer close(quitCh)
+
+	// Start another member of the set that claims rank 1 as well.
+	stop := startPeer(t, pv, func() coordination.Status {
+		return coordination.Status{Rank: 1, Height: 2}
+	})
+	defer stop()
+
+	// Handle the request.
+	msg, err := HandleRequest(context.Background(), testSignVoteRequest(t), pv)
+	assert.NotNil(t, msg)
+	assert.ErrorIs(t, err, coordination.ErrRankConflict)
+}
+
+func TestCheckPeerSchedules(t *testing.T) {
+	// Initialize mock SCFilePV with valid values.
+	pv := mockSCFilePV(t)
+	setDrains(t, pv)
+
+	// Start another member of the set with the same drains.
+	stop := startPeer(t, pv, func() coordination.Status {
+		return coordination.Status{Rank: 2, Height: 2, Schedule: pv.Config.Base.Schedule()}
+	})
+	assert.NoError(t, pv.checkPeerSchedules(context.Background()))
+
+	// The other member can't be reached anymore.
+	stop()
+	assert.ErrorIs(t, pv.checkPeerSchedules(context.Background()), ErrScheduleUnconfirmed)
+}
+
+func TestCheckPeerSchedules_Unreachable(t *testing.T) {
+	// Initialize mock SCFilePV with valid values.
+	pv := mockSCFilePV(t)
+
+	// Without set changes and drains, members that can't be reached are skipped.
+	stop := startPeer(t, pv, func() coordination.Status {
+		return coordination.Status{Rank: 2, Height: 2}
+	})
+	stop()
+	assert.NoError(t, pv.checkPeerSchedules(context.Background()))
+}
+
+func TestCheckPeerSchedules_Mismatch(t *testing.T) {
+	// Initialize mock SCFilePV with valid values.
+	pv := mockSCFilePV(t)
+	setDrains(t, pv)
+
+	// Start another member of the set that doesn't drain rank 2.
+	stop := startPeer(t, pv, func() coordination.Status {
+		return coordination.Status{Rank: 2, Height: 2}
+	})
+	defer stop()
+
+	assert.ErrorIs(t, pv.checkPeerSchedules(context.Background()), ErrScheduleMismatch)
+}
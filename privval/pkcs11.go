@@ -0,0 +1,214 @@
+//go:build cgo
+// +build cgo
+
+package privval
+
+import (
+	"bytes"
+	"encoding/asn1"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"sync"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/BlockscapeNetwork/signctrl/types"
+	"github.com/miekg/pkcs11"
+	tm_crypto "github.com/tendermint/tendermint/crypto"
+	tm_ed25519 "github.com/tendermint/tendermint/crypto/ed25519"
+	tm_types "github.com/tendermint/tendermint/types"
+)
+
+const (
+	// The ed25519 key type and signature mechanism of PKCS#11 v3.0, which are missing
+	// in the pkcs11 package.
+	ckkECEdwards = 0x00000040
+	ckmEdDSA     = 0x00001057
+)
+
+func init() {
+	RegisterBackend(BackendPKCS11, newPKCS11Backend)
+}
+
+// newPKCS11Backend opens a session with the HSM specified in the [privval.pkcs11]
+// section of the config.toml and keeps the state in the priv_validator_state.json.
+func newPKCS11Backend(cfgDir string, cfg config.Config, logger *types.SyncLogger) (tm_types.PrivValidator, error) {
+	pin, err := ioutil.ReadFile(cfg.Privval.PKCS11.PINFile)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't read pin_file: %v", err)
+	}
+
+	signer, err := NewPKCS11Signer(cfg.Privval.PKCS11.Module, cfg.Privval.PKCS11.Slot, cfg.Privval.PKCS11.KeyLabel, string(bytes.TrimSpace(pin)))
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Signing with key %q in PKCS#11 slot %v", cfg.Privval.PKCS11.KeyLabel, cfg.Privval.PKCS11.Slot)
+
+	pv, err := newSignerPV(signer, StateFilePath(cfgDir))
+	if err != nil {
+		signer.Close()
+		return nil, err
+	}
+
+	return pv, nil
+}
+
+// PKCS11Signer signs messages with an ed25519 key that is kept in an HSM. It keeps a
+// single session with the HSM, which is used for one signature at a time.
+type PKCS11Signer struct {
+	mtx     sync.Mutex
+	ctx     *pkcs11.Ctx
+	session pkcs11.SessionHandle
+	privKey pkcs11.ObjectHandle
+	pubKey  tm_ed25519.PubKey
+}
+
+// NewPKCS11Signer loads the PKCS#11 module at the given path, logs into the token in
+// the given slot and looks up the ed25519 key pair with the given label.
+func NewPKCS11Signer(module string, slot uint, label, pin string) (*PKCS11Signer, error) {
+	ctx := pkcs11.New(module)
+	if ctx == nil {
+		return nil, fmt.Errorf("couldn't load PKCS#11 module %v", module)
+	}
+	if err := ctx.Initialize(); err != nil && !isPKCS11Error(err, pkcs11.CKR_CRYPTOKI_ALREADY_INITIALIZED) {
+		ctx.Destroy()
+		return nil, fmt.Errorf("couldn't initialize PKCS#11 module: %v", err)
+	}
+
+	s := &PKCS11Signer{ctx: ctx}
+	if err := s.open(slot, label, pin); err != nil {
+		s.Close()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// open opens the session and looks up the key pair.
+func (s *PKCS11Signer) open(slot uint, label, pin string) error {
+	var err error
+	if s.session, err = s.ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION); err != nil {
+		return fmt.Errorf("couldn't open session with slot %v: %v", slot, err)
+	}
+	if err := s.ctx.Login(s.session, pkcs11.CKU_USER, pin); err != nil && !isPKCS11Error(err, pkcs11.CKR_USER_ALREADY_LOGGED_IN) {
+		return fmt.Errorf("couldn't log into slot %v: %v", slot, err)
+	}
+
+	if s.privKey, err = s.findKey(pkcs11.CKO_PRIVATE_KEY, label); err != nil {
+		return err
+	}
+	pubKey, err := s.findKey(pkcs11.CKO_PUBLIC_KEY, label)
+	if err != nil {
+		return err
+	}
+	attrs, err := s.ctx.GetAttributeValue(s.session, pubKey, []*pkcs11.Attribute{pkcs11.NewAttribute(pkcs11.CKA_EC_POINT, nil)})
+	if err != nil {
+		return fmt.Errorf("couldn't get public key %q: %v", label, err)
+	}
+	if s.pubKey, err = decodeECPoint(attrs[0].Value); err != nil {
+		return fmt.Errorf("couldn't decode public key %q: %v", label, err)
+	}
+
+	// Make sure the private key matches the public key, so the validator doesn't sign
+	// with a key that isn't its own.
+	msg := []byte("signctrl")
+	sig, err := s.Sign(msg)
+	if err != nil {
+		return err
+	}
+	if !s.pubKey.VerifySignature(msg, sig) {
+		return fmt.Errorf("private key %q doesn't match its public key", label)
+	}
+
+	return nil
+}
+
+// findKey returns the handle of the ed25519 key with the given class and label.
+func (s *PKCS11Signer) findKey(class uint, label string) (pkcs11.ObjectHandle, error) {
+	template := []*pkcs11.Attribute{
+		pkcs11.NewAttribute(pkcs11.CKA_CLASS, class),
+		pkcs11.NewAttribute(pkcs11.CKA_KEY_TYPE, ckkECEdwards),
+		pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+	}
+	if err := s.ctx.FindObjectsInit(s.session, template); err != nil {
+		return 0, err
+	}
+	objs, _, err := s.ctx.FindObjects(s.session, 2)
+	if finalErr := s.ctx.FindObjectsFinal(s.session); err == nil {
+		err = finalErr
+	}
+	if err != nil {
+		return 0, fmt.Errorf("couldn't find key %q: %v", label, err)
+	}
+
+	switch len(objs) {
+	case 0:
+		return 0, fmt.Errorf("no ed25519 key with label %q found", label)
+	case 1:
+		return objs[0], nil
+	default:
+		return 0, fmt.Errorf("multiple ed25519 keys with label %q found", label)
+	}
+}
+
+// decodeECPoint decodes an ed25519 public key from the value of a CKA_EC_POINT
+// attribute, which is either a DER-encoded octet string or the raw key.
+func decodeECPoint(point []byte) (tm_ed25519.PubKey, error) {
+	if len(point) != tm_ed25519.PubKeySize {
+		var raw []byte
+		if rest, err := asn1.Unmarshal(point, &raw); err != nil || len(rest) > 0 {
+			return nil, errors.New("invalid EC point")
+		}
+		point = raw
+	}
+	if len(point) != tm_ed25519.PubKeySize {
+		return nil, fmt.Errorf("invalid ed25519 public key size %v", len(point))
+	}
+
+	return tm_ed25519.PubKey(point), nil
+}
+
+// isPKCS11Error checks whether the given error is the given PKCS#11 return value.
+func isPKCS11Error(err error, rv uint) bool {
+	var e pkcs11.Error
+	return errors.As(err, &e) && uint(e) == rv
+}
+
+// PubKey returns the public key of the key pair.
+// Implements the Signer interface.
+func (s *PKCS11Signer) PubKey() tm_crypto.PubKey {
+	return s.pubKey
+}
+
+// Sign signs the given message with the private key in the HSM.
+// Implements the Signer interface.
+func (s *PKCS11Signer) Sign(msg []byte) ([]byte, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if err := s.ctx.SignInit(s.session, []*pkcs11.Mechanism{pkcs11.NewMechanism(ckmEdDSA, nil)}, s.privKey); err != nil {
+		return nil, fmt.Errorf("couldn't initialize PKCS#11 signature: %v", err)
+	}
+	sig, err := s.ctx.Sign(s.session, msg)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create PKCS#11 signature: %v", err)
+	}
+
+	return sig, nil
+}
+
+// Close closes the session and unloads the PKCS#11 module.
+// Implements the io.Closer interface.
+func (s *PKCS11Signer) Close() error {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	if s.session != 0 {
+		s.ctx.Logout(s.session)
+		s.ctx.CloseSession(s.session)
+	}
+	s.ctx.Finalize()
+	s.ctx.Destroy()
+
+	return nil
+}
@@ -0,0 +1,27 @@
+//go:build !cgo
+// +build !cgo
+
+package privval
+
+import (
+	"errors"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/BlockscapeNetwork/signctrl/types"
+	tm_types "github.com/tendermint/tendermint/types"
+)
+
+var (
+	// ErrNoCgo is returned by the pkcs11 signing backend if SignCTRL was built without
+	// cgo, which the PKCS#11 module needs to be loaded.
+	ErrNoCgo = errors.New("signing backend \"pkcs11\" is unavailable, as SignCTRL was built without cgo (build it with CGO_ENABLED=1)")
+)
+
+func init() {
+	RegisterBackend(BackendPKCS11, newPKCS11Backend)
+}
+
+// newPKCS11Backend fails, as the PKCS#11 module can't be loaded without cgo.
+func newPKCS11Backend(cfgDir string, cfg config.Config, logger *types.SyncLogger) (tm_types.PrivValidator, error) {
+	return nil, ErrNoCgo
+}
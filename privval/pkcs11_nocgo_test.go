@@ -0,0 +1,17 @@
+//go:build !cgo
+// +build !cgo
+
+package privval
+
+import (
+	"testing"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewBackend_PKCS11WithoutCgo(t *testing.T) {
+	cfg := config.Config{Privval: config.PrivValidator{Backend: BackendPKCS11}}
+	_, err := NewBackend(t.TempDir(), cfg, nil)
+	assert.ErrorIs(t, err, ErrNoCgo)
+}
@@ -0,0 +1,131 @@
+//go:build cgo
+// +build cgo
+
+package privval
+
+import (
+	"encoding/asn1"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/BlockscapeNetwork/signctrl/types"
+	"github.com/miekg/pkcs11"
+	"github.com/stretchr/testify/assert"
+	tm_ed25519 "github.com/tendermint/tendermint/crypto/ed25519"
+	tm_types "github.com/tendermint/tendermint/types"
+)
+
+// ckmECEdwardsKeyPairGen is the ed25519 key pair generation mechanism of PKCS#11 v3.0.
+const ckmECEdwardsKeyPairGen = 0x00001055
+
+// The PKCS#11 tests run against a token that is set up with SoftHSM, e.g.:
+//
+//	softhsm2-util --init-token --free --label signctrl --so-pin 1234 --pin 1234
+//	export SIGNCTRL_TEST_PKCS11_MODULE=/usr/lib/softhsm/libsofthsm2.so
+//	export SIGNCTRL_TEST_PKCS11_SLOT=<slot printed by softhsm2-util>
+//	export SIGNCTRL_TEST_PKCS11_PIN=1234
+//
+// They are skipped if the environment variables aren't set.
+func testPKCS11Token(t *testing.T) (string, uint, string) {
+	t.Helper()
+	module := os.Getenv("SIGNCTRL_TEST_PKCS11_MODULE")
+	if module == "" {
+		t.Skip("SIGNCTRL_TEST_PKCS11_MODULE not set")
+	}
+	slot, err := strconv.ParseUint(os.Getenv("SIGNCTRL_TEST_PKCS11_SLOT"), 10, 64)
+	if err != nil {
+		t.Fatalf("invalid SIGNCTRL_TEST_PKCS11_SLOT: %v", err)
+	}
+
+	return module, uint(slot), os.Getenv("SIGNCTRL_TEST_PKCS11_PIN")
+}
+
+// genPKCS11Key generates an ed25519 key pair with the given label on the token.
+func genPKCS11Key(t *testing.T, module string, slot uint, pin, label string) {
+	t.Helper()
+	ctx := pkcs11.New(module)
+	assert.NotNil(t, ctx)
+	defer ctx.Destroy()
+	ctx.Initialize()
+	defer ctx.Finalize()
+
+	session, err := ctx.OpenSession(slot, pkcs11.CKF_SERIAL_SESSION|pkcs11.CKF_RW_SESSION)
+	assert.NoError(t, err)
+	defer ctx.CloseSession(session)
+	assert.NoError(t, ctx.Login(session, pkcs11.CKU_USER, pin))
+	defer ctx.Logout(session)
+
+	// The curve is identified by the DER-encoded OID of ed25519.
+	params, _ := asn1.Marshal(asn1.ObjectIdentifier{1, 3, 101, 112})
+	_, _, err = ctx.GenerateKeyPair(session,
+		[]*pkcs11.Mechanism{pkcs11.NewMechanism(ckmECEdwardsKeyPairGen, nil)},
+		[]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_VERIFY, true),
+			pkcs11.NewAttribute(pkcs11.CKA_EC_PARAMS, params),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		},
+		[]*pkcs11.Attribute{
+			pkcs11.NewAttribute(pkcs11.CKA_TOKEN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_SIGN, true),
+			pkcs11.NewAttribute(pkcs11.CKA_SENSITIVE, true),
+			pkcs11.NewAttribute(pkcs11.CKA_EXTRACTABLE, false),
+			pkcs11.NewAttribute(pkcs11.CKA_LABEL, label),
+		},
+	)
+	assert.NoError(t, err)
+}
+
+func TestDecodeECPoint(t *testing.T) {
+	key := tm_ed25519.GenPrivKey().PubKey().Bytes()
+	der, _ := asn1.Marshal(key)
+
+	pub, err := decodeECPoint(der)
+	assert.NoError(t, err)
+	assert.Equal(t, key, pub.Bytes())
+
+	pub, err = decodeECPoint(key)
+	assert.NoError(t, err)
+	assert.Equal(t, key, pub.Bytes())
+
+	_, err = decodeECPoint([]byte{0x04, 0x02, 0x01, 0x02})
+	assert.Error(t, err)
+	_, err = decodeECPoint([]byte("invalid"))
+	assert.Error(t, err)
+}
+
+func TestPKCS11Backend(t *testing.T) {
+	module, slot, pin := testPKCS11Token(t)
+	label := fmt.Sprintf("signctrl-test-%v", tm_ed25519.GenPrivKey().PubKey().Address())
+	genPKCS11Key(t, module, slot, pin, label)
+
+	dir := t.TempDir()
+	pinFile := filepath.Join(dir, "pin")
+	assert.NoError(t, ioutil.WriteFile(pinFile, []byte(pin+"\n"), 0600))
+
+	cfg := testConfig(t)
+	cfg.Privval.Backend = BackendPKCS11
+	cfg.Privval.PKCS11.Module = module
+	cfg.Privval.PKCS11.Slot = slot
+	cfg.Privval.PKCS11.KeyLabel = label
+	cfg.Privval.PKCS11.PINFile = pinFile
+	backend, err := NewBackend(dir, cfg, types.NewSyncLogger(ioutil.Discard, "", 0))
+	assert.NoError(t, err)
+	defer backend.(*signerPV).Close()
+
+	pub, err := backend.GetPubKey()
+	assert.NoError(t, err)
+	vote := testVote(t)
+	assert.NoError(t, backend.SignVote("testchain", vote))
+	assert.True(t, pub.VerifySignature(tm_types.VoteSignBytes("testchain", vote), vote.Signature))
+	assert.FileExists(t, StateFilePath(dir))
+
+	// A wrong label is rejected.
+	cfg.Privval.PKCS11.KeyLabel = "unknown"
+	_, err = NewBackend(dir, cfg, types.NewSyncLogger(ioutil.Discard, "", 0))
+	assert.Error(t, err)
+}
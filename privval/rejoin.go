@@ -0,0 +1,46 @@
+package privval
+
+import (
+	"errors"
+
+	"github.com/BlockscapeNetwork/signctrl/types"
+)
+
+// rejoin brings the validator back into the set on the last rank after a
+// self-induced shutdown due to the given error, which is either types.ErrMustShutdown,
+// ErrRankObsolete or ErrReplayTooLong. The first two mean that a rank update in the set
+// has moved the validator to the end of the set, while the last one means that the
+// validator can't tell, so the end of the set is the only safe rank.
+func (pv *SCFilePV) rejoin(reqHeight int64, cause error) error {
+	if !errors.Is(cause, types.ErrMustShutdown) && !errors.Is(cause, ErrRankObsolete) && !errors.Is(cause, ErrReplayTooLong) {
+		return cause
+	}
+
+	pv.Logger.Info("Rejoining the set...")
+	return pv.demote(reqHeight)
+}
+
+// demote moves the validator to the last rank of the set, skipping drained ranks, from
+// the given height on and persists it. The counter for missed blocks stays locked until
+// the first commitsig shows up again.
+func (pv *SCFilePV) demote(reqHeight int64) error {
+	rank := pv.setSize()
+	for rank > 1 && pv.IsDrained(rank) {
+		rank--
+	}
+	pv.Logger.Info("Moving to rank %v at the end of the set at block height %v", rank, reqHeight)
+
+	// Start over on the new rank and wait for the first commitsig before counting
+	// missed blocks in a row again.
+	pv.cancelHandover()
+	pv.SetRank(rank)
+	pv.Reset()
+	pv.LockCounter()
+	pv.SetCurrentHeight(reqHeight)
+	pv.forgetPeers()
+	pv.State.LastHeight = reqHeight
+	pv.Gauges.RankGauge.Set(float64(rank))
+	pv.Gauges.MissedInARowGauge.Set(0)
+
+	return pv.saveState()
+}
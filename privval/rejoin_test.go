@@ -0,0 +1,62 @@
+package privval
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/BlockscapeNetwork/signctrl/types"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRejoin(t *testing.T) {
+	pv := mockSCFilePV(t)
+	pv.Config.Base.SetSize = 3
+	pv.UnlockCounter()
+
+	// Rank 1 triggered the rank update itself.
+	err := pv.rejoin(5, types.ErrMustShutdown)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, pv.GetRank())
+	assert.Equal(t, int64(5), pv.State.LastHeight)
+	assert.Equal(t, int64(5), pv.GetCurrentHeight())
+	assert.Equal(t, 3, pv.State.LastRank)
+
+	// A rank update moved the validator to the end of the set while it was offline.
+	pv.SetRank(2)
+	err = pv.rejoin(40, ErrRankObsolete)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, pv.GetRank())
+	assert.Equal(t, int64(40), pv.State.LastHeight)
+
+	// Other errors aren't recovered from.
+	err = pv.rejoin(50, errors.New("other"))
+	assert.Error(t, err)
+	assert.Equal(t, int64(40), pv.State.LastHeight)
+}
+
+func TestDemote_Restart(t *testing.T) {
+	pv := mockSCFilePV(t)
+	pv.Config.Base.SetSize = 3
+	pv.State.LastSigned.Height = 20
+
+	// Rank 1's commitsigs for heights 11 to 20 never made it on chain, so it shut itself
+	// down at height 22, while the new rank 1 signs from height 21 on.
+	quitCh := startChainEndpoint(t, pv, func(height int64) bool { return height <= 10 || height >= 21 })
+	defer close(quitCh)
+	assert.NoError(t, pv.demote(22))
+	assert.NoError(t, pv.fence())
+
+	// After a restart, it resumes at the end of the set rather than on rank 1.
+	state, err := config.LoadOrGenState(config.Dir(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, state.LastRank)
+	restarted := NewSCFilePV(pv.Logger, pv.Config, state, pv.TMFilePV, pv.HTTP)
+	restarted.RPC = pv.RPC
+	restarted.Verifier = pv.Verifier
+	err = restarted.catchUp(context.Background(), 40)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, restarted.GetRank())
+	assert.ErrorIs(t, restarted.checkFence(), ErrFenced)
+}
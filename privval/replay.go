@@ -0,0 +1,226 @@
+package privval
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/BlockscapeNetwork/signctrl/types"
+)
+
+const (
+	// maxReplayHeights is the maximum number of heights SignCTRL replays in order to
+	// catch up with the rank updates in the set.
+	maxReplayHeights = 10000
+)
+
+var (
+	// ErrReplayTooLong is returned if there are too many heights between the last
+	// height and the requested height to replay them.
+	ErrReplayTooLong = errors.New("too many heights since last_height to replay them")
+)
+
+// replayer replays the commitsigs of past blocks with the same logic the validator
+// uses on incoming sign requests.
+type replayer struct {
+	types.BaseSignCtrled
+}
+
+// replayResult defines the validator's state after a replay.
+type replayResult struct {
+	rank            int
+	policy          types.RankPolicy
+	drained         []int
+	setChangeHeight int64
+	drainHeight     int64
+	height          int64
+	updates         int
+	obsolete        bool
+}
+
+// replay replays the commitsigs of the blocks between the given heights, starting from
+// the validator's current rank and the blocks recorded by its rank policy. Blocks are
+// checked the same way handleSignRequest checks them, so the commitsigs for a request
+// at height h are looked up in block h-1. Blocks that fail verification count neither
+// as missed nor as signed. The replay assumes the counter for missed blocks in a row is
+// unlocked, just like it is for the other validators in the set. While the replay is on
+// rank 1, a commitsig of the validator that this node didn't sign proves that another
+// node in the set is rank 1, so the validator's rank is obsolete.
+func replay(ctx context.Context, from, to int64, pv *SCFilePV) (replayResult, error) {
+	r := &replayer{}
+	r.BaseSignCtrled = *types.NewBaseSignCtrled(nil, pv.GetThreshold(), pv.GetRank(), r)
+	r.SetDrainedRanks(pv.GetDrainedRanks())
+	r.UnlockCounter()
+	r.SetRankPolicy(pv.GetRankPolicy().Clone())
+	r.SetCurrentHeight(from - 1)
+
+	var updates int
+	applied, drained := pv.State.SetChangeHeight, pv.State.DrainHeight
+	for height := from; height <= to; height++ {
+		// Set changes and drains activate at their height, even if it's skipped.
+		var err error
+		if applied, err = applySetChanges(&r.BaseSignCtrled, pv.Config.Base, applied, height); err != nil {
+			return replayResult{}, err
+		}
+		drained = applyDrains(&r.BaseSignCtrled, pv.Config.Base, drained, height)
+
+		// Heights are skipped after a rank update, just like on sign requests.
+		if height <= 1 || height <= r.GetCurrentHeight() {
+			continue
+		}
+		r.SetCurrentHeight(height)
+
+		signed, block, err := isCommitSigned(ctx, height-1, pv)
+		if err != nil {
+			if errors.Is(err, ErrUnverifiedBlock) {
+				pv.Metrics.UnverifiedBlocks.Inc()
+				pv.Logger.Warn("Skipping block height %v during replay: %v\n", height-1, err)
+				continue
+			}
+			return replayResult{}, err
+		}
+		if signed {
+			// Block h-1 carries the commitsigs for height h-2.
+			if r.GetRank() == 1 && pv.State.LastSigned.Height > 0 && pv.State.LastSigned.Height < height-2 {
+				pv.Logger.Info("The validator's commitsig for block height %v wasn't signed by this node, another node in the set is rank 1", height-2)
+				return replayResult{height: height, updates: updates, obsolete: true}, nil
+			}
+			r.Signed(block)
+			continue
+		}
+
+		switch err := r.Missed(block); err {
+		case types.ErrThresholdExceeded:
+			updates++
+		case types.ErrMustShutdown:
+			// The validator was on rank 1 and has been moved to the end of the set.
+			return replayResult{height: height, updates: updates + 1, obsolete: true}, nil
+		}
+	}
+
+	return replayResult{
+		rank:            r.GetRank(),
+		policy:          r.GetRankPolicy(),
+		drained:         r.GetDrainedRanks(),
+		setChangeHeight: applied,
+		drainHeight:     drained,
+		height:          r.GetCurrentHeight(),
+		updates:         updates,
+	}, nil
+}
+
+// catchUp replays the heights between the last height and the given height, so the
+// validator resumes on the rank it would have if it had never been offline. It returns
+// ErrRankObsolete if the validator has been moved to the end of the set in the meantime.
+func (pv *SCFilePV) catchUp(ctx context.Context, to int64) error {
+	// A fresh state has no history to replay, so the validator starts on start_rank
+	// from the given height on.
+	if pv.freshState {
+		pv.Logger.Info("No rank persisted in %v, starting on start_rank at block height %v", config.StateFile, to)
+		pv.freshState = false
+		pv.State.LastHeight = to
+		pv.skipSetChanges(to)
+		pv.skipDrains(to)
+		return pv.saveState()
+	}
+
+	from := pv.State.LastHeight + 1
+	if to-from+1 > maxReplayHeights {
+		return fmt.Errorf("%w (%v heights, max %v)", ErrReplayTooLong, to-from+1, maxReplayHeights)
+	}
+
+	pv.Logger.Info("Replaying block heights %v to %v to catch up with the set...", from, to)
+	res, err := replay(ctx, from, to, pv)
+	if err != nil {
+		return err
+	}
+	if res.obsolete {
+		return ErrRankObsolete
+	}
+	if res.updates > 0 {
+		pv.Logger.Info("Caught up with %v rank update(s) in the set (%v -> %v)", res.updates, pv.GetRank(), res.rank)
+		pv.forgetPeers()
+	}
+
+	pv.SetRank(res.rank)
+	pv.SetRankPolicy(res.policy)
+	pv.SetDrainedRanks(res.drained)
+	pv.State.SetChangeHeight = res.setChangeHeight
+	pv.State.DrainHeight = res.drainHeight
+	pv.SetCurrentHeight(res.height)
+	pv.State.LastHeight = to
+	pv.Gauges.RankGauge.Set(float64(res.rank))
+	pv.Gauges.MissedInARowGauge.Set(float64(res.policy.Count()))
+
+	return pv.saveState()
+}
+
+// seedRankPolicy rebuilds the rank policy from the blocks within its window that
+// precede the given height, before the validator starts counting missed blocks. Every
+// rank is seeded, as a freshly (re)started validator would otherwise only count the
+// missed blocks it has seen itself and update its rank later than the rest of the set,
+// no matter if it's rank 1 stepping down or a backup getting promoted. The policy is
+// rebuilt from scratch, so blocks that have already been replayed aren't counted twice,
+// and it starts over wherever the missed blocks triggered a rank update in the set, just
+// like the policies of the validators that were online. The default policy doesn't need
+// seeding, as the signed block at the given height resets its counter anyway.
+func (pv *SCFilePV) seedRankPolicy(ctx context.Context, height int64) {
+	if pv.Config.Base.RankPolicy != types.PolicyWindow {
+		return
+	}
+
+	from := height - int64(pv.Config.Base.Window) + 1
+	if from < 2 {
+		from = 2
+	}
+	pv.Logger.Info("Seeding rank policy with block heights %v to %v...", from, height-1)
+	policy := pv.Config.Base.NewRankPolicy()
+	defer pv.SetRankPolicy(policy)
+	for h := from; h < height; h++ {
+		signed, block, err := isCommitSigned(ctx, h, pv)
+		if err != nil {
+			pv.Logger.Warn("Skipping block height %v while seeding rank policy: %v\n", h, err)
+			continue
+		}
+		if signed {
+			policy.Signed(block)
+		} else if policy.Missed(block) {
+			policy.Reset()
+		}
+	}
+}
+
+// catchUpOnStart catches up with the rank updates in the set up to the latest block
+// height before the validator connects. If the latest height can't be determined or
+// the blocks can't be queried, catching up is left to the first sign request.
+func (pv *SCFilePV) catchUpOnStart(ctx context.Context) error {
+	latest, err := pv.RPC.LatestHeight(ctx)
+	if err != nil {
+		pv.Logger.Warn("Couldn't get the latest block height, catching up on the first sign request: %v\n", err)
+		return nil
+	}
+	if latest <= pv.State.LastHeight {
+		return nil
+	}
+
+	err = pv.catchUp(ctx, latest)
+	switch {
+	case err == nil:
+		return nil
+
+	case errors.Is(err, types.ErrRemovedFromSet):
+		return err
+
+	case errors.Is(err, ErrRankObsolete), errors.Is(err, ErrReplayTooLong):
+		// Rejoin the set instead of shutting down, if enabled.
+		if pv.Config.Base.Rejoin {
+			return pv.rejoin(latest, err)
+		}
+		return err
+
+	default:
+		pv.Logger.Warn("Couldn't replay block heights, catching up on the first sign request: %v\n", err)
+		return nil
+	}
+}
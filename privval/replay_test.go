@@ -0,0 +1,163 @@
+package privval
+
+import (
+	"context"
+	"testing"
+
+	"github.com/BlockscapeNetwork/signctrl/types"
+	"github.com/stretchr/testify/assert"
+	tm_types "github.com/tendermint/tendermint/types"
+)
+
+// startSignedBlockEndpoint starts a mock block endpoint whose blocks either contain
+// the validator's commitsig or not.
+func startSignedBlockEndpoint(t *testing.T, pv *SCFilePV, signed bool) chan struct{} {
+	t.Helper()
+	br := testBlockResult(t)
+	if signed {
+		pub, _ := pv.TMFilePV.GetPubKey()
+		br.Result.Block.LastCommit.Signatures = []tm_types.CommitSig{{ValidatorAddress: pub.Address()}}
+	}
+
+	port, _ := getFreePort(t)
+	setRPCAddress(t, pv, port)
+	quitCh := make(chan struct{})
+	testBlockEndpoint(t, port, br, quitCh)
+
+	return quitCh
+}
+
+func TestReplay(t *testing.T) {
+	pv := mockSCFilePV(t)
+	pv.SetRank(3)
+	quitCh := startSignedBlockEndpoint(t, pv, false)
+	defer close(quitCh)
+
+	// With a threshold of 10, heights 2 to 11 trigger the first rank update, height 12
+	// is skipped and heights 13 to 22 trigger the second one.
+	res, err := replay(context.Background(), 1, 23, pv)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, res.rank)
+	assert.Equal(t, 2, res.updates)
+	assert.Equal(t, 0, res.policy.Count())
+	assert.Equal(t, int64(23), res.height)
+	assert.False(t, res.obsolete)
+
+	res, err = replay(context.Background(), 1, 10, pv)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, res.rank)
+	assert.Equal(t, 9, res.policy.Count())
+	assert.Equal(t, int64(10), res.height)
+
+	// Rank 2 is promoted to rank 1 and then misses another {threshold} blocks itself.
+	pv.SetRank(2)
+	res, err = replay(context.Background(), 1, 40, pv)
+	assert.NoError(t, err)
+	assert.True(t, res.obsolete)
+	assert.Equal(t, 2, res.updates)
+}
+
+func TestReplay_Signed(t *testing.T) {
+	pv := mockSCFilePV(t)
+	pv.SetRank(2)
+	quitCh := startSignedBlockEndpoint(t, pv, true)
+	defer close(quitCh)
+
+	res, err := replay(context.Background(), 1, 23, pv)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, res.rank)
+	assert.Equal(t, 0, res.updates)
+	assert.Equal(t, 0, res.policy.Count())
+}
+
+func TestCatchUp(t *testing.T) {
+	pv := mockSCFilePV(t)
+	pv.SetRank(2)
+	quitCh := startSignedBlockEndpoint(t, pv, false)
+	defer close(quitCh)
+
+	// Heights 2 to 11 promote the validator, height 12 is skipped and heights 13 to 15
+	// are missed.
+	err := pv.catchUp(context.Background(), 15)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pv.GetRank())
+	assert.Equal(t, 3, pv.GetMissedInARow())
+	assert.Equal(t, int64(15), pv.GetCurrentHeight())
+	assert.Equal(t, int64(15), pv.State.LastHeight)
+	assert.Equal(t, 1, pv.State.LastRank)
+
+	// Rank 1 missed another {threshold} blocks in a row.
+	err = pv.catchUp(context.Background(), 30)
+	assert.ErrorIs(t, err, ErrRankObsolete)
+	assert.Equal(t, int64(15), pv.State.LastHeight)
+
+	err = pv.catchUp(context.Background(), maxReplayHeights+20)
+	assert.ErrorIs(t, err, ErrReplayTooLong)
+}
+
+func TestCatchUp_ForeignCommitsig(t *testing.T) {
+	pv := mockSCFilePV(t)
+	pv.State.LastHeight = 20
+	pv.State.LastSigned.Height = 20
+
+	// Another node signs as rank 1 from height 21 on, so the replay never sees a
+	// missed block.
+	quitCh := startChainEndpoint(t, pv, func(height int64) bool { return true })
+	defer close(quitCh)
+
+	err := pv.catchUp(context.Background(), 40)
+	assert.ErrorIs(t, err, ErrRankObsolete)
+	assert.Equal(t, 1, pv.GetRank())
+
+	// Backups don't sign, so the commitsigs are expected.
+	pv.SetRank(2)
+	err = pv.catchUp(context.Background(), 40)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, pv.GetRank())
+}
+
+func TestCatchUp_FreshState(t *testing.T) {
+	pv := mockSCFilePV(t)
+	pv.SetRank(2)
+	pv.freshState = true
+
+	// Without a persisted rank, nothing is replayed, no matter how far the chain is.
+	err := pv.catchUp(context.Background(), maxReplayHeights+20)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, pv.GetRank())
+	assert.Equal(t, int64(maxReplayHeights+20), pv.State.LastHeight)
+	assert.False(t, pv.freshState)
+}
+
+func TestSeedRankPolicy(t *testing.T) {
+	pv := mockSCFilePV(t)
+	quitCh := startSignedBlockEndpoint(t, pv, false)
+	defer close(quitCh)
+
+	// The default policy isn't seeded.
+	pv.seedRankPolicy(context.Background(), 20)
+	assert.Equal(t, 0, pv.GetMissedInARow())
+
+	// Rank 1 records the 4 blocks preceding height 20 within the window of 5 blocks.
+	pv.Config.Base.RankPolicy = types.PolicyWindow
+	pv.Config.Base.Window = 5
+	pv.SetRankPolicy(pv.Config.Base.NewRankPolicy())
+	pv.seedRankPolicy(context.Background(), 20)
+	assert.Equal(t, 4, pv.GetMissedInARow())
+
+	// Seeding again doesn't count the blocks twice.
+	pv.seedRankPolicy(context.Background(), 20)
+	assert.Equal(t, 4, pv.GetMissedInARow())
+
+	// Backups are seeded as well.
+	pv.SetRank(2)
+	pv.Reset()
+	pv.seedRankPolicy(context.Background(), 20)
+	assert.Equal(t, 4, pv.GetMissedInARow())
+
+	// The policy starts over where the missed blocks triggered a rank update.
+	pv.Config.Base.Threshold = 3
+	pv.SetRankPolicy(pv.Config.Base.NewRankPolicy())
+	pv.seedRankPolicy(context.Background(), 20)
+	assert.Equal(t, 1, pv.GetMissedInARow())
+}
@@ -5,21 +5,28 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 
-	"github.com/BlockscapeNetwork/signctrl/rpc"
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/BlockscapeNetwork/signctrl/metrics"
 	"github.com/BlockscapeNetwork/signctrl/types"
 	"github.com/gogo/protobuf/proto"
 	tm_cryptoenc "github.com/tendermint/tendermint/crypto/encoding"
 	tm_cryptoproto "github.com/tendermint/tendermint/proto/tendermint/crypto"
 	tm_privvalproto "github.com/tendermint/tendermint/proto/tendermint/privval"
 	tm_typesproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tm_coretypes "github.com/tendermint/tendermint/rpc/core/types"
 	tm_types "github.com/tendermint/tendermint/types"
 )
 
 var (
-	// ErrRankObsolete is returned if the requested vote height is too far ahead of the last
-	// block the validator signed. The gap must be at least {threshold} blocks.
-	ErrRankObsolete = errors.New("at least one threshold was exceeded between requested vote height and last_signed_height")
+	// ErrRankObsolete is returned if a rank update in the set has moved the validator
+	// to the end of the set between last_height and the requested height.
+	ErrRankObsolete = errors.New("the validator was moved to the end of the set between last_height and the requested height")
+
+	// ErrUnverifiedBlock is returned if a block lacking the validator's commitsig
+	// couldn't be verified by the light client, or if the RPC servers disagree on it.
+	ErrUnverifiedBlock = errors.New("block lacking the validator's commitsig couldn't be verified")
 )
 
 // wrapMsg wraps a protobuf message into a privval proto message.
@@ -63,9 +70,74 @@ func hasSignedCommit(valaddr tm_types.Address, commitsigs *[]tm_types.CommitSig)
 	return false
 }
 
-// isRankUpToDate checks whether the validator's rank is still up to date or obsolete.
-func isRankUpToDate(reqHeight int64, lastHeight int64, threshold int) bool {
-	return reqHeight-lastHeight < int64(threshold+1)
+// verifyBlock verifies the block with the light client before it may be counted as
+// missed.
+func verifyBlock(ctx context.Context, rb *tm_coretypes.ResultBlock, pv *SCFilePV) error {
+	if pv.Verifier == nil {
+		return fmt.Errorf("%w: no light client verifier", ErrUnverifiedBlock)
+	}
+	if err := pv.Verifier.Verify(ctx, rb); err != nil {
+		return fmt.Errorf("%w: %v", ErrUnverifiedBlock, err)
+	}
+
+	return nil
+}
+
+// isCommitSigned checks whether the validator's commitsig is in the last commit of the
+// block at the given height, and returns the block's height and time for the rank
+// policy. A missing commitsig only counts if the block is verified by the light client.
+// If a quorum of RPC servers is configured, the commitsig is only considered missing if
+// at least {rpc_quorum} RPC servers agree on it, and a disputed commitsig is treated
+// like an unverified block.
+func isCommitSigned(ctx context.Context, height int64, pv *SCFilePV) (bool, types.Block, error) {
+	pub, _ := pv.TMFilePV.GetPubKey()
+
+	// Get block information from the RPC client's cache, or the RPC servers' /block
+	// endpoint if it's not cached.
+	rb, err := pv.RPC.Block(ctx, height)
+	if err != nil {
+		return false, types.Block{}, err
+	}
+	block := types.Block{Height: height, Time: rb.Block.Header.Time}
+	if hasSignedCommit(pub.Address(), &rb.Block.LastCommit.Signatures) {
+		return true, block, nil
+	}
+	if pv.Config.Base.RPCQuorum <= 1 {
+		return false, block, verifyBlock(ctx, rb, pv)
+	}
+
+	// Ask all RPC servers before counting the block as missed.
+	rbs, err := pv.RPC.QueryBlocks(ctx, height)
+	if err != nil {
+		return false, types.Block{}, err
+	}
+	if len(rbs) < pv.Config.Base.RPCQuorum {
+		return false, types.Block{}, fmt.Errorf("only %v of %v RPC servers required for a quorum responded", len(rbs), pv.Config.Base.RPCQuorum)
+	}
+	var misses int
+	var verifyErr error
+	for _, rb := range rbs {
+		if hasSignedCommit(pub.Address(), &rb.Block.LastCommit.Signatures) {
+			continue
+		}
+		if err := verifyBlock(ctx, rb, pv); err != nil {
+			verifyErr = err
+			continue
+		}
+		// Only take the time of a verified block.
+		block.Time = rb.Block.Header.Time
+		misses++
+	}
+	if misses < pv.Config.Base.RPCQuorum {
+		if verifyErr != nil {
+			return false, block, verifyErr
+		}
+		// A disputed commitsig is neither counted as missed nor as signed, so it
+		// can't reset the streak of missed blocks or unlock the counter either.
+		return false, block, fmt.Errorf("%w: only %v of %v RPC servers required for a quorum report a missing commitsig", ErrUnverifiedBlock, misses, pv.Config.Base.RPCQuorum)
+	}
+
+	return false, block, nil
 }
 
 // handlePingRequest handles a PingRequest by returning a
@@ -153,9 +225,27 @@ func buildResponse(msg *tm_privvalproto.Message, rse *tm_privvalproto.RemoteSign
 	return nil
 }
 
+// refuseSignRequest counts the refused sign request for the given reason and builds
+// an error response for it.
+func refuseSignRequest(msg *tm_privvalproto.Message, reason string, err error, pv *SCFilePV) (*tm_privvalproto.Message, error) {
+	pv.Metrics.RefusedSignRequests.WithLabelValues(reason).Inc()
+	return buildResponse(msg, &tm_privvalproto.RemoteSignerError{Description: err.Error()}), err
+}
+
+// signErrReason returns the reason for refusing a sign request due to the given
+// signing error.
+func signErrReason(err error) string {
+	if errors.Is(err, ErrDoubleSign) {
+		return metrics.ReasonDoubleSign
+	}
+
+	return metrics.ReasonSignFailed
+}
+
 // handleSignRequest handles SignVoteRequests and SignProposalRequests by
 // returning either a SignedVoteResponse or a SignedProposalResponse.
 func handleSignRequest(ctx context.Context, msg *tm_privvalproto.Message, pv *SCFilePV) (*tm_privvalproto.Message, error) {
+	start := time.Now()
 	switch msg.Sum.(type) {
 	case *tm_privvalproto.Message_SignVoteRequest:
 		pv.Logger.Debug("Received SignVoteRequest: %v", msg.GetSignVoteRequest())
@@ -169,43 +259,84 @@ func handleSignRequest(ctx context.Context, msg *tm_privvalproto.Message, pv *SC
 	// Check if the request is for the chain ID specified in the config.toml.
 	if reqData.chainID != pv.Config.Privval.ChainID {
 		err := fmt.Errorf("expected sign request for chain ID '%v', instead got '%v'", pv.Config.Privval.ChainID, reqData.chainID)
-		return buildResponse(msg, &tm_privvalproto.RemoteSignerError{Description: err.Error()}), err
+		return refuseSignRequest(msg, metrics.ReasonWrongChainID, err, pv)
 	}
 
-	// If the requested height is at least {threshold}+1 higher than last_signed_height,
-	// the node's rank has become obsolete due to a rank update in the set.
-	if !isRankUpToDate(reqData.height, pv.State.LastHeight, pv.GetThreshold()) {
-		pv.Logger.Debug("The requested height differs too much from the last height (%v - %v >= %v)", reqData.height, pv.State.LastHeight, pv.GetThreshold()+1)
-		return buildResponse(msg, &tm_privvalproto.RemoteSignerError{Description: ErrRankObsolete.Error()}), ErrRankObsolete
+	// Pick up the drains scheduled via the /drain endpoint.
+	pv.mergeDrains()
+
+	// If heights were skipped since last_height, replay them to catch up with the rank
+	// updates in the set.
+	if reqData.height-1 > pv.State.LastHeight && reqData.height > pv.BaseSignCtrled.GetCurrentHeight() {
+		if err := pv.catchUp(ctx, reqData.height-1); err != nil {
+			if errors.Is(err, types.ErrRemovedFromSet) {
+				return refuseSignRequest(msg, metrics.ReasonRemovedFromSet, err, pv)
+			}
+			if errors.Is(err, ErrRankObsolete) || errors.Is(err, ErrReplayTooLong) {
+				return refuseSignRequest(msg, metrics.ReasonRankObsolete, err, pv)
+			}
+			return refuseSignRequest(msg, metrics.ReasonQueryBlock, err, pv)
+		}
+	}
+
+	// Switch to the new set size once a set change activates.
+	if err := pv.updateSetSize(reqData.height); err != nil {
+		if errors.Is(err, types.ErrRemovedFromSet) {
+			return refuseSignRequest(msg, metrics.ReasonRemovedFromSet, err, pv)
+		}
+		pv.Logger.Error("couldn't save state to %v: %v\n", config.StateFile, err)
+	}
+
+	// Switch to the new drained ranks once a drain activates.
+	if err := pv.updateDrains(reqData.height); err != nil {
+		pv.Logger.Error("couldn't save state to %v: %v\n", config.StateFile, err)
 	}
 
 	// Only check the commitsigs once for each block height.
 	// Also, only start checking for block heights greater than 1.
 	// This is due to the genesis block not having any commitsigs.
 	if reqData.height > pv.BaseSignCtrled.GetCurrentHeight() && reqData.height > 1 {
-		// Get block information from the validator's /block endpoint.
-		rb, err := rpc.QueryBlock(ctx, pv.Config.Base.ValidatorListenAddressRPC, reqData.height-1, pv.Logger)
-		if err != nil {
-			return buildResponse(msg, &tm_privvalproto.RemoteSignerError{Description: err.Error()}), err
+		// Check whether the validator's commitsig is in the previous block.
+		signed, block, err := isCommitSigned(ctx, reqData.height-1, pv)
+		if err != nil && !errors.Is(err, ErrUnverifiedBlock) {
+			return refuseSignRequest(msg, metrics.ReasonQueryBlock, err, pv)
 		}
 
 		// Update the current height to the height of the request.
 		pv.BaseSignCtrled.SetCurrentHeight(reqData.height)
 		pv.State.LastHeight = reqData.height
+		if err := pv.saveHeightProgress(); err != nil {
+			pv.Logger.Error("couldn't save state to %v: %v\n", config.StateFile, err)
+		}
 
-		// Check if the commitsigs in the block are signed by the validator.
-		pub, _ := pv.TMFilePV.GetPubKey()
-		if !hasSignedCommit(pub.Address(), &rb.Block.LastCommit.Signatures) {
+		if err != nil {
+			// A block that fails verification is neither counted as missed nor as
+			// signed, so a tampered RPC response can't trigger a rank update.
+			pv.Metrics.UnverifiedBlocks.Inc()
+			pv.Logger.Error("REJECTED block height %v, it's not counted as missed: %v\n", reqData.height-1, err)
+		} else if !signed {
 			// Check if the threshold of too many missed blocks in a row is exceeded.
-			if err := pv.Missed(); err != nil {
+			if err := pv.Missed(block); err != nil {
 				if err == types.ErrMustShutdown {
-					return buildResponse(msg, &tm_privvalproto.RemoteSignerError{Description: err.Error()}), err
+					return refuseSignRequest(msg, metrics.ReasonMustShutdown, err, pv)
 				}
 			}
 		} else {
-			// If the commit was signed, reset the counter for missed blocks in a row
-			// and unlock it if it hasn't already been unlocked.
-			pv.Reset()
+			// If rank 1 didn't sign the commit itself, another node in the set did.
+			// The last commit of the previous block carries the commitsigs for the
+			// height before it. Without a signature in the state file, the commit
+			// might stem from a previous run of this node, so it's only checked once
+			// the node signed.
+			if pv.State.LastSigned.Height > 0 && pv.checkForeignSignature(reqData.height-2) != nil {
+				pv.foreignHeight = reqData.height
+			}
+
+			// If the commit was signed, record it with the rank policy and unlock the
+			// counter for missed blocks if it hasn't already been unlocked.
+			if pv.IsCounterLocked() {
+				pv.seedRankPolicy(ctx, reqData.height-1)
+			}
+			pv.Signed(block)
 			pv.UnlockCounter()
 		}
 	}
@@ -213,7 +344,34 @@ func handleSignRequest(ctx context.Context, msg *tm_privvalproto.Message, pv *SC
 	// Prevent the node from signing if it's not ranked first in the set.
 	if pv.GetRank() > 1 {
 		err := fmt.Errorf("no signing permission for %v on block height %v (rank: %v)", reqData.msgType, reqData.height, pv.GetRank())
-		return buildResponse(msg, &tm_privvalproto.RemoteSignerError{Description: err.Error()}), err
+		return refuseSignRequest(msg, metrics.ReasonNoPermission, err, pv)
+	}
+
+	// Stop signing once a scheduled handover to rank 2 begins.
+	if err := pv.checkHandover(reqData.height); err != nil {
+		return refuseSignRequest(msg, metrics.ReasonHandover, err, pv)
+	}
+
+	// Refuse to sign after a self-induced shutdown until the validator daemon has been
+	// restarted.
+	if err := pv.checkFence(); err != nil {
+		return refuseSignRequest(msg, metrics.ReasonFenced, err, pv)
+	}
+
+	// Refuse to sign if another node in the set signs as rank 1 as well.
+	if err := pv.checkDuplicateRank(reqData.height); err != nil {
+		return refuseSignRequest(msg, metrics.ReasonDuplicateRank, err, pv)
+	}
+
+	// Refuse to sign if another member of the set claims rank 1 as well, or has
+	// different set changes or drains.
+	if pv.Peers != nil {
+		if err := pv.Peers.CheckConflict(pv.peerStatus()); err != nil {
+			return refuseSignRequest(msg, metrics.ReasonPeerConflict, err, pv)
+		}
+		if err := pv.Peers.CheckActiveSchedule(pv.Config.Base.ScheduleAt); err != nil {
+			return refuseSignRequest(msg, metrics.ReasonScheduleMismatch, fmt.Errorf("%w: %v", ErrScheduleMismatch, err), pv)
+		}
 	}
 
 	switch msg.Sum.(type) {
@@ -221,11 +379,13 @@ func handleSignRequest(ctx context.Context, msg *tm_privvalproto.Message, pv *SC
 		req := msg.GetSignVoteRequest()
 
 		// The node has permission to sign the vote, so sign it.
-		if err := pv.TMFilePV.SignVote(pv.Config.Privval.ChainID, req.Vote); err != nil {
-			err := fmt.Errorf("failed to sign %v for block height %v: %v", req.Vote.Type, req.Vote.Height, err)
-			return buildResponse(msg, &tm_privvalproto.RemoteSignerError{Description: err.Error()}), err
+		if err := signVote(pv.Config.Privval.ChainID, req.Vote, pv); err != nil {
+			err := fmt.Errorf("failed to sign %v for block height %v: %w", req.Vote.Type, req.Vote.Height, err)
+			return refuseSignRequest(msg, signErrReason(err), err, pv)
 		}
 
+		pv.Metrics.SignedMsgs.WithLabelValues(req.Vote.Type.String()).Inc()
+		pv.Metrics.SignLatency.WithLabelValues(req.Vote.Type.String()).Observe(time.Since(start).Seconds())
 		pv.Logger.Info("Signed %v for block height %v", req.Vote.Type, req.Vote.Height)
 		return buildResponse(wrapMsg(&tm_privvalproto.SignVoteRequest{Vote: req.Vote, ChainId: req.GetChainId()}), nil), nil
 
@@ -233,11 +393,13 @@ func handleSignRequest(ctx context.Context, msg *tm_privvalproto.Message, pv *SC
 		req := msg.GetSignProposalRequest()
 
 		// The node has permission to sign the proposal, so sign it.
-		if err := pv.TMFilePV.SignProposal(pv.Config.Privval.ChainID, req.Proposal); err != nil {
-			err := fmt.Errorf("failed to sign %v for block height %v: %v", req.Proposal.Type, req.Proposal.Height, err)
-			return buildResponse(msg, &tm_privvalproto.RemoteSignerError{Description: err.Error()}), err
+		if err := signProposal(pv.Config.Privval.ChainID, req.Proposal, pv); err != nil {
+			err := fmt.Errorf("failed to sign %v for block height %v: %w", req.Proposal.Type, req.Proposal.Height, err)
+			return refuseSignRequest(msg, signErrReason(err), err, pv)
 		}
 
+		pv.Metrics.SignedMsgs.WithLabelValues(req.Proposal.Type.String()).Inc()
+		pv.Metrics.SignLatency.WithLabelValues(req.Proposal.Type.String()).Observe(time.Since(start).Seconds())
 		pv.Logger.Info("Signed %v for block height %v", req.Proposal.Type, req.Proposal.Height)
 		return buildResponse(wrapMsg(&tm_privvalproto.SignProposalRequest{Proposal: req.Proposal, ChainId: req.GetChainId()}), nil), nil
 
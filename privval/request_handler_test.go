@@ -2,15 +2,19 @@ package privval
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"net"
 	"net/http"
 	"os"
+	"strconv"
 	"testing"
 	"time"
 
+	"github.com/BlockscapeNetwork/signctrl/metrics"
 	"github.com/BlockscapeNetwork/signctrl/rpc"
 	"github.com/BlockscapeNetwork/signctrl/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	tm_crypto "github.com/tendermint/tendermint/crypto"
 	tm_hash "github.com/tendermint/tendermint/crypto/tmhash"
@@ -93,14 +97,6 @@ func TestHasSignedCommit(t *testing.T) {
 	assert.False(t, signed)
 }
 
-func TestIsRankUpToDate(t *testing.T) {
-	upToDate := isRankUpToDate(2, 1, 1)
-	assert.True(t, upToDate)
-
-	upToDate = isRankUpToDate(3, 1, 1)
-	assert.False(t, upToDate)
-}
-
 func testPingRequest(t *testing.T) *tm_privvalproto.Message {
 	t.Helper()
 	return &tm_privvalproto.Message{
@@ -276,6 +272,13 @@ func testBlockResult(t *testing.T) *rpc.BlockResult {
 	}
 }
 
+// setRPCAddress points the mock SCFilePV's RPC client to the given port.
+func setRPCAddress(t *testing.T, pv *SCFilePV, port int) {
+	t.Helper()
+	pv.Config.Base.ValidatorListenAddressRPC = fmt.Sprintf("tcp://127.0.0.1:%v", port)
+	pv.RPC = rpc.NewClient(pv.Config.Base.ValidatorListenAddressRPC, nil, rpc.DefaultCacheSize, pv.Logger, pv.Metrics)
+}
+
 func testBlockEndpoint(t *testing.T, port int, result *rpc.BlockResult, quitCh chan struct{}) {
 	t.Helper()
 	mux := http.NewServeMux()
@@ -283,15 +286,50 @@ func testBlockEndpoint(t *testing.T, port int, result *rpc.BlockResult, quitCh c
 		bytes, _ := tm_json.Marshal(result)
 		_, _ = rw.Write(bytes)
 	})
+	serveMockEndpoint(t, port, mux, quitCh)
+}
+
+// startChainEndpoint starts a mock block endpoint that serves a block for every height.
+// Just like on chain, the last commit of block h carries the commitsigs for height h-1,
+// which include the validator's commitsig if signed(h-1) is true.
+func startChainEndpoint(t *testing.T, pv *SCFilePV, signed func(height int64) bool) chan struct{} {
+	t.Helper()
+	pub, _ := pv.TMFilePV.GetPubKey()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/block", func(rw http.ResponseWriter, r *http.Request) {
+		height, _ := strconv.ParseInt(r.URL.Query().Get("height"), 10, 64)
+		br := testBlockResult(t)
+		br.Result.Block.Header.Height = height
+		if signed(height - 1) {
+			br.Result.Block.LastCommit.Signatures = append(br.Result.Block.LastCommit.Signatures, tm_types.CommitSig{ValidatorAddress: pub.Address()})
+		}
+		bytes, _ := tm_json.Marshal(br)
+		_, _ = rw.Write(bytes)
+	})
+
+	port, _ := getFreePort(t)
+	setRPCAddress(t, pv, port)
+	quitCh := make(chan struct{})
+	serveMockEndpoint(t, port, mux, quitCh)
+
+	return quitCh
+}
 
+// serveMockEndpoint serves the given handler on the given port until quitCh is closed.
+func serveMockEndpoint(t *testing.T, port int, mux *http.ServeMux, quitCh chan struct{}) {
+	t.Helper()
 	server := http.Server{Addr: fmt.Sprintf(":%v", port), Handler: mux}
-	defer server.Close()
 
-	listener, _ := net.Listen("tcp", server.Addr)
+	// Listen before returning, so the block query doesn't race the server's startup.
+	listener, err := net.Listen("tcp", server.Addr)
+	assert.NoError(t, err)
 	go func() {
 		_ = server.Serve(listener)
 	}()
-	<-quitCh
+	go func() {
+		<-quitCh
+		server.Close()
+	}()
 }
 
 func TestHandleSignRequest(t *testing.T) {
@@ -300,9 +338,9 @@ func TestHandleSignRequest(t *testing.T) {
 
 	// Start mock endpoint for the block query.
 	port, _ := getFreePort(t)
-	pv.Config.Base.ValidatorListenAddressRPC = fmt.Sprintf("tcp://127.0.0.1:%v", port)
+	setRPCAddress(t, pv, port)
 	quitCh := make(chan struct{})
-	go testBlockEndpoint(t, port, testBlockResult(t), quitCh)
+	testBlockEndpoint(t, port, testBlockResult(t), quitCh)
 	defer close(quitCh)
 
 	// Initialize new file signer.
@@ -317,6 +355,7 @@ func TestHandleSignRequest(t *testing.T) {
 	msg, err := HandleRequest(context.Background(), testSignVoteRequest(t), pv)
 	assert.NotNil(t, msg)
 	assert.NoError(t, err)
+	assert.Equal(t, float64(1), testutil.ToFloat64(pv.Metrics.SignedMsgs.WithLabelValues(tm_prototypes.PrecommitType.String())))
 }
 
 func TestHandleSignRequest_WrongChainID(t *testing.T) {
@@ -336,15 +375,45 @@ func TestHandleSignRequest_ObsoleteRank(t *testing.T) {
 	// Initialize mock SCFilePV with valid values.
 	pv := mockSCFilePV(t)
 
-	// Make rank obsolete by making the gap between the requested vote height
-	// and the threshold {threshold+2} wide.
+	// Start mock endpoint for the block queries, whose blocks all lack the
+	// validator's commitsig.
+	quitCh := startSignedBlockEndpoint(t, pv, false)
+	defer close(quitCh)
+
+	// Make rank 1 obsolete by making it miss {threshold} blocks between the last
+	// height and the requested vote height.
 	req := testSignVoteRequest(t)
 	req.GetSignVoteRequest().Vote.Height = int64(pv.GetThreshold()) + 2
 
 	// Handle the request.
 	msg, err := HandleRequest(context.Background(), req, pv)
 	assert.NotNil(t, msg)
-	assert.Error(t, err)
+	assert.ErrorIs(t, err, ErrRankObsolete)
+}
+
+func TestHandleSignRequest_CatchUp(t *testing.T) {
+	// Initialize mock SCFilePV with valid values.
+	pv := mockSCFilePV(t)
+	pv.SetRank(2)
+	pv.UnlockCounter()
+	pv.TMFilePV = freshFilePV(t, pv)
+
+	// Start mock endpoint for the block queries, whose blocks all lack the
+	// validator's commitsig.
+	quitCh := startSignedBlockEndpoint(t, pv, false)
+	defer close(quitCh)
+
+	// The validator was promoted while it was offline, so it signs on rank 1.
+	req := testSignVoteRequest(t)
+	req.GetSignVoteRequest().Vote.Height = 16
+
+	// Handle the request.
+	msg, err := HandleRequest(context.Background(), req, pv)
+	assert.NotNil(t, msg)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, pv.GetRank())
+	assert.Equal(t, 4, pv.GetMissedInARow())
+	assert.Equal(t, int64(16), pv.State.LastHeight)
 }
 
 func TestHandleSignRequest_QueryBlockErr(t *testing.T) {
@@ -367,9 +436,9 @@ func TestHandleSignRequest_Missed(t *testing.T) {
 
 	// Start mock endpoint for the block query.
 	port, _ := getFreePort(t)
-	pv.Config.Base.ValidatorListenAddressRPC = fmt.Sprintf("tcp://127.0.0.1:%v", port)
+	setRPCAddress(t, pv, port)
 	quitCh := make(chan struct{})
-	go testBlockEndpoint(t, port, testBlockResult(t), quitCh)
+	testBlockEndpoint(t, port, testBlockResult(t), quitCh)
 	defer close(quitCh)
 
 	// Initialize new file signer.
@@ -390,6 +459,31 @@ func TestHandleSignRequest_Missed(t *testing.T) {
 	assert.NoError(t, err)
 }
 
+func TestHandleSignRequest_Unverified(t *testing.T) {
+	// Initialize mock SCFilePV with valid values.
+	pv := mockSCFilePV(t)
+	pv.UnlockCounter()
+	pv.Verifier = &testVerifier{err: rpc.ErrTamperedBlock}
+
+	// Start mock endpoint for the block query.
+	port, _ := getFreePort(t)
+	setRPCAddress(t, pv, port)
+	quitCh := make(chan struct{})
+	testBlockEndpoint(t, port, testBlockResult(t), quitCh)
+	defer close(quitCh)
+
+	// Initialize new file signer.
+	pv.TMFilePV = freshFilePV(t, pv)
+
+	// The testBlockResult doesn't contain the validator's commitsig, but it fails
+	// verification, so it's not counted as missed and the vote is still signed.
+	msg, err := HandleRequest(context.Background(), testSignVoteRequest(t), pv)
+	assert.NotNil(t, msg)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, pv.GetMissedInARow())
+	assert.Equal(t, float64(1), testutil.ToFloat64(pv.Metrics.UnverifiedBlocks))
+}
+
 func TestHandleSignRequest_MustShutdown(t *testing.T) {
 	// Initialize mock SCFilePV with valid values.
 	pv := mockSCFilePV(t)
@@ -406,9 +500,9 @@ func TestHandleSignRequest_MustShutdown(t *testing.T) {
 
 	// Start mock endpoint for the block query.
 	port, _ := getFreePort(t)
-	pv.Config.Base.ValidatorListenAddressRPC = fmt.Sprintf("tcp://127.0.0.1:%v", port)
+	setRPCAddress(t, pv, port)
 	quitCh := make(chan struct{})
-	go testBlockEndpoint(t, port, testBlockResult(t), quitCh)
+	testBlockEndpoint(t, port, testBlockResult(t), quitCh)
 	defer close(quitCh)
 
 	// Handle the request.
@@ -437,8 +531,8 @@ func TestHandleSignRequest_RankTooLow(t *testing.T) {
 
 	// Start mock endpoint for the block query.
 	port, _ := getFreePort(t)
-	pv.Config.Base.ValidatorListenAddressRPC = fmt.Sprintf("tcp://127.0.0.1:%v", port)
-	go testBlockEndpoint(t, port, br, quitCh)
+	setRPCAddress(t, pv, port)
+	testBlockEndpoint(t, port, br, quitCh)
 	defer close(quitCh)
 
 	// Handle the request.
@@ -446,6 +540,7 @@ func TestHandleSignRequest_RankTooLow(t *testing.T) {
 	assert.NotNil(t, msg)
 	assert.Error(t, err)
 	assert.Equal(t, 0, pv.GetMissedInARow())
+	assert.Equal(t, float64(1), testutil.ToFloat64(pv.Metrics.RefusedSignRequests.WithLabelValues(metrics.ReasonNoPermission)))
 }
 
 func TestHandleSignRequest_SignVoteErr(t *testing.T) {
@@ -465,8 +560,8 @@ func TestHandleSignRequest_SignVoteErr(t *testing.T) {
 
 	// Start mock endpoint for the block query.
 	port, _ := getFreePort(t)
-	pv.Config.Base.ValidatorListenAddressRPC = fmt.Sprintf("tcp://127.0.0.1:%v", port)
-	go testBlockEndpoint(t, port, br, quitCh)
+	setRPCAddress(t, pv, port)
+	testBlockEndpoint(t, port, br, quitCh)
 	defer close(quitCh)
 
 	// Initialize new file signer.
@@ -483,3 +578,62 @@ func TestHandleRequest_UnknownMessage(t *testing.T) {
 	assert.Nil(t, msg)
 	assert.Error(t, err)
 }
+
+func TestIsCommitSigned_Quorum(t *testing.T) {
+	pv := mockSCFilePV(t)
+	pub, _ := pv.TMFilePV.GetPubKey()
+
+	// The validator's RPC server doesn't know the commitsig, while the fallback does.
+	signedResult := testBlockResult(t)
+	signedResult.Result.Block.LastCommit.Signatures = append(signedResult.Result.Block.LastCommit.Signatures, tm_types.CommitSig{
+		ValidatorAddress: pub.Address(),
+		Signature:        []byte("OWN-SIG"),
+	})
+	port, _ := getFreePort(t)
+	fallbackPort, _ := getFreePort(t)
+	secondFallbackPort, _ := getFreePort(t)
+	quitCh := make(chan struct{})
+	testBlockEndpoint(t, port, testBlockResult(t), quitCh)
+	testBlockEndpoint(t, fallbackPort, signedResult, quitCh)
+	testBlockEndpoint(t, secondFallbackPort, signedResult, quitCh)
+	defer close(quitCh)
+
+	fallback := fmt.Sprintf("tcp://127.0.0.1:%v", fallbackPort)
+	pv.Config.Base.FallbackListenAddressesRPC = []string{fallback}
+	setRPCAddress(t, pv, port)
+	pv.RPC = rpc.NewClient(pv.Config.Base.ValidatorListenAddressRPC, []string{fallback}, rpc.DefaultCacheSize, pv.Logger, pv.Metrics)
+
+	// Without a quorum, the validator's RPC server decides.
+	signed, block, err := isCommitSigned(context.Background(), 1, pv)
+	assert.False(t, signed)
+	assert.Equal(t, int64(1), block.Height)
+	assert.Equal(t, testBlockResult(t).Result.Block.Header.Time, block.Time)
+	assert.NoError(t, err)
+
+	// With a quorum of two, the disputed block is neither counted as missed nor as signed.
+	pv.Config.Base.RPCQuorum = 2
+	signed, _, err = isCommitSigned(context.Background(), 1, pv)
+	assert.False(t, signed)
+	assert.True(t, errors.Is(err, ErrUnverifiedBlock))
+
+	// Only 1 of 3 RPC servers reports a missing commitsig.
+	fallbacks := []string{fallback, fmt.Sprintf("tcp://127.0.0.1:%v", secondFallbackPort)}
+	pv.RPC = rpc.NewClient(pv.Config.Base.ValidatorListenAddressRPC, fallbacks, rpc.DefaultCacheSize, pv.Logger, pv.Metrics)
+	signed, _, err = isCommitSigned(context.Background(), 1, pv)
+	assert.False(t, signed)
+	assert.True(t, errors.Is(err, ErrUnverifiedBlock))
+
+	// A disputed block neither resets the streak of missed blocks nor unlocks the counter.
+	pv.SetRank(2)
+	pv.LockCounter()
+	pv.GetRankPolicy().Missed(types.Block{Height: 1})
+	pv.BaseSignCtrled.SetCurrentHeight(1)
+	_, _ = HandleRequest(context.Background(), testSignVoteRequest(t), pv)
+	assert.True(t, pv.IsCounterLocked())
+	assert.Equal(t, 1, pv.GetRankPolicy().Count())
+
+	// Not enough RPC servers respond for a quorum.
+	pv.RPC = rpc.NewClient(pv.Config.Base.ValidatorListenAddressRPC, []string{"tcp://127.0.0.1:1"}, rpc.DefaultCacheSize, pv.Logger, pv.Metrics)
+	_, _, err = isCommitSigned(context.Background(), 1, pv)
+	assert.Error(t, err)
+}
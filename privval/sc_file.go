@@ -2,16 +2,23 @@ package privval
 
 import (
 	"context"
+	"errors"
 	"io"
 	"net"
 	"net/http"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/BlockscapeNetwork/signctrl/config"
 	"github.com/BlockscapeNetwork/signctrl/connection"
+	"github.com/BlockscapeNetwork/signctrl/coordination"
+	"github.com/BlockscapeNetwork/signctrl/metrics"
+	"github.com/BlockscapeNetwork/signctrl/rpc"
 	"github.com/BlockscapeNetwork/signctrl/types"
+	"github.com/prometheus/client_golang/prometheus"
 	tm_protoio "github.com/tendermint/tendermint/libs/protoio"
+	tm_light "github.com/tendermint/tendermint/light"
 	tm_privvalproto "github.com/tendermint/tendermint/proto/tendermint/privval"
 	tm_types "github.com/tendermint/tendermint/types"
 )
@@ -31,7 +38,8 @@ const (
 // SCFilePV must implement the SignCtrled interface.
 var _ types.SignCtrled = new(SCFilePV)
 
-// SCFilePV is a wrapper for tm_privval.FilePV.
+// SCFilePV wraps a signing backend, by default tm_privval.FilePV, with SignCTRL's
+// ranking layer.
 // Implements the SignCtrled interface by embedding BaseSignCtrled.
 // Implements the Service interface by embedding BaseService.
 type SCFilePV struct {
@@ -44,7 +52,43 @@ type SCFilePV struct {
 	TMFilePV   tm_types.PrivValidator
 	SecretConn net.Conn
 	HTTP       *http.Server
+	Registry   *prometheus.Registry
 	Gauges     types.Gauges
+	Metrics    *metrics.Metrics
+	RPC        *rpc.Client
+	Verifier   rpc.BlockVerifier
+	Peers      *coordination.Node
+
+	// lastSavedHeight is the last height persisted to the signctrl_state.json file.
+	lastSavedHeight int64
+
+	// freshState is true if the signctrl_state.json file had no rank persisted on
+	// startup, so there's no history to catch up with.
+	freshState bool
+
+	// listener accepts the validator's connections in listen mode.
+	listener net.Listener
+
+	// handoverHeight is the height from which on rank 1 stops signing in order to hand
+	// over to rank 2. It's 0 if no handover is scheduled.
+	handoverHeight int64
+
+	// saveMtx serializes writes to the signctrl_state.json file, as handovers are
+	// persisted from the HTTP server.
+	saveMtx sync.Mutex
+
+	// drainMtx guards the drains in the config, as drains scheduled via the /drain
+	// endpoint are merged into them.
+	drainMtx sync.Mutex
+
+	// pendingDrains are the drains scheduled via the /drain endpoint that haven't been
+	// merged into the config yet.
+	pendingDrains []config.Drain
+
+	// foreignHeight is the height whose previous block carried the validator's
+	// commitsig for the height before it, although this node didn't sign that height
+	// as rank 1.
+	foreignHeight int64
 }
 
 // KeyFilePath returns the absolute path to the priv_validator_key.json file.
@@ -57,7 +101,41 @@ func StateFilePath(cfgDir string) string {
 	return filepath.Join(cfgDir, StateFile)
 }
 
-// NewSCFilePV creates a new instance of SCFilePV.
+// startRank returns the rank the validator starts on. A rank persisted in the
+// signctrl_state.json file takes precedence over the start_rank in the config.toml,
+// so that a restart never resumes at a rank that is stale due to a rank update.
+func startRank(cfg config.Config, state config.State) int {
+	if state.LastRank > 0 {
+		return state.LastRank
+	}
+
+	return cfg.Base.StartRank
+}
+
+// heightSaveInterval returns the number of heights after which the height progress
+// is persisted to the signctrl_state.json file. It is kept well below the threshold,
+// so a crash doesn't leave the persisted height lagging behind by so much that a
+// quick restart would render the rank obsolete.
+func heightSaveInterval(threshold int) int64 {
+	if interval := int64(threshold / 2); interval > 1 {
+		return interval
+	}
+
+	return 1
+}
+
+// trustOptions returns the light client's trust options from the [light] section of
+// the config.toml.
+func trustOptions(cfg config.Config) tm_light.TrustOptions {
+	return tm_light.TrustOptions{
+		Period: cfg.Light.GetTrustPeriod(),
+		Height: cfg.Light.TrustHeight,
+		Hash:   cfg.Light.GetTrustHash(),
+	}
+}
+
+// NewSCFilePV creates a new instance of SCFilePV. Its gauges and metrics are
+// registered with its own prometheus registry.
 func NewSCFilePV(logger *types.SyncLogger, cfg config.Config, state config.State, tmpv tm_types.PrivValidator, http *http.Server) *SCFilePV {
 	pv := &SCFilePV{
 		Logger:   logger,
@@ -65,6 +143,22 @@ func NewSCFilePV(logger *types.SyncLogger, cfg config.Config, state config.State
 		State:    state,
 		TMFilePV: tmpv,
 		HTTP:     http,
+		Registry: prometheus.NewRegistry(),
+	}
+	pv.Gauges = types.RegisterGauges(pv.Registry)
+	pv.Metrics = metrics.New(pv.Registry)
+	pv.RPC = rpc.NewClient(cfg.Base.ValidatorListenAddressRPC, cfg.Base.FallbackListenAddressesRPC, rpc.DefaultCacheSize, logger, pv.Metrics)
+	if verifier, err := rpc.NewVerifier(cfg.Privval.ChainID, cfg.Base.ValidatorListenAddressRPC, cfg.Base.FallbackListenAddressesRPC, trustOptions(cfg), logger); err != nil {
+		logger.Error("couldn't create light client verifier, missed blocks can't be verified: %v\n", err)
+	} else {
+		pv.Verifier = verifier
+	}
+	if cfg.Peers.Enabled() {
+		if node, err := coordination.NewNode(config.Dir(), cfg.Peers, pv.peerStatus, logger, pv.Metrics); err != nil {
+			logger.Error("couldn't create coordination channel: %v\n", err)
+		} else {
+			pv.Peers = node
+		}
 	}
 	pv.BaseService = *types.NewBaseService(
 		logger,
@@ -74,13 +168,61 @@ func NewSCFilePV(logger *types.SyncLogger, cfg config.Config, state config.State
 	pv.BaseSignCtrled = *types.NewBaseSignCtrled(
 		logger,
 		pv.Config.Base.Threshold,
-		pv.Config.Base.StartRank,
+		startRank(cfg, state),
 		pv,
 	)
+	pv.SetRankPolicy(cfg.Base.NewRankPolicy())
+	pv.SetDrainedRanks(state.DrainedRanks)
+	pv.handoverHeight = state.HandoverHeight
+	pv.lastSavedHeight = state.LastHeight
+	pv.freshState = state.LastRank == 0
 
 	return pv
 }
 
+// saveState persists the validator's current rank along with the rest of its state
+// to the signctrl_state.json file.
+func (pv *SCFilePV) saveState() error {
+	pv.saveMtx.Lock()
+	defer pv.saveMtx.Unlock()
+
+	pv.State.LastRank = pv.GetRank()
+	pv.State.DrainedRanks = pv.GetDrainedRanks()
+	pv.State.HandoverHeight = pv.getHandoverHeight()
+	if err := pv.State.Save(config.Dir()); err != nil {
+		return err
+	}
+	pv.lastSavedHeight = pv.State.LastHeight
+
+	return nil
+}
+
+// saveHeightProgress persists the state once the height has advanced by at least
+// the height save interval since it was last persisted.
+func (pv *SCFilePV) saveHeightProgress() error {
+	if pv.State.LastHeight-pv.lastSavedHeight < heightSaveInterval(pv.GetThreshold()) {
+		return nil
+	}
+
+	return pv.saveState()
+}
+
+// connect establishes a connection with the validator. Depending on the mode, it
+// either dials the validator or waits for the validator to connect.
+func (pv *SCFilePV) connect() (net.Conn, error) {
+	if pv.Config.Base.Mode == config.ModeListen {
+		return connection.RetryAccept(config.Dir(), pv.listener, pv.Config.Base.ValidatorConnPubKeys, pv.Logger, pv.Metrics)
+	}
+
+	return connection.RetryDial(
+		config.Dir(),
+		pv.Config.Base.ValidatorListenAddress,
+		pv.Config.Base.ValidatorConnPubKeys,
+		pv.Logger,
+		pv.Metrics,
+	)
+}
+
 // run runs the main loop of SignCTRL. It handles incoming messages from the validator.
 // In order to stop the goroutine, Stop() can be called outside of run(). The goroutine
 // returns on its own once SignCTRL is forced to shut down.
@@ -100,6 +242,7 @@ func (pv *SCFilePV) run() {
 
 			// Lock the counter for missed blocks in a row again.
 			pv.LockCounter()
+			pv.Metrics.Connected.Set(0)
 
 			// Close the connection and establish a new one.
 			if err := pv.SecretConn.Close(); err != nil {
@@ -107,15 +250,12 @@ func (pv *SCFilePV) run() {
 			}
 
 			var err error
-			if pv.SecretConn, err = connection.RetryDial(
-				config.Dir(),
-				pv.Config.Base.ValidatorListenAddress,
-				pv.Logger,
-			); err != nil {
-				pv.Logger.Error("couldn't dial validator: %v\n", err)
-				// Note: Don't use pv.Stop() in here, as RetryDial can only be stopped via SIGINT/SIGTERM.
+			if pv.SecretConn, err = pv.connect(); err != nil {
+				pv.Logger.Error("couldn't connect to validator: %v\n", err)
+				// Note: Don't use pv.Stop() in here, as connecting can only be stopped via SIGINT/SIGTERM.
 				return
 			}
+			pv.Metrics.Reconnects.Inc()
 
 		default:
 			var msg tm_privvalproto.Message
@@ -137,7 +277,32 @@ func (pv *SCFilePV) run() {
 			}
 			if err != nil {
 				pv.Logger.Error("couldn't handle request: %v\n", err)
-				if err == types.ErrMustShutdown || err == ErrRankObsolete {
+				if err == types.ErrMustShutdown || errors.Is(err, ErrRankObsolete) || errors.Is(err, ErrReplayTooLong) || errors.Is(err, types.ErrRemovedFromSet) {
+					// Rejoin the set instead of shutting down, if enabled. A validator
+					// that has been removed from the set doesn't rejoin.
+					if pv.Config.Base.Rejoin && !errors.Is(err, types.ErrRemovedFromSet) {
+						rejoinErr := pv.rejoin(getSharedSignRequestData(&msg).height, err)
+						if rejoinErr == nil {
+							cancel()
+							continue
+						}
+						pv.Logger.Error("couldn't rejoin the set: %v\n", rejoinErr)
+					}
+
+					// Rank 1 moved itself to the end of the set, but its rank policy isn't
+					// persisted, so a replay after a restart wouldn't tell. Persist the new
+					// rank instead, so it never resumes on rank 1.
+					if err == types.ErrMustShutdown {
+						if err := pv.demote(getSharedSignRequestData(&msg).height); err != nil {
+							pv.Logger.Error("couldn't save state to %v: %v\n", config.StateFile, err)
+						}
+					}
+
+					// Fence SignCTRL, as the validator daemon keeps running.
+					if err := pv.fence(); err != nil {
+						pv.Logger.Error("couldn't save state to %v: %v\n", config.StateFile, err)
+					}
+
 					pv.Logger.Debug("Terminating run goroutine: %v\n", err)
 					if err := pv.Stop(); err != nil {
 						pv.Logger.Error("%v", err)
@@ -159,18 +324,65 @@ func (pv *SCFilePV) run() {
 // Implements the Service interface.
 func (pv *SCFilePV) OnStart() (err error) {
 	pv.Logger.Info("Starting SignCTRL on rank %v...\n", pv.GetRank())
+	if pv.GetRank() != pv.Config.Base.StartRank {
+		pv.Logger.Warn("Resuming on rank %v persisted in %v instead of start_rank %v\n", pv.GetRank(), config.StateFile, pv.Config.Base.StartRank)
+	}
+
+	// Refuse to start if the set changes in the config.toml don't match the state.
+	if err := pv.checkSchedule(); err != nil {
+		return err
+	}
+
+	// Persist the rank right away, so a crash doesn't leave the state without one.
+	if err := pv.saveState(); err != nil {
+		return err
+	}
 
 	// Start http server.
 	if err := pv.StartHTTPServer(); err != nil {
 		return err
 	}
 
-	// Dial the validator.
-	if pv.SecretConn, err = connection.RetryDial(
-		config.Dir(),
-		pv.Config.Base.ValidatorListenAddress,
-		pv.Logger,
-	); err != nil {
+	// Start the RPC client's subscription to new blocks.
+	if err := pv.RPC.Start(); err != nil {
+		return err
+	}
+
+	if pv.State.Fence != nil {
+		pv.Logger.Warn("Fenced at block height %v, refusing to sign until the fence is lifted via signctrl unfence", pv.State.Fence.Height)
+	}
+
+	// Catch up with the rank updates in the set since the last height.
+	if err := pv.catchUpOnStart(context.Background()); err != nil {
+		return err
+	}
+
+	// Start exchanging statuses with the other members of the set.
+	if pv.Peers != nil {
+		if err := pv.Peers.Start(); err != nil {
+			return err
+		}
+	}
+
+	// Refuse to start if the other members of the set have different set changes and
+	// drains, or can't be reached to compare them.
+	if err := pv.checkPeerSchedules(context.Background()); err != nil {
+		return err
+	}
+
+	if len(pv.Config.Base.ValidatorConnPubKeys) == 0 {
+		pv.Logger.Warn("No validator_conn_pubkeys pinned, accepting secret connections with any public key")
+	}
+
+	// Bind the listener for the validator's connections in listen mode.
+	if pv.Config.Base.Mode == config.ModeListen {
+		if pv.listener, err = connection.Listen(pv.Config.Base.SignerListenAddress); err != nil {
+			return err
+		}
+	}
+
+	// Connect to the validator.
+	if pv.SecretConn, err = pv.connect(); err != nil {
 		return err
 	}
 
@@ -189,9 +401,40 @@ func (pv *SCFilePV) OnStop() error {
 	pv.Logger.Info("Stopping the HTTP server...")
 	pv.HTTP.Close()
 
+	// Close the listener for the validator's connections.
+	if pv.listener != nil {
+		pv.Logger.Info("Closing the listener...")
+		if err := pv.listener.Close(); err != nil {
+			pv.Logger.Error("%v", err)
+		}
+	}
+
+	// Stop the coordination channel.
+	if pv.Peers != nil && pv.Peers.IsRunning() {
+		pv.Logger.Info("Stopping the coordination channel...")
+		if err := pv.Peers.Stop(); err != nil {
+			pv.Logger.Error("%v", err)
+		}
+	}
+
+	// Stop the RPC client.
+	if pv.RPC.IsRunning() {
+		pv.Logger.Info("Stopping the RPC client...")
+		if err := pv.RPC.Stop(); err != nil {
+			pv.Logger.Error("%v", err)
+		}
+	}
+
+	// Close the signing backend.
+	if c, ok := pv.TMFilePV.(io.Closer); ok {
+		pv.Logger.Info("Closing the signing backend...")
+		if err := c.Close(); err != nil {
+			pv.Logger.Error("%v", err)
+		}
+	}
+
 	// Save rank to last_rank.json file if the shutdown was not self-induced.
-	pv.State.LastRank = pv.GetRank()
-	if err := pv.State.Save(config.Dir()); err != nil {
+	if err := pv.saveState(); err != nil {
 		pv.Logger.Error("couldn't save state to %v: %v\n", config.StateFile, err)
 		return err
 	}
@@ -207,9 +450,16 @@ func (pv *SCFilePV) OnMissedTooMany() {
 	pv.Gauges.MissedInARowGauge.Set(float64(pv.GetMissedInARow()))
 }
 
-// OnPromote sets the prometheus gauge for the validator's rank.
+// OnPromote sets the prometheus gauge for the validator's rank, forgets the statuses of
+// the other members of the set recorded on the previous rank and persists the new rank,
+// so that a restart after a crash never resumes at the previous rank.
 // Implements the SignCtrled interface.
 func (pv *SCFilePV) OnPromote() {
 	pv.Logger.Debug("Setting signctrl_rank gauge to %v\n", pv.GetRank())
 	pv.Gauges.RankGauge.Set(float64(pv.GetRank()))
+	pv.forgetPeers()
+
+	if err := pv.saveState(); err != nil {
+		pv.Logger.Error("couldn't save state to %v: %v\n", config.StateFile, err)
+	}
 }
@@ -1,10 +1,12 @@
 package privval
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
+	"os"
 	"testing"
 
 	"github.com/BlockscapeNetwork/signctrl/config"
@@ -14,6 +16,7 @@ import (
 	tm_ed25519 "github.com/tendermint/tendermint/crypto/ed25519"
 	tm_privval "github.com/tendermint/tendermint/privval"
 	tm_prototypes "github.com/tendermint/tendermint/proto/tendermint/types"
+	tm_coretypes "github.com/tendermint/tendermint/rpc/core/types"
 	tm_types "github.com/tendermint/tendermint/types"
 )
 
@@ -36,6 +39,15 @@ func (tpv *TestFilePV) SignProposal(chainID string, proposal *tm_prototypes.Prop
 	return errors.New("")
 }
 
+// testVerifier is a BlockVerifier that fails with err, if set.
+type testVerifier struct {
+	err error
+}
+
+func (tv *testVerifier) Verify(ctx context.Context, rb *tm_coretypes.ResultBlock) error {
+	return tv.err
+}
+
 func testConfig(t *testing.T) config.Config {
 	t.Helper()
 	return config.Config{
@@ -83,13 +95,20 @@ func testFilePV(t *testing.T) tm_types.PrivValidator {
 
 func mockSCFilePV(t *testing.T) *SCFilePV {
 	t.Helper()
-	return NewSCFilePV(
+
+	// Keep the state files written by SCFilePV out of the user's config directory.
+	os.Setenv("SIGNCTRL_CONFIG_DIR", t.TempDir())
+
+	pv := NewSCFilePV(
 		types.NewSyncLogger(ioutil.Discard, "", 0),
 		testConfig(t),
 		testState(t),
 		testFilePV(t),
 		&http.Server{Addr: fmt.Sprintf(":%v", DefaultHTTPPort)},
 	)
+	pv.Verifier = &testVerifier{}
+
+	return pv
 }
 
 func TestKeyFilePath(t *testing.T) {
@@ -101,3 +120,53 @@ func TestStateFilePath(t *testing.T) {
 	path := StateFilePath("/tmp")
 	assert.Equal(t, "/tmp/priv_validator_state.json", path)
 }
+
+func TestStartRank(t *testing.T) {
+	cfg := testConfig(t)
+	state := testState(t)
+
+	// No persisted rank.
+	state.LastRank = 0
+	assert.Equal(t, cfg.Base.StartRank, startRank(cfg, state))
+
+	// Persisted rank.
+	state.LastRank = 2
+	assert.Equal(t, 2, startRank(cfg, state))
+}
+
+func TestHeightSaveInterval(t *testing.T) {
+	assert.Equal(t, int64(1), heightSaveInterval(2))
+	assert.Equal(t, int64(1), heightSaveInterval(3))
+	assert.Equal(t, int64(5), heightSaveInterval(10))
+}
+
+func TestOnPromote(t *testing.T) {
+	pv := mockSCFilePV(t)
+	pv.SetRank(2)
+	err := pv.Promote()
+	assert.NoError(t, err)
+
+	state, err := config.LoadOrGenState(config.Dir(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, state.LastRank)
+}
+
+func TestSaveHeightProgress(t *testing.T) {
+	pv := mockSCFilePV(t)
+
+	// The height hasn't advanced far enough.
+	pv.State.LastHeight = testState(t).LastHeight + heightSaveInterval(pv.GetThreshold()) - 1
+	err := pv.saveHeightProgress()
+	assert.NoError(t, err)
+	_, err = os.Stat(config.StateFilePath(config.Dir()))
+	assert.True(t, os.IsNotExist(err))
+
+	// The height has advanced far enough.
+	pv.State.LastHeight++
+	err = pv.saveHeightProgress()
+	assert.NoError(t, err)
+
+	state, err := config.LoadOrGenState(config.Dir(), nil)
+	assert.NoError(t, err)
+	assert.Equal(t, pv.State.LastHeight, state.LastHeight)
+}
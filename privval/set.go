@@ -0,0 +1,81 @@
+package privval
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+// CheckSet checks whether the given statuses of all nodes in a SignCTRL set, keyed by
+// the URL they were retrieved from, form a consistent set. The ranks must be unique
+// and contiguous from 1 to set_size, and the nodes must agree on set_size, threshold,
+// drained ranks, set changes and drains.
+func CheckSet(statuses map[string]*StatusResponse) error {
+	if len(statuses) == 0 {
+		return errors.New("\tno statuses to check\n")
+	}
+
+	urls := make([]string, 0, len(statuses))
+	for url := range statuses {
+		urls = append(urls, url)
+	}
+	sort.Strings(urls)
+
+	var errs string
+	first := statuses[urls[0]]
+	ranks := make(map[int][]string)
+	for _, url := range urls {
+		sr := statuses[url]
+		ranks[sr.Rank] = append(ranks[sr.Rank], url)
+
+		if sr.SetSize != first.SetSize {
+			errs += fmt.Sprintf("\t%v has set_size %v, while %v has set_size %v\n", url, sr.SetSize, urls[0], first.SetSize)
+		}
+		if sr.Threshold != first.Threshold {
+			errs += fmt.Sprintf("\t%v has threshold %v, while %v has threshold %v\n", url, sr.Threshold, urls[0], first.Threshold)
+		}
+		if sr.Schedule != first.Schedule {
+			errs += fmt.Sprintf("\t%v has set changes and drains %q, while %v has set changes and drains %q\n", url, sr.Schedule, urls[0], first.Schedule)
+		}
+		if !reflect.DeepEqual(normalizeRanks(sr.Drained), normalizeRanks(first.Drained)) {
+			errs += fmt.Sprintf("\t%v has drained ranks %v, while %v has drained ranks %v\n", url, sr.Drained, urls[0], first.Drained)
+		}
+	}
+	if len(statuses) != first.SetSize {
+		errs += fmt.Sprintf("\tgot %v statuses, but the set_size is %v\n", len(statuses), first.SetSize)
+	}
+	for rank := 1; rank <= len(statuses); rank++ {
+		switch len(ranks[rank]) {
+		case 0:
+			errs += fmt.Sprintf("\trank %v is missing in the set\n", rank)
+		case 1:
+		default:
+			errs += fmt.Sprintf("\trank %v is held by more than one node: %v\n", rank, ranks[rank])
+		}
+	}
+	held := make([]int, 0, len(ranks))
+	for rank := range ranks {
+		held = append(held, rank)
+	}
+	sort.Ints(held)
+	for _, rank := range held {
+		if rank < 1 || rank > len(statuses) {
+			errs += fmt.Sprintf("\trank %v held by %v is out of range 1..%v\n", rank, ranks[rank], len(statuses))
+		}
+	}
+
+	if errs != "" {
+		return errors.New(errs)
+	}
+
+	return nil
+}
+
+// normalizeRanks returns a sorted copy of the given ranks, with nil and empty slices
+// being treated as equal.
+func normalizeRanks(ranks []int) []int {
+	sorted := append([]int{}, ranks...)
+	sort.Ints(sorted)
+	return sorted
+}
@@ -0,0 +1,64 @@
+package privval
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCheckSet(t *testing.T) {
+	status := func(rank int, drained ...int) *StatusResponse {
+		return &StatusResponse{Rank: rank, SetSize: 3, Threshold: 10, Drained: drained}
+	}
+
+	// A consistent set.
+	err := CheckSet(map[string]*StatusResponse{
+		"http://a:8080/status": status(1, 3),
+		"http://b:8080/status": status(2, 3),
+		"http://c:8080/status": status(3, 3),
+	})
+	assert.NoError(t, err)
+
+	// Two nodes on rank 1, none on rank 3.
+	err = CheckSet(map[string]*StatusResponse{
+		"http://a:8080/status": status(1),
+		"http://b:8080/status": status(2),
+		"http://c:8080/status": status(1),
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "rank 1 is held by more than one node")
+	assert.Contains(t, err.Error(), "rank 3 is missing")
+
+	// Disagreeing threshold and drained ranks.
+	mismatch := status(3)
+	mismatch.Threshold = 5
+	err = CheckSet(map[string]*StatusResponse{
+		"http://a:8080/status": status(1, 2),
+		"http://b:8080/status": status(2, 2),
+		"http://c:8080/status": mismatch,
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "threshold 5")
+	assert.Contains(t, err.Error(), "drained ranks []")
+
+	// Disagreeing set changes.
+	mismatch = status(3)
+	mismatch.Schedule = "abc"
+	err = CheckSet(map[string]*StatusResponse{
+		"http://a:8080/status": status(1),
+		"http://b:8080/status": status(2),
+		"http://c:8080/status": mismatch,
+	})
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "set changes")
+
+	// Not all members queried.
+	err = CheckSet(map[string]*StatusResponse{
+		"http://a:8080/status": status(1),
+		"http://b:8080/status": status(2),
+	})
+	assert.Error(t, err)
+
+	err = CheckSet(nil)
+	assert.Error(t, err)
+}
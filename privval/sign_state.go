@@ -0,0 +1,181 @@
+package privval
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/gogo/protobuf/proto"
+	tm_protoio "github.com/tendermint/tendermint/libs/protoio"
+	tm_typesproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tm_types "github.com/tendermint/tendermint/types"
+)
+
+const (
+	// stepPropose is the step of a proposal.
+	stepPropose int8 = 1
+
+	// stepPrevote is the step of a prevote.
+	stepPrevote int8 = 2
+
+	// stepPrecommit is the step of a precommit.
+	stepPrecommit int8 = 3
+)
+
+var (
+	// ErrDoubleSign is returned if a sign request regresses the last signed height,
+	// round and step, or if it matches them but its data differs from the last signed
+	// data by more than the timestamp.
+	ErrDoubleSign = errors.New("refusing to sign due to the risk of double-signing")
+)
+
+// voteToStep returns the step of the given vote. A vote is either a prevote or a
+// precommit.
+func voteToStep(vote *tm_typesproto.Vote) (int8, error) {
+	switch vote.Type {
+	case tm_typesproto.PrevoteType:
+		return stepPrevote, nil
+	case tm_typesproto.PrecommitType:
+		return stepPrecommit, nil
+	default:
+		return 0, fmt.Errorf("unknown vote type: %v", vote.Type)
+	}
+}
+
+// votesOnlyDifferByTimestamp checks whether the given vote sign bytes only differ
+// by their timestamp and returns the timestamp of the last sign bytes.
+func votesOnlyDifferByTimestamp(lastSignBytes, newSignBytes []byte) (time.Time, bool) {
+	var lastVote, newVote tm_typesproto.CanonicalVote
+	if err := tm_protoio.UnmarshalDelimited(lastSignBytes, &lastVote); err != nil {
+		return time.Time{}, false
+	}
+	if err := tm_protoio.UnmarshalDelimited(newSignBytes, &newVote); err != nil {
+		return time.Time{}, false
+	}
+
+	// Set the timestamps to the same value and check for equality.
+	newVote.Timestamp = lastVote.Timestamp
+	return lastVote.Timestamp, proto.Equal(&lastVote, &newVote)
+}
+
+// proposalsOnlyDifferByTimestamp checks whether the given proposal sign bytes only
+// differ by their timestamp and returns the timestamp of the last sign bytes.
+func proposalsOnlyDifferByTimestamp(lastSignBytes, newSignBytes []byte) (time.Time, bool) {
+	var lastProposal, newProposal tm_typesproto.CanonicalProposal
+	if err := tm_protoio.UnmarshalDelimited(lastSignBytes, &lastProposal); err != nil {
+		return time.Time{}, false
+	}
+	if err := tm_protoio.UnmarshalDelimited(newSignBytes, &newProposal); err != nil {
+		return time.Time{}, false
+	}
+
+	// Set the timestamps to the same value and check for equality.
+	newProposal.Timestamp = lastProposal.Timestamp
+	return lastProposal.Timestamp, proto.Equal(&lastProposal, &newProposal)
+}
+
+// signVote checks the vote against SignCTRL's own watermark before passing it on
+// to the PrivValidator. If the vote has already been signed, the last signature is
+// reused. The watermark is persisted before the signature is released.
+func signVote(chainID string, vote *tm_typesproto.Vote, pv *SCFilePV) error {
+	step, err := voteToStep(vote)
+	if err != nil {
+		return err
+	}
+	sameHRS, err := pv.State.LastSigned.CheckHRS(vote.Height, vote.Round, step)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDoubleSign, err)
+	}
+
+	// If the vote was already signed, only reuse the last signature if the vote is
+	// the same apart from its timestamp.
+	if sameHRS {
+		lss := pv.State.LastSigned
+		signBytes := tm_types.VoteSignBytes(chainID, vote)
+		if bytes.Equal(signBytes, lss.SignBytes) {
+			vote.Signature = lss.Signature
+			return nil
+		}
+		if ts, ok := votesOnlyDifferByTimestamp(lss.SignBytes, signBytes); ok {
+			vote.Timestamp = ts
+			vote.Signature = lss.Signature
+			return nil
+		}
+		return fmt.Errorf("%w: conflicting data at height %v round %v step %v", ErrDoubleSign, lss.Height, lss.Round, lss.Step)
+	}
+
+	if err := pv.TMFilePV.SignVote(chainID, vote); err != nil {
+		return err
+	}
+
+	// The PrivValidator may have altered the vote's timestamp, so the sign bytes
+	// must be built after signing.
+	if err := saveSigned(vote.Height, vote.Round, step, tm_types.VoteSignBytes(chainID, vote), vote.Signature, pv); err != nil {
+		vote.Signature = nil
+		return err
+	}
+
+	return nil
+}
+
+// signProposal checks the proposal against SignCTRL's own watermark before passing
+// it on to the PrivValidator. If the proposal has already been signed, the last
+// signature is reused. The watermark is persisted before the signature is released.
+func signProposal(chainID string, proposal *tm_typesproto.Proposal, pv *SCFilePV) error {
+	sameHRS, err := pv.State.LastSigned.CheckHRS(proposal.Height, proposal.Round, stepPropose)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDoubleSign, err)
+	}
+
+	// If the proposal was already signed, only reuse the last signature if the
+	// proposal is the same apart from its timestamp.
+	if sameHRS {
+		lss := pv.State.LastSigned
+		signBytes := tm_types.ProposalSignBytes(chainID, proposal)
+		if bytes.Equal(signBytes, lss.SignBytes) {
+			proposal.Signature = lss.Signature
+			return nil
+		}
+		if ts, ok := proposalsOnlyDifferByTimestamp(lss.SignBytes, signBytes); ok {
+			proposal.Timestamp = ts
+			proposal.Signature = lss.Signature
+			return nil
+		}
+		return fmt.Errorf("%w: conflicting data at height %v round %v step %v", ErrDoubleSign, lss.Height, lss.Round, lss.Step)
+	}
+
+	if err := pv.TMFilePV.SignProposal(chainID, proposal); err != nil {
+		return err
+	}
+
+	// The PrivValidator may have altered the proposal's timestamp, so the sign bytes
+	// must be built after signing.
+	if err := saveSigned(proposal.Height, proposal.Round, stepPropose, tm_types.ProposalSignBytes(chainID, proposal), proposal.Signature, pv); err != nil {
+		proposal.Signature = nil
+		return err
+	}
+
+	return nil
+}
+
+// saveSigned moves the watermark to the given height, round and step and persists
+// it. If the watermark can't be persisted, it is rolled back and the signature must
+// be withheld.
+func saveSigned(height int64, round int32, step int8, signBytes, sig []byte, pv *SCFilePV) error {
+	lss := pv.State.LastSigned
+	pv.State.LastSigned = config.SignState{
+		Height:    height,
+		Round:     round,
+		Step:      step,
+		Signature: sig,
+		SignBytes: signBytes,
+	}
+	if err := pv.saveState(); err != nil {
+		pv.State.LastSigned = lss
+		return fmt.Errorf("couldn't persist last signed state: %v", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,107 @@
+package privval
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	tm_privval "github.com/tendermint/tendermint/privval"
+	tm_prototypes "github.com/tendermint/tendermint/proto/tendermint/types"
+)
+
+// freshFilePV returns a FilePV with the mock SCFilePV's key and a fresh
+// priv_validator_state.json, like after an operator swapped it.
+func freshFilePV(t *testing.T, pv *SCFilePV) *tm_privval.FilePV {
+	t.Helper()
+	tmpv, ok := pv.TMFilePV.(*tm_privval.FilePV)
+	assert.True(t, ok)
+	dir := t.TempDir()
+
+	return tm_privval.NewFilePV(tmpv.Key.PrivKey, filepath.Join(dir, KeyFile), filepath.Join(dir, StateFile))
+}
+
+func TestVoteToStep(t *testing.T) {
+	step, err := voteToStep(&tm_prototypes.Vote{Type: tm_prototypes.PrevoteType})
+	assert.Equal(t, stepPrevote, step)
+	assert.NoError(t, err)
+
+	step, err = voteToStep(&tm_prototypes.Vote{Type: tm_prototypes.PrecommitType})
+	assert.Equal(t, stepPrecommit, step)
+	assert.NoError(t, err)
+
+	_, err = voteToStep(&tm_prototypes.Vote{Type: tm_prototypes.ProposalType})
+	assert.Error(t, err)
+}
+
+func TestSignVote_Watermark(t *testing.T) {
+	pv := mockSCFilePV(t)
+	pv.TMFilePV = freshFilePV(t, pv)
+
+	// Sign the vote and move the watermark.
+	vote := testVote(t)
+	err := signVote("testchain", vote, pv)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, vote.Signature)
+	assert.Equal(t, vote.Height, pv.State.LastSigned.Height)
+	assert.Equal(t, stepPrecommit, pv.State.LastSigned.Step)
+
+	// Swap in a fresh backend, so only SignCTRL's watermark protects the validator.
+	pv.TMFilePV = freshFilePV(t, pv)
+
+	// The same vote with a different timestamp reuses the last signature.
+	sameVote := *vote
+	sameVote.Signature = nil
+	sameVote.Timestamp = vote.Timestamp.Add(time.Second)
+	err = signVote("testchain", &sameVote, pv)
+	assert.NoError(t, err)
+	assert.Equal(t, vote.Signature, sameVote.Signature)
+	assert.True(t, vote.Timestamp.Equal(sameVote.Timestamp))
+
+	// A vote for a different block at the same HRS is refused.
+	conflictingVote := *vote
+	conflictingVote.Signature = nil
+	conflictingVote.BlockID.Hash = make([]byte, 32)
+	err = signVote("testchain", &conflictingVote, pv)
+	assert.ErrorIs(t, err, ErrDoubleSign)
+	assert.Empty(t, conflictingVote.Signature)
+
+	// A vote that regresses the watermark is refused.
+	prevote := *vote
+	prevote.Type = tm_prototypes.PrevoteType
+	prevote.Signature = nil
+	err = signVote("testchain", &prevote, pv)
+	assert.ErrorIs(t, err, ErrDoubleSign)
+	assert.Empty(t, prevote.Signature)
+}
+
+func TestSignProposal_Watermark(t *testing.T) {
+	pv := mockSCFilePV(t)
+	pv.TMFilePV = freshFilePV(t, pv)
+
+	// Sign the proposal and move the watermark.
+	proposal := testProposal(t)
+	proposal.Signature = nil
+	err := signProposal("testchain", proposal, pv)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, proposal.Signature)
+	assert.Equal(t, stepPropose, pv.State.LastSigned.Step)
+
+	// Swap in a fresh backend, so only SignCTRL's watermark protects the validator.
+	pv.TMFilePV = freshFilePV(t, pv)
+
+	// The same proposal reuses the last signature.
+	sameProposal := *proposal
+	sameProposal.Signature = nil
+	err = signProposal("testchain", &sameProposal, pv)
+	assert.NoError(t, err)
+	assert.Equal(t, proposal.Signature, sameProposal.Signature)
+
+	// A proposal for an earlier round is refused.
+	earlierProposal := *proposal
+	earlierProposal.Round = 0
+	earlierProposal.Signature = nil
+	err = signProposal("testchain", &earlierProposal, pv)
+	assert.ErrorIs(t, err, ErrDoubleSign)
+	assert.Empty(t, earlierProposal.Signature)
+}
@@ -0,0 +1,177 @@
+package privval
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"sync"
+	"time"
+
+	tm_crypto "github.com/tendermint/tendermint/crypto"
+	tm_json "github.com/tendermint/tendermint/libs/json"
+	tm_tempfile "github.com/tendermint/tendermint/libs/tempfile"
+	tm_privval "github.com/tendermint/tendermint/privval"
+	tm_typesproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tm_types "github.com/tendermint/tendermint/types"
+)
+
+// Signer creates ed25519 signatures with a validator key that SignCTRL doesn't hold
+// itself, e.g. because it's kept in an HSM.
+type Signer interface {
+	// PubKey returns the public key of the validator key.
+	PubKey() tm_crypto.PubKey
+
+	// Sign signs the given message with the validator key.
+	Sign(msg []byte) ([]byte, error)
+}
+
+// privKeySigner is a Signer that holds the private key in memory, e.g. after it has
+// been decrypted.
+type privKeySigner struct {
+	privKey tm_crypto.PrivKey
+}
+
+// PubKey returns the public key of the private key.
+// Implements the Signer interface.
+func (s privKeySigner) PubKey() tm_crypto.PubKey {
+	return s.privKey.PubKey()
+}
+
+// Sign signs the given message with the private key.
+// Implements the Signer interface.
+func (s privKeySigner) Sign(msg []byte) ([]byte, error) {
+	return s.privKey.Sign(msg)
+}
+
+// signerPV is a tm_types.PrivValidator that signs votes and proposals with a Signer.
+// The height, round and step (HRS) of the last signature are kept in a local state
+// file in the same format as the priv_validator_state.json of tm_privval.FilePV, and
+// are checked the same way before anything is signed.
+type signerPV struct {
+	mtx       sync.Mutex
+	signer    Signer
+	lss       tm_privval.FilePVLastSignState
+	stateFile string
+}
+
+// newSignerPV loads the state file at the given path, or creates it if it doesn't
+// exist.
+func newSignerPV(signer Signer, stateFile string) (*signerPV, error) {
+	pv := &signerPV{signer: signer, stateFile: stateFile}
+	data, err := ioutil.ReadFile(stateFile)
+	switch {
+	case os.IsNotExist(err):
+		if err := pv.saveState(); err != nil {
+			return nil, err
+		}
+	case err != nil:
+		return nil, err
+	default:
+		if err := tm_json.Unmarshal(data, &pv.lss); err != nil {
+			return nil, fmt.Errorf("couldn't unmarshal %v: %v", stateFile, err)
+		}
+	}
+
+	return pv, nil
+}
+
+// saveState persists the last sign state.
+func (pv *signerPV) saveState() error {
+	data, err := tm_json.MarshalIndent(pv.lss, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return tm_tempfile.WriteFileAtomic(pv.stateFile, data, 0600)
+}
+
+// GetPubKey returns the public key of the validator key.
+// Implements the tm_types.PrivValidator interface.
+func (pv *signerPV) GetPubKey() (tm_crypto.PubKey, error) {
+	return pv.signer.PubKey(), nil
+}
+
+// SignVote signs the given vote, unless it regresses the last signed HRS.
+// Implements the tm_types.PrivValidator interface.
+func (pv *signerPV) SignVote(chainID string, vote *tm_typesproto.Vote) error {
+	step, err := voteToStep(vote)
+	if err != nil {
+		return err
+	}
+
+	sig, ts, err := pv.signHRS(vote.Height, vote.Round, step, tm_types.VoteSignBytes(chainID, vote), votesOnlyDifferByTimestamp)
+	if err != nil {
+		return err
+	}
+	if !ts.IsZero() {
+		vote.Timestamp = ts
+	}
+	vote.Signature = sig
+
+	return nil
+}
+
+// SignProposal signs the given proposal, unless it regresses the last signed HRS.
+// Implements the tm_types.PrivValidator interface.
+func (pv *signerPV) SignProposal(chainID string, proposal *tm_typesproto.Proposal) error {
+	sig, ts, err := pv.signHRS(proposal.Height, proposal.Round, stepPropose, tm_types.ProposalSignBytes(chainID, proposal), proposalsOnlyDifferByTimestamp)
+	if err != nil {
+		return err
+	}
+	if !ts.IsZero() {
+		proposal.Timestamp = ts
+	}
+	proposal.Signature = sig
+
+	return nil
+}
+
+// signHRS signs the given sign bytes at the given height, round and step. If they
+// have already been signed, the last signature is reused, provided the sign bytes
+// only differ from the last ones by their timestamp. In that case, the last timestamp
+// is returned as well. The state file is saved before the signature is released.
+func (pv *signerPV) signHRS(height int64, round int32, step int8, signBytes []byte, onlyDifferByTimestamp func(last, new []byte) (time.Time, bool)) ([]byte, time.Time, error) {
+	pv.mtx.Lock()
+	defer pv.mtx.Unlock()
+
+	sameHRS, err := pv.lss.CheckHRS(height, round, step)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	if sameHRS {
+		if bytes.Equal(signBytes, pv.lss.SignBytes) {
+			return pv.lss.Signature, time.Time{}, nil
+		}
+		if ts, ok := onlyDifferByTimestamp(pv.lss.SignBytes, signBytes); ok {
+			return pv.lss.Signature, ts, nil
+		}
+		return nil, time.Time{}, fmt.Errorf("conflicting data at height %v round %v step %v", height, round, step)
+	}
+
+	sig, err := pv.signer.Sign(signBytes)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+
+	lss := pv.lss
+	pv.lss.Height, pv.lss.Round, pv.lss.Step = height, round, step
+	pv.lss.Signature, pv.lss.SignBytes = sig, signBytes
+	if err := pv.saveState(); err != nil {
+		pv.lss = lss
+		return nil, time.Time{}, fmt.Errorf("couldn't persist last sign state: %v", err)
+	}
+
+	return sig, time.Time{}, nil
+}
+
+// Close closes the Signer if it holds any resources.
+// Implements the io.Closer interface.
+func (pv *signerPV) Close() error {
+	if c, ok := pv.signer.(io.Closer); ok {
+		return c.Close()
+	}
+
+	return nil
+}
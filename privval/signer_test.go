@@ -0,0 +1,99 @@
+package privval
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	tm_ed25519 "github.com/tendermint/tendermint/crypto/ed25519"
+	tm_privval "github.com/tendermint/tendermint/privval"
+	tm_prototypes "github.com/tendermint/tendermint/proto/tendermint/types"
+	tm_types "github.com/tendermint/tendermint/types"
+)
+
+func TestSignerPV_SignVote(t *testing.T) {
+	signer := privKeySigner{tm_ed25519.GenPrivKey()}
+	stateFile := filepath.Join(t.TempDir(), StateFile)
+	pv, err := newSignerPV(signer, stateFile)
+	assert.NoError(t, err)
+	assert.FileExists(t, stateFile)
+
+	vote := testVote(t)
+	err = pv.SignVote("testchain", vote)
+	assert.NoError(t, err)
+	assert.True(t, signer.PubKey().VerifySignature(tm_types.VoteSignBytes("testchain", vote), vote.Signature))
+
+	// The same vote with a different timestamp reuses the last signature.
+	sameVote := *vote
+	sameVote.Signature = nil
+	sameVote.Timestamp = vote.Timestamp.Add(time.Second)
+	err = pv.SignVote("testchain", &sameVote)
+	assert.NoError(t, err)
+	assert.Equal(t, vote.Signature, sameVote.Signature)
+	assert.True(t, vote.Timestamp.Equal(sameVote.Timestamp))
+
+	// The HRS survives a restart, so a conflicting vote is refused afterwards.
+	pv, err = newSignerPV(signer, stateFile)
+	assert.NoError(t, err)
+	conflictingVote := *vote
+	conflictingVote.Signature = nil
+	conflictingVote.BlockID.Hash = make([]byte, 32)
+	err = pv.SignVote("testchain", &conflictingVote)
+	assert.Error(t, err)
+	assert.Empty(t, conflictingVote.Signature)
+
+	// A vote that regresses the HRS is refused.
+	prevote := *vote
+	prevote.Type = tm_prototypes.PrevoteType
+	prevote.Signature = nil
+	err = pv.SignVote("testchain", &prevote)
+	assert.Error(t, err)
+	assert.Empty(t, prevote.Signature)
+}
+
+func TestSignerPV_SignProposal(t *testing.T) {
+	pv, err := newSignerPV(privKeySigner{tm_ed25519.GenPrivKey()}, filepath.Join(t.TempDir(), StateFile))
+	assert.NoError(t, err)
+
+	proposal := testProposal(t)
+	proposal.Signature = nil
+	err = pv.SignProposal("testchain", proposal)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, proposal.Signature)
+
+	// A vote at the same height and round comes after the proposal.
+	vote := testVote(t)
+	vote.Height, vote.Round = proposal.Height, proposal.Round
+	err = pv.SignVote("testchain", vote)
+	assert.NoError(t, err)
+
+	proposal.Signature = nil
+	err = pv.SignProposal("testchain", proposal)
+	assert.Error(t, err)
+	assert.Empty(t, proposal.Signature)
+}
+
+func TestSignerPV_FilePVState(t *testing.T) {
+	dir := t.TempDir()
+	key := tm_ed25519.GenPrivKey()
+
+	// Sign with a FilePV first, like a validator that is migrated to another backend.
+	filePV := tm_privval.NewFilePV(key, filepath.Join(dir, KeyFile), filepath.Join(dir, StateFile))
+	filePV.Save()
+	vote := testVote(t)
+	err := filePV.SignVote("testchain", vote)
+	assert.NoError(t, err)
+
+	// The signerPV picks up the HRS from the priv_validator_state.json.
+	pv, err := newSignerPV(privKeySigner{key}, filepath.Join(dir, StateFile))
+	assert.NoError(t, err)
+	assert.Equal(t, filePV.LastSignState.Height, pv.lss.Height)
+	assert.Equal(t, filePV.LastSignState.SignBytes, pv.lss.SignBytes)
+
+	prevote := *vote
+	prevote.Type = tm_prototypes.PrevoteType
+	prevote.Signature = nil
+	err = pv.SignVote("testchain", &prevote)
+	assert.Error(t, err)
+}
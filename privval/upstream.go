@@ -0,0 +1,156 @@
+package privval
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/BlockscapeNetwork/signctrl/connection"
+	"github.com/BlockscapeNetwork/signctrl/types"
+	tm_crypto "github.com/tendermint/tendermint/crypto"
+	tm_log "github.com/tendermint/tendermint/libs/log"
+	tm_privval "github.com/tendermint/tendermint/privval"
+	tm_typesproto "github.com/tendermint/tendermint/proto/tendermint/types"
+	tm_types "github.com/tendermint/tendermint/types"
+)
+
+const (
+	// BackendUpstream is the name of the signing backend that forwards sign requests
+	// to an upstream signer like tmkms or horcrux.
+	BackendUpstream = "upstream"
+
+	// upstreamConnectTimeout is the time SignCTRL waits for the upstream signer to
+	// connect on startup.
+	upstreamConnectTimeout = time.Minute
+
+	// upstreamRetries is the number of attempts for a request to the upstream signer
+	// if the connection fails. Errors returned by the upstream signer aren't retried.
+	upstreamRetries = 3
+
+	// upstreamRetryWait is the time between two attempts.
+	upstreamRetryWait = 100 * time.Millisecond
+)
+
+var (
+	// ErrInvalidUpstreamSignature is returned if the upstream signer returns a signature
+	// that doesn't match the public key it reported on startup.
+	ErrInvalidUpstreamSignature = errors.New("invalid signature from upstream signer")
+)
+
+func init() {
+	RegisterBackend(BackendUpstream, newUpstreamBackend)
+}
+
+// newUpstreamBackend listens for the upstream signer specified in the [privval.upstream]
+// section of the config.toml and waits for it to connect.
+func newUpstreamBackend(cfgDir string, cfg config.Config, logger *types.SyncLogger) (tm_types.PrivValidator, error) {
+	listener, err := connection.Listen(cfg.Privval.Upstream.ListenAddress)
+	if err != nil {
+		return nil, err
+	}
+	if listener.Addr().Network() == "tcp" {
+		connKey, err := connection.LoadConnKey(cfgDir)
+		if err != nil {
+			listener.Close()
+			return nil, fmt.Errorf("couldn't load conn.key: %v", err)
+		}
+		if len(cfg.Privval.Upstream.ConnPubKeys) == 0 {
+			logger.Warn("No upstream.conn_pubkeys pinned, accepting upstream signers with any public key")
+		}
+		listener = connection.NewSecretListener(listener, connKey, cfg.Privval.Upstream.ConnPubKeys, logger)
+	}
+
+	logger.Info("Waiting for the upstream signer to connect to %v...", listener.Addr())
+	pv, err := newUpstreamPV(listener, cfg.Privval.ChainID, cfg.Privval.Upstream.GetTimeout(), upstreamConnectTimeout)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Connected to the upstream signer ✓")
+
+	return pv, nil
+}
+
+// upstreamPV is a tm_types.PrivValidator that forwards sign requests to an upstream
+// signer over the privval protocol, just like a validator does with its remote signer.
+// SignCTRL only passes sign requests on to its PrivValidator on rank 1, so the upstream
+// signer is never asked to sign by the backups. The signatures it returns are verified
+// with the public key it reported on startup.
+type upstreamPV struct {
+	endpoint *tm_privval.SignerListenerEndpoint
+	client   *tm_privval.RetrySignerClient
+	pubKey   tm_crypto.PubKey
+}
+
+// newUpstreamPV serves the privval protocol on the given listener and waits for the
+// upstream signer to connect and report its public key.
+func newUpstreamPV(listener net.Listener, chainID string, timeout, connectTimeout time.Duration) (*upstreamPV, error) {
+	endpoint := tm_privval.NewSignerListenerEndpoint(
+		tm_log.NewNopLogger(),
+		listener,
+		tm_privval.SignerListenerEndpointTimeoutReadWrite(timeout),
+	)
+	client, err := tm_privval.NewSignerClient(endpoint, chainID)
+	if err != nil {
+		listener.Close()
+		return nil, err
+	}
+	pv := &upstreamPV{
+		endpoint: endpoint,
+		client:   tm_privval.NewRetrySignerClient(client, upstreamRetries, upstreamRetryWait),
+	}
+	if err := client.WaitForConnection(connectTimeout); err != nil {
+		pv.Close()
+		return nil, fmt.Errorf("upstream signer didn't connect: %v", err)
+	}
+	if pv.pubKey, err = pv.client.GetPubKey(); err != nil {
+		pv.Close()
+		return nil, fmt.Errorf("couldn't get public key from upstream signer: %v", err)
+	}
+
+	return pv, nil
+}
+
+// GetPubKey returns the public key the upstream signer reported on startup.
+// Implements the tm_types.PrivValidator interface.
+func (pv *upstreamPV) GetPubKey() (tm_crypto.PubKey, error) {
+	return pv.pubKey, nil
+}
+
+// SignVote forwards the vote to the upstream signer.
+// Implements the tm_types.PrivValidator interface.
+func (pv *upstreamPV) SignVote(chainID string, vote *tm_typesproto.Vote) error {
+	if err := pv.client.SignVote(chainID, vote); err != nil {
+		return err
+	}
+
+	// The upstream signer may have altered the vote's timestamp, so the sign bytes
+	// must be built after signing.
+	if !pv.pubKey.VerifySignature(tm_types.VoteSignBytes(chainID, vote), vote.Signature) {
+		vote.Signature = nil
+		return ErrInvalidUpstreamSignature
+	}
+
+	return nil
+}
+
+// SignProposal forwards the proposal to the upstream signer.
+// Implements the tm_types.PrivValidator interface.
+func (pv *upstreamPV) SignProposal(chainID string, proposal *tm_typesproto.Proposal) error {
+	if err := pv.client.SignProposal(chainID, proposal); err != nil {
+		return err
+	}
+	if !pv.pubKey.VerifySignature(tm_types.ProposalSignBytes(chainID, proposal), proposal.Signature) {
+		proposal.Signature = nil
+		return ErrInvalidUpstreamSignature
+	}
+
+	return nil
+}
+
+// Close closes the connection to the upstream signer and stops listening.
+// Implements the io.Closer interface.
+func (pv *upstreamPV) Close() error {
+	return pv.endpoint.Stop()
+}
@@ -0,0 +1,105 @@
+package privval
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/BlockscapeNetwork/signctrl/connection"
+	"github.com/BlockscapeNetwork/signctrl/types"
+	"github.com/stretchr/testify/assert"
+	tm_crypto "github.com/tendermint/tendermint/crypto"
+	tm_ed25519 "github.com/tendermint/tendermint/crypto/ed25519"
+	tm_log "github.com/tendermint/tendermint/libs/log"
+	tm_privval "github.com/tendermint/tendermint/privval"
+	tm_types "github.com/tendermint/tendermint/types"
+)
+
+// startUpstreamSigner starts a remote signer that dials SignCTRL like tmkms or horcrux
+// and signs with the given PrivValidator.
+func startUpstreamSigner(t *testing.T, dialer tm_privval.SocketDialer, privVal tm_types.PrivValidator) *tm_privval.SignerServer {
+	t.Helper()
+	endpoint := tm_privval.NewSignerDialerEndpoint(tm_log.NewNopLogger(), dialer, tm_privval.SignerDialerEndpointConnRetries(100))
+	server := tm_privval.NewSignerServer(endpoint, "testchain", privVal)
+	assert.NoError(t, server.Start())
+
+	return server
+}
+
+// lyingPV reports the public key of one key, but signs with another one.
+type lyingPV struct {
+	tm_types.MockPV
+	pubKey tm_crypto.PubKey
+}
+
+func (pv lyingPV) GetPubKey() (tm_crypto.PubKey, error) {
+	return pv.pubKey, nil
+}
+
+func TestUpstreamBackend(t *testing.T) {
+	dir := t.TempDir()
+	assert.NoError(t, connection.CreateBase64ConnKey(dir))
+	port, _ := getFreePort(t)
+	laddr := fmt.Sprintf("127.0.0.1:%v", port)
+
+	// The upstream signer's connection key is pinned.
+	signerKey := tm_ed25519.GenPrivKey()
+	mockPV := tm_types.NewMockPV()
+	server := startUpstreamSigner(t, tm_privval.DialTCPFn(laddr, time.Second, signerKey), mockPV)
+	defer server.Stop()
+
+	cfg := testConfig(t)
+	cfg.Privval.Backend = BackendUpstream
+	cfg.Privval.Upstream.ListenAddress = "tcp://" + laddr
+	cfg.Privval.Upstream.ConnPubKeys = []string{connection.KeyID(signerKey.PubKey())}
+	backend, err := NewBackend(dir, cfg, types.NewSyncLogger(ioutil.Discard, "", 0))
+	assert.NoError(t, err)
+	defer backend.(*upstreamPV).Close()
+
+	pub, err := backend.GetPubKey()
+	assert.NoError(t, err)
+	assert.Equal(t, mockPV.PrivKey.PubKey(), pub)
+
+	vote := testVote(t)
+	assert.NoError(t, backend.SignVote("testchain", vote))
+	assert.True(t, pub.VerifySignature(tm_types.VoteSignBytes("testchain", vote), vote.Signature))
+
+	proposal := testProposal(t)
+	proposal.Signature = nil
+	assert.NoError(t, backend.SignProposal("testchain", proposal))
+	assert.True(t, pub.VerifySignature(tm_types.ProposalSignBytes("testchain", proposal), proposal.Signature))
+
+	// Errors returned by the upstream signer are passed on.
+	err = backend.SignVote("otherchain", testVote(t))
+	assert.Error(t, err)
+}
+
+func TestUpstreamPV_InvalidSignature(t *testing.T) {
+	addr := filepath.Join(t.TempDir(), "upstream.sock")
+	listener, err := net.Listen("unix", addr)
+	assert.NoError(t, err)
+
+	privVal := lyingPV{MockPV: tm_types.NewMockPV(), pubKey: tm_ed25519.GenPrivKey().PubKey()}
+	server := startUpstreamSigner(t, tm_privval.DialUnixFn(addr), privVal)
+	defer server.Stop()
+
+	pv, err := newUpstreamPV(listener, "testchain", time.Second, 10*time.Second)
+	assert.NoError(t, err)
+	defer pv.Close()
+
+	vote := testVote(t)
+	err = pv.SignVote("testchain", vote)
+	assert.ErrorIs(t, err, ErrInvalidUpstreamSignature)
+	assert.Empty(t, vote.Signature)
+}
+
+func TestUpstreamPV_NoConnection(t *testing.T) {
+	listener, err := net.Listen("unix", filepath.Join(t.TempDir(), "upstream.sock"))
+	assert.NoError(t, err)
+
+	_, err = newUpstreamPV(listener, "testchain", time.Second, 100*time.Millisecond)
+	assert.Error(t, err)
+}
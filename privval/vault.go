@@ -0,0 +1,285 @@
+package privval
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/BlockscapeNetwork/signctrl/types"
+	tm_crypto "github.com/tendermint/tendermint/crypto"
+	tm_ed25519 "github.com/tendermint/tendermint/crypto/ed25519"
+	tm_types "github.com/tendermint/tendermint/types"
+)
+
+const (
+	// BackendVault is the name of the signing backend that signs with a key in Vault's
+	// Transit secrets engine and keeps its state in the priv_validator_state.json.
+	BackendVault = "vault"
+
+	// vaultTimeout is the timeout for requests to Vault.
+	vaultTimeout = 5 * time.Second
+)
+
+var (
+	// errVaultForbidden is returned if Vault rejects the token.
+	errVaultForbidden = errors.New("permission denied")
+)
+
+func init() {
+	RegisterBackend(BackendVault, newVaultBackend)
+}
+
+// newVaultBackend connects to the Vault server specified in the [privval.vault]
+// section of the config.toml and keeps the state in the priv_validator_state.json.
+func newVaultBackend(cfgDir string, cfg config.Config, logger *types.SyncLogger) (tm_types.PrivValidator, error) {
+	signer, err := NewVaultSigner(cfg.Privval.Vault)
+	if err != nil {
+		return nil, err
+	}
+	logger.Info("Signing with version %v of Vault Transit key %q", signer.version, cfg.Privval.Vault.KeyName)
+
+	return newSignerPV(signer, StateFilePath(cfgDir))
+}
+
+// VaultSigner signs messages with an ed25519 key in Vault's Transit secrets engine.
+// It always signs with the key version that was the latest one when it was created,
+// so a key rotation in Vault doesn't change the validator's key.
+type VaultSigner struct {
+	mtx     sync.Mutex
+	cfg     config.Vault
+	client  *http.Client
+	token   string
+	version int
+	pubKey  tm_ed25519.PubKey
+}
+
+// NewVaultSigner authenticates with Vault and fetches the public key of the latest
+// version of the configured key.
+func NewVaultSigner(cfg config.Vault) (*VaultSigner, error) {
+	tlsConfig, err := vaultTLSConfig(cfg)
+	if err != nil {
+		return nil, err
+	}
+	s := &VaultSigner{
+		cfg: cfg,
+		client: &http.Client{
+			Timeout:   vaultTimeout,
+			Transport: &http.Transport{TLSClientConfig: tlsConfig},
+		},
+	}
+	if err := s.login(); err != nil {
+		return nil, err
+	}
+	if err := s.fetchPubKey(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// vaultTLSConfig returns the TLS config for the connection to Vault.
+func vaultTLSConfig(cfg config.Vault) (*tls.Config, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.CACert != "" {
+		pem, err := ioutil.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't read ca_cert: %v", err)
+		}
+		tlsConfig.RootCAs = x509.NewCertPool()
+		if !tlsConfig.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %v", cfg.CACert)
+		}
+	}
+	if cfg.ClientCert != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.ClientCert, cfg.ClientKey)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't load client_cert: %v", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
+}
+
+// readSecretFile reads a token or secret ID from the given file.
+func readSecretFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	secret := strings.TrimSpace(string(data))
+	if secret == "" {
+		return "", fmt.Errorf("%v is empty", path)
+	}
+
+	return secret, nil
+}
+
+// login obtains a Vault token, either from the token file or via AppRole. Both are
+// read again on every login, so they can be rotated, e.g. by a Vault agent.
+func (s *VaultSigner) login() error {
+	if s.cfg.TokenFile != "" {
+		token, err := readSecretFile(s.cfg.TokenFile)
+		if err != nil {
+			return fmt.Errorf("couldn't read token_file: %v", err)
+		}
+		s.token = token
+		return nil
+	}
+
+	secretID, err := readSecretFile(s.cfg.SecretIDFile)
+	if err != nil {
+		return fmt.Errorf("couldn't read secret_id_file: %v", err)
+	}
+	var res struct {
+		Auth struct {
+			ClientToken string `json:"client_token"`
+		} `json:"auth"`
+	}
+	s.token = ""
+	if err := s.request(http.MethodPost, "auth/approle/login", map[string]string{"role_id": s.cfg.RoleID, "secret_id": secretID}, &res); err != nil {
+		return fmt.Errorf("couldn't log into Vault via AppRole: %v", err)
+	}
+	if res.Auth.ClientToken == "" {
+		return errors.New("couldn't log into Vault via AppRole: no client token returned")
+	}
+	s.token = res.Auth.ClientToken
+
+	return nil
+}
+
+// fetchPubKey fetches the public key of the latest key version.
+func (s *VaultSigner) fetchPubKey() error {
+	var res struct {
+		Data struct {
+			Type          string `json:"type"`
+			LatestVersion int    `json:"latest_version"`
+			Keys          map[string]struct {
+				PublicKey string `json:"public_key"`
+			} `json:"keys"`
+		} `json:"data"`
+	}
+	if err := s.request(http.MethodGet, fmt.Sprintf("%v/keys/%v", s.cfg.GetMount(), s.cfg.KeyName), nil, &res); err != nil {
+		return fmt.Errorf("couldn't read Vault Transit key %q: %v", s.cfg.KeyName, err)
+	}
+	if res.Data.Type != "ed25519" {
+		return fmt.Errorf("Vault Transit key %q must be of type ed25519, not %q", s.cfg.KeyName, res.Data.Type)
+	}
+
+	key, ok := res.Data.Keys[strconv.Itoa(res.Data.LatestVersion)]
+	if !ok {
+		return fmt.Errorf("Vault Transit key %q has no version %v", s.cfg.KeyName, res.Data.LatestVersion)
+	}
+	pubKey, err := base64.StdEncoding.DecodeString(key.PublicKey)
+	if err != nil || len(pubKey) != tm_ed25519.PubKeySize {
+		return fmt.Errorf("invalid public key of Vault Transit key %q", s.cfg.KeyName)
+	}
+	s.version, s.pubKey = res.Data.LatestVersion, pubKey
+
+	return nil
+}
+
+// request sends a request with the given JSON body to the given Vault API path and
+// decodes the JSON response into res.
+func (s *VaultSigner) request(method, path string, body, res interface{}) error {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		if reqBody, err = json.Marshal(body); err != nil {
+			return err
+		}
+	}
+	req, err := http.NewRequest(method, fmt.Sprintf("%v/v1/%v", strings.TrimRight(s.cfg.Address, "/"), path), bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	if s.token != "" {
+		req.Header.Set("X-Vault-Token", s.token)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	switch {
+	case resp.StatusCode == http.StatusForbidden:
+		return errVaultForbidden
+	case resp.StatusCode != http.StatusOK:
+		var vaultErr struct {
+			Errors []string `json:"errors"`
+		}
+		json.NewDecoder(resp.Body).Decode(&vaultErr)
+		return fmt.Errorf("%v: %v", resp.Status, strings.Join(vaultErr.Errors, ", "))
+	}
+
+	return json.NewDecoder(resp.Body).Decode(res)
+}
+
+// PubKey returns the public key of the key version used for signing.
+// Implements the Signer interface.
+func (s *VaultSigner) PubKey() tm_crypto.PubKey {
+	return s.pubKey
+}
+
+// Sign signs the given message via the Transit sign endpoint. If the token has been
+// revoked or has expired, the signer logs in again and retries once. The signature
+// is verified before it is returned.
+// Implements the Signer interface.
+func (s *VaultSigner) Sign(msg []byte) ([]byte, error) {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	sig, err := s.sign(msg)
+	if errors.Is(err, errVaultForbidden) {
+		if err := s.login(); err != nil {
+			return nil, err
+		}
+		sig, err = s.sign(msg)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("couldn't sign with Vault Transit key %q: %v", s.cfg.KeyName, err)
+	}
+	if !s.pubKey.VerifySignature(msg, sig) {
+		return nil, fmt.Errorf("invalid signature from Vault Transit key %q", s.cfg.KeyName)
+	}
+
+	return sig, nil
+}
+
+// sign sends the message to the Transit sign endpoint and decodes the signature.
+func (s *VaultSigner) sign(msg []byte) ([]byte, error) {
+	var res struct {
+		Data struct {
+			Signature string `json:"signature"`
+		} `json:"data"`
+	}
+	body := map[string]interface{}{
+		"input":       base64.StdEncoding.EncodeToString(msg),
+		"key_version": s.version,
+	}
+	if err := s.request(http.MethodPost, fmt.Sprintf("%v/sign/%v", s.cfg.GetMount(), s.cfg.KeyName), body, &res); err != nil {
+		return nil, err
+	}
+
+	// Signatures are formatted as vault:v<version>:<base64 signature>.
+	parts := strings.Split(res.Data.Signature, ":")
+	if len(parts) != 3 || parts[0] != "vault" || parts[1] != fmt.Sprintf("v%v", s.version) {
+		return nil, fmt.Errorf("unexpected signature format %q", res.Data.Signature)
+	}
+
+	return base64.StdEncoding.DecodeString(parts[2])
+}
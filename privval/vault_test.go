@@ -0,0 +1,199 @@
+package privval
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/BlockscapeNetwork/signctrl/config"
+	"github.com/BlockscapeNetwork/signctrl/types"
+	"github.com/stretchr/testify/assert"
+	tm_ed25519 "github.com/tendermint/tendermint/crypto/ed25519"
+	tm_prototypes "github.com/tendermint/tendermint/proto/tendermint/types"
+	tm_types "github.com/tendermint/tendermint/types"
+)
+
+// transitStandIn emulates the AppRole login and the Transit endpoints of a Vault
+// server with a single ed25519 key named "validator".
+type transitStandIn struct {
+	mtx      sync.Mutex
+	keys     []tm_ed25519.PrivKey
+	token    string
+	logins   int
+	signs    int
+	secretID string
+}
+
+func newTransitStandIn() *transitStandIn {
+	return &transitStandIn{
+		keys:     []tm_ed25519.PrivKey{tm_ed25519.GenPrivKey()},
+		token:    "s.token",
+		secretID: "secret",
+	}
+}
+
+// update changes the stand-in's state between requests.
+func (v *transitStandIn) update(f func()) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	f()
+}
+
+func (v *transitStandIn) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	var body map[string]interface{}
+	json.NewDecoder(r.Body).Decode(&body)
+
+	if r.URL.Path == "/v1/auth/approle/login" {
+		if body["role_id"] != "role" || body["secret_id"] != v.secretID {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		v.logins++
+		v.token = fmt.Sprintf("s.approle%v", v.logins)
+		json.NewEncoder(w).Encode(map[string]interface{}{"auth": map[string]interface{}{"client_token": v.token}})
+		return
+	}
+	if r.Header.Get("X-Vault-Token") != v.token {
+		w.WriteHeader(http.StatusForbidden)
+		json.NewEncoder(w).Encode(map[string]interface{}{"errors": []string{"permission denied"}})
+		return
+	}
+
+	switch r.URL.Path {
+	case "/v1/transit/keys/validator":
+		keys := map[string]interface{}{}
+		for i, k := range v.keys {
+			keys[fmt.Sprint(i+1)] = map[string]interface{}{"public_key": base64.StdEncoding.EncodeToString(k.PubKey().Bytes())}
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+			"type":           "ed25519",
+			"latest_version": len(v.keys),
+			"keys":           keys,
+		}})
+	case "/v1/transit/sign/validator":
+		version := int(body["key_version"].(float64))
+		input, _ := base64.StdEncoding.DecodeString(body["input"].(string))
+		sig, _ := v.keys[version-1].Sign(input)
+		v.signs++
+		json.NewEncoder(w).Encode(map[string]interface{}{"data": map[string]interface{}{
+			"signature": fmt.Sprintf("vault:v%v:%v", version, base64.StdEncoding.EncodeToString(sig)),
+		}})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// writeSecret writes the given secret to a file and returns its path.
+func writeSecret(t *testing.T, secret string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "secret")
+	assert.NoError(t, ioutil.WriteFile(path, []byte(secret+"\n"), 0600))
+
+	return path
+}
+
+func TestVaultSigner_Token(t *testing.T) {
+	vault := newTransitStandIn()
+	srv := httptest.NewServer(vault)
+	defer srv.Close()
+
+	tokenFile := writeSecret(t, "s.token")
+	signer, err := NewVaultSigner(config.Vault{Address: srv.URL, KeyName: "validator", TokenFile: tokenFile})
+	assert.NoError(t, err)
+	assert.Equal(t, vault.keys[0].PubKey(), signer.PubKey())
+
+	sig, err := signer.Sign([]byte("msg"))
+	assert.NoError(t, err)
+	assert.True(t, signer.PubKey().VerifySignature([]byte("msg"), sig))
+
+	// A rotated key in Vault doesn't change the validator's key.
+	vault.update(func() { vault.keys = append(vault.keys, tm_ed25519.GenPrivKey()) })
+	sig, err = signer.Sign([]byte("msg"))
+	assert.NoError(t, err)
+	assert.True(t, vault.keys[0].PubKey().VerifySignature([]byte("msg"), sig))
+
+	// A revoked token is read from the token file again.
+	vault.update(func() { vault.token = "s.rotated" })
+	assert.NoError(t, ioutil.WriteFile(tokenFile, []byte("s.rotated"), 0600))
+	_, err = signer.Sign([]byte("msg"))
+	assert.NoError(t, err)
+
+	vault.update(func() { vault.token = "s.revoked" })
+	_, err = signer.Sign([]byte("msg"))
+	assert.Error(t, err)
+
+	_, err = NewVaultSigner(config.Vault{Address: srv.URL, KeyName: "unknown", TokenFile: tokenFile})
+	assert.Error(t, err)
+}
+
+func TestVaultSigner_AppRole(t *testing.T) {
+	vault := newTransitStandIn()
+	srv := httptest.NewServer(vault)
+	defer srv.Close()
+
+	cfg := config.Vault{Address: srv.URL, KeyName: "validator", RoleID: "role", SecretIDFile: writeSecret(t, "secret")}
+	signer, err := NewVaultSigner(cfg)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, vault.logins)
+
+	// An expired token is replaced by logging in again.
+	vault.update(func() { vault.token = "s.expired" })
+	sig, err := signer.Sign([]byte("msg"))
+	assert.NoError(t, err)
+	assert.True(t, signer.PubKey().VerifySignature([]byte("msg"), sig))
+	assert.Equal(t, 2, vault.logins)
+
+	cfg.SecretIDFile = writeSecret(t, "wrong")
+	_, err = NewVaultSigner(cfg)
+	assert.Error(t, err)
+}
+
+func TestVaultSigner_TLS(t *testing.T) {
+	vault := newTransitStandIn()
+	srv := httptest.NewTLSServer(vault)
+	defer srv.Close()
+
+	cfg := config.Vault{Address: srv.URL, KeyName: "validator", TokenFile: writeSecret(t, "s.token")}
+	_, err := NewVaultSigner(cfg)
+	assert.Error(t, err)
+
+	cfg.CACert = writeSecret(t, string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: srv.Certificate().Raw})))
+	_, err = NewVaultSigner(cfg)
+	assert.NoError(t, err)
+}
+
+func TestVaultBackend(t *testing.T) {
+	vault := newTransitStandIn()
+	srv := httptest.NewServer(vault)
+	defer srv.Close()
+
+	dir := t.TempDir()
+	cfg := testConfig(t)
+	cfg.Privval.Backend = BackendVault
+	cfg.Privval.Vault = config.Vault{Address: srv.URL, KeyName: "validator", TokenFile: writeSecret(t, "s.token")}
+	backend, err := NewBackend(dir, cfg, types.NewSyncLogger(ioutil.Discard, "", 0))
+	assert.NoError(t, err)
+
+	vote := testVote(t)
+	assert.NoError(t, backend.SignVote("testchain", vote))
+	assert.True(t, vault.keys[0].PubKey().VerifySignature(tm_types.VoteSignBytes("testchain", vote), vote.Signature))
+	assert.FileExists(t, StateFilePath(dir))
+
+	// The double-signing checks are done locally, without asking Vault.
+	signs := vault.signs
+	prevote := *vote
+	prevote.Type = tm_prototypes.PrevoteType
+	prevote.Signature = nil
+	assert.Error(t, backend.SignVote("testchain", &prevote))
+	assert.Equal(t, signs, vault.signs)
+}
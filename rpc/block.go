@@ -6,7 +6,9 @@ import (
 	"io/ioutil"
 	"net/http"
 	"regexp"
+	"time"
 
+	"github.com/BlockscapeNetwork/signctrl/metrics"
 	"github.com/BlockscapeNetwork/signctrl/types"
 	tm_json "github.com/tendermint/tendermint/libs/json"
 	tm_coretypes "github.com/tendermint/tendermint/rpc/core/types"
@@ -27,8 +29,17 @@ type resultChannelResponse struct {
 	err    error
 }
 
-// QueryBlock gets the block for the specified height.
-func QueryBlock(ctx context.Context, rpcladdr string, height int64, logger *types.SyncLogger) (*tm_coretypes.ResultBlock, error) {
+// QueryBlock gets the block for the specified height. The query's latency and
+// failures are reported to the given metrics.
+func QueryBlock(ctx context.Context, rpcladdr string, height int64, logger *types.SyncLogger, m *metrics.Metrics) (rb *tm_coretypes.ResultBlock, err error) {
+	start := time.Now()
+	defer func() {
+		m.QueryBlockLatency.Observe(time.Since(start).Seconds())
+		if err != nil {
+			m.QueryBlockFailures.Inc()
+		}
+	}()
+
 	if height < 1 {
 		return nil, fmt.Errorf("block height %v does not exist", height)
 	}
@@ -36,7 +47,7 @@ func QueryBlock(ctx context.Context, rpcladdr string, height int64, logger *type
 	// Cut the protocol from rpcladdr.
 	rpcladdrHostPort := regexp.MustCompile(`(tcp|unix)://`).ReplaceAllString(rpcladdr, "")
 	url := fmt.Sprintf("http://%v/block?height=%v", rpcladdrHostPort, height)
-	resultCh := make(chan *resultChannelResponse)
+	resultCh := make(chan *resultChannelResponse, 1)
 
 	go func() {
 		// Query the block.
@@ -51,6 +62,7 @@ func QueryBlock(ctx context.Context, rpcladdr string, height int64, logger *type
 			resultCh <- &resultChannelResponse{nil, err}
 			return
 		}
+		defer resp.Body.Close()
 
 		// Read from the response body.
 		bytes, err := ioutil.ReadAll(resp.Body)
@@ -64,8 +76,8 @@ func QueryBlock(ctx context.Context, rpcladdr string, height int64, logger *type
 			resultCh <- &resultChannelResponse{nil, err}
 			return
 		}
-		if block.Result == nil {
-			resultCh <- &resultChannelResponse{nil, err}
+		if block.Result == nil || block.Result.Block == nil {
+			resultCh <- &resultChannelResponse{nil, fmt.Errorf("no block found for height %v", height)}
 			return
 		}
 
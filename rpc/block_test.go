@@ -9,7 +9,9 @@ import (
 	"strings"
 	"testing"
 
+	"github.com/BlockscapeNetwork/signctrl/metrics"
 	"github.com/BlockscapeNetwork/signctrl/types"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/assert"
 	tm_json "github.com/tendermint/tendermint/libs/json"
 	tm_coretypes "github.com/tendermint/tendermint/rpc/core/types"
@@ -58,9 +60,11 @@ func testBlockResult(t *testing.T) *BlockResult {
 func TestQueryBlock_InvalidHeight(t *testing.T) {
 	port, _ := getFreePort(t)
 	addr := fmt.Sprintf("tcp://127.0.0.1:%v", port)
-	rb, err := QueryBlock(context.Background(), addr, 0, types.NewSyncLogger(ioutil.Discard, "", 0))
+	m := metrics.Nop()
+	rb, err := QueryBlock(context.Background(), addr, 0, types.NewSyncLogger(ioutil.Discard, "", 0), m)
 	assert.Nil(t, rb)
 	assert.Error(t, err)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.QueryBlockFailures))
 }
 
 func TestQueryBlock_Cancel(t *testing.T) {
@@ -69,7 +73,7 @@ func TestQueryBlock_Cancel(t *testing.T) {
 	ctx, cancel := context.WithCancel(context.Background())
 	quitCh := make(chan struct{})
 	go func() {
-		rb, err := QueryBlock(ctx, addr, 1, types.NewSyncLogger(ioutil.Discard, "", 0))
+		rb, err := QueryBlock(ctx, addr, 1, types.NewSyncLogger(ioutil.Discard, "", 0), metrics.Nop())
 		assert.Nil(t, rb)
 		assert.Error(t, err)
 		quitCh <- struct{}{}
@@ -80,20 +84,27 @@ func TestQueryBlock_Cancel(t *testing.T) {
 func TestQueryBlock(t *testing.T) {
 	port, _ := getFreePort(t)
 	addr := fmt.Sprintf("tcp://127.0.0.1:%v", port)
-	go func() {
-		http.HandleFunc("/block", func(rw http.ResponseWriter, r *http.Request) {
-			height := r.URL.Query().Get("height")
-			assert.Equal(t, "1", height)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/block", func(rw http.ResponseWriter, r *http.Request) {
+		height := r.URL.Query().Get("height")
+		assert.Equal(t, "1", height)
 
-			bytes, _ := tm_json.Marshal(testBlockResult(t))
-			_, _ = rw.Write(bytes)
-		})
-		if err := http.ListenAndServe(strings.TrimPrefix(addr, "tcp://"), nil); err != nil {
-			return
-		}
+		bytes, _ := tm_json.Marshal(testBlockResult(t))
+		_, _ = rw.Write(bytes)
+	})
+
+	// Listen before querying, so the query doesn't race the server's startup.
+	listener, err := net.Listen("tcp", strings.TrimPrefix(addr, "tcp://"))
+	assert.NoError(t, err)
+	server := &http.Server{Handler: mux}
+	defer server.Close()
+	go func() {
+		_ = server.Serve(listener)
 	}()
 
-	rb, err := QueryBlock(context.Background(), addr, 1, types.NewSyncLogger(ioutil.Discard, "", 0))
+	m := metrics.Nop()
+	rb, err := QueryBlock(context.Background(), addr, 1, types.NewSyncLogger(ioutil.Discard, "", 0), m)
 	assert.NotNil(t, rb)
 	assert.NoError(t, err)
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.QueryBlockFailures))
 }
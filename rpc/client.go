@@ -0,0 +1,314 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/BlockscapeNetwork/signctrl/metrics"
+	"github.com/BlockscapeNetwork/signctrl/types"
+	tm_json "github.com/tendermint/tendermint/libs/json"
+	tm_coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	tm_jsonrpcclient "github.com/tendermint/tendermint/rpc/jsonrpc/client"
+	tm_types "github.com/tendermint/tendermint/types"
+)
+
+const (
+	// DefaultCacheSize is the default number of latest blocks kept in the client's
+	// block cache.
+	DefaultCacheSize = 100
+
+	// wsEndpoint is the validator's websocket endpoint.
+	wsEndpoint = "/websocket"
+
+	// resubscribeInterval is the interval in which the client checks its websocket
+	// connection and resubscribes if it's lost.
+	resubscribeInterval = 5 * time.Second
+)
+
+var (
+	// newBlockQuery is the query for NewBlock events.
+	newBlockQuery = tm_types.QueryForEvent(tm_types.EventNewBlock).String()
+)
+
+// Client is a client for the validator's RPC server. It subscribes to NewBlock events
+// on the validator's /websocket endpoint and caches the headers and last commits of
+// the latest blocks, so that looking up a block's commitsigs is a local lookup.
+// Blocks that are missing from the cache are queried from the /block endpoint of the
+// validator or, if it fails, of the fallback RPC servers.
+// Implements the Service interface by embedding BaseService.
+type Client struct {
+	types.BaseService
+
+	Logger    *types.SyncLogger
+	rpcladdr  string
+	cacheSize int
+	metrics   *metrics.Metrics
+
+	mtx   sync.RWMutex
+	cache map[int64]*tm_coretypes.ResultBlock
+
+	healthMtx sync.Mutex
+	endpoints []*endpoint
+}
+
+// NewClient creates a new instance of Client that caches up to cacheSize of the
+// latest blocks. The fallback addresses are queried in the given order if the
+// validator's RPC server at rpcladdr fails.
+func NewClient(rpcladdr string, fallbacks []string, cacheSize int, logger *types.SyncLogger, m *metrics.Metrics) *Client {
+	c := &Client{
+		Logger:    logger,
+		rpcladdr:  rpcladdr,
+		cacheSize: cacheSize,
+		metrics:   m,
+		cache:     make(map[int64]*tm_coretypes.ResultBlock),
+		endpoints: []*endpoint{{addr: rpcladdr}},
+	}
+	for _, addr := range fallbacks {
+		c.endpoints = append(c.endpoints, &endpoint{addr: addr})
+	}
+	for _, e := range c.endpoints {
+		m.RPCEndpointUp.WithLabelValues(e.addr).Set(1)
+	}
+	c.BaseService = *types.NewBaseService(
+		logger,
+		"RPC client",
+		c,
+	)
+
+	return c
+}
+
+// OnStart starts subscribing to NewBlock events.
+// Implements the Service interface.
+func (c *Client) OnStart() error {
+	go c.subscribe()
+	return nil
+}
+
+// subscribe keeps subscribing to NewBlock events until the client is stopped. While
+// the subscription is up, received blocks are added to the cache.
+func (c *Client) subscribe() {
+	for {
+		if ws, err := c.dialWS(); err != nil {
+			c.Logger.Debug("Couldn't subscribe to NewBlock events: %v\n", err)
+		} else {
+			c.Logger.Info("Subscribed to NewBlock events ✓")
+			c.receive(ws)
+			if err := ws.Stop(); err != nil {
+				c.Logger.Debug("%v", err)
+			}
+		}
+
+		select {
+		case <-c.Quit():
+			return
+		case <-time.After(resubscribeInterval):
+			continue
+		}
+	}
+}
+
+// dialWS connects to the validator's websocket endpoint and subscribes to NewBlock
+// events. The subscription is renewed on every reconnect of the websocket client.
+func (c *Client) dialWS() (*tm_jsonrpcclient.WSClient, error) {
+	var ws *tm_jsonrpcclient.WSClient
+	ws, err := tm_jsonrpcclient.NewWS(c.rpcladdr, wsEndpoint, tm_jsonrpcclient.OnReconnect(func() {
+		if err := ws.Subscribe(context.Background(), newBlockQuery); err != nil {
+			c.Logger.Error("couldn't resubscribe to NewBlock events: %v\n", err)
+		}
+	}))
+	if err != nil {
+		return nil, err
+	}
+	if err := ws.Start(); err != nil {
+		return nil, err
+	}
+	if err := ws.Subscribe(context.Background(), newBlockQuery); err != nil {
+		_ = ws.Stop()
+		return nil, err
+	}
+
+	return ws, nil
+}
+
+// receive adds the blocks of incoming NewBlock events to the cache. It returns once
+// the client is stopped or the websocket client gave up reconnecting.
+func (c *Client) receive(ws *tm_jsonrpcclient.WSClient) {
+	ticker := time.NewTicker(resubscribeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.Quit():
+			return
+
+		case <-ticker.C:
+			if !ws.IsRunning() {
+				c.Logger.Info("Lost subscription to NewBlock events, falling back to /block queries...")
+				return
+			}
+
+		case resp, ok := <-ws.ResponsesCh:
+			if !ok {
+				return
+			}
+			if resp.Error != nil {
+				c.Logger.Error("couldn't receive NewBlock event: %v\n", resp.Error)
+				continue
+			}
+
+			var event tm_coretypes.ResultEvent
+			if err := tm_json.Unmarshal(resp.Result, &event); err != nil {
+				c.Logger.Error("couldn't unmarshal NewBlock event: %v\n", err)
+				continue
+			}
+			if data, ok := event.Data.(tm_types.EventDataNewBlock); ok && data.Block != nil {
+				c.add(data.Block)
+			}
+		}
+	}
+}
+
+// add adds the block's header and last commit to the cache and evicts blocks that
+// are too old to be kept.
+func (c *Client) add(block *tm_types.Block) {
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	c.Logger.Debug("Caching block %v", block.Height)
+	c.cache[block.Height] = &tm_coretypes.ResultBlock{
+		BlockID: tm_types.BlockID{Hash: block.Hash()},
+		Block: &tm_types.Block{
+			Header:     block.Header,
+			LastCommit: block.LastCommit,
+		},
+	}
+	for height := range c.cache {
+		if height <= block.Height-int64(c.cacheSize) {
+			delete(c.cache, height)
+		}
+	}
+}
+
+// Block returns the block for the specified height. The block's transactions are
+// left out if it's served from the cache.
+func (c *Client) Block(ctx context.Context, height int64) (*tm_coretypes.ResultBlock, error) {
+	c.mtx.RLock()
+	rb, ok := c.cache[height]
+	c.mtx.RUnlock()
+
+	if ok {
+		c.metrics.BlockCacheHits.Inc()
+		return rb, nil
+	}
+
+	c.metrics.BlockCacheMisses.Inc()
+	return c.queryBlock(ctx, height)
+}
+
+// Cached returns the block for the specified height if it's in the cache, without
+// querying it.
+func (c *Client) Cached(height int64) (*tm_coretypes.ResultBlock, bool) {
+	c.mtx.RLock()
+	defer c.mtx.RUnlock()
+	rb, ok := c.cache[height]
+
+	return rb, ok
+}
+
+// report updates the endpoint's health according to the result of a query.
+func (c *Client) report(e *endpoint, err error) {
+	c.healthMtx.Lock()
+	defer c.healthMtx.Unlock()
+
+	if err != nil {
+		c.Logger.Warn("RPC server %v failed: %v\n", e.addr, err)
+		e.markFailed(time.Now())
+		c.metrics.RPCEndpointUp.WithLabelValues(e.addr).Set(0)
+		return
+	}
+	if e.failures > 0 {
+		c.Logger.Info("RPC server %v recovered ✓", e.addr)
+	}
+	e.markHealthy()
+	c.metrics.RPCEndpointUp.WithLabelValues(e.addr).Set(1)
+}
+
+// queryBlock queries the block for the specified height from the endpoints one after
+// the other until one succeeds. Healthy endpoints are queried first.
+func (c *Client) queryBlock(ctx context.Context, height int64) (rb *tm_coretypes.ResultBlock, err error) {
+	c.healthMtx.Lock()
+	endpoints := byHealth(c.endpoints, time.Now())
+	c.healthMtx.Unlock()
+
+	for _, e := range endpoints {
+		rb, err = QueryBlock(ctx, e.addr, height, c.Logger, c.metrics)
+		c.report(e, err)
+		if err == nil {
+			return rb, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return nil, err
+}
+
+// LatestHeight returns the height of the latest block, queried from the endpoints one
+// after the other until one succeeds. Healthy endpoints are queried first.
+func (c *Client) LatestHeight(ctx context.Context) (height int64, err error) {
+	c.healthMtx.Lock()
+	endpoints := byHealth(c.endpoints, time.Now())
+	c.healthMtx.Unlock()
+
+	for _, e := range endpoints {
+		var status *tm_coretypes.ResultStatus
+		status, err = QueryStatus(ctx, e.addr, c.Logger)
+		c.report(e, err)
+		if err == nil {
+			return status.SyncInfo.LatestBlockHeight, nil
+		}
+		if ctx.Err() != nil {
+			break
+		}
+	}
+
+	return 0, err
+}
+
+// QueryBlocks queries the block for the specified height from all endpoints at once
+// and returns the blocks of those that succeeded. An error is only returned if all
+// of them failed.
+func (c *Client) QueryBlocks(ctx context.Context, height int64) ([]*tm_coretypes.ResultBlock, error) {
+	type result struct {
+		rb  *tm_coretypes.ResultBlock
+		err error
+	}
+	resultCh := make(chan result, len(c.endpoints))
+	for _, e := range c.endpoints {
+		go func(e *endpoint) {
+			rb, err := QueryBlock(ctx, e.addr, height, c.Logger, c.metrics)
+			c.report(e, err)
+			resultCh <- result{rb, err}
+		}(e)
+	}
+
+	var rbs []*tm_coretypes.ResultBlock
+	var errs string
+	for range c.endpoints {
+		r := <-resultCh
+		if r.err != nil {
+			errs += fmt.Sprintf("\t%v\n", r.err)
+			continue
+		}
+		rbs = append(rbs, r.rb)
+	}
+	if len(rbs) == 0 {
+		return nil, fmt.Errorf("all RPC servers failed:\n%v", errs)
+	}
+
+	return rbs, nil
+}
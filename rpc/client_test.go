@@ -0,0 +1,225 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/BlockscapeNetwork/signctrl/metrics"
+	"github.com/BlockscapeNetwork/signctrl/types"
+	"github.com/gorilla/websocket"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/assert"
+	tm_json "github.com/tendermint/tendermint/libs/json"
+	tm_coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	tm_rpctypes "github.com/tendermint/tendermint/rpc/jsonrpc/types"
+	tm_types "github.com/tendermint/tendermint/types"
+)
+
+func testBlock(t *testing.T, height int64) *tm_types.Block {
+	t.Helper()
+	return &tm_types.Block{
+		Header: tm_types.Header{
+			ChainID: "testchain",
+			Height:  height,
+		},
+		LastCommit: &tm_types.Commit{
+			Height: height - 1,
+			Signatures: []tm_types.CommitSig{
+				{
+					ValidatorAddress: []byte("ALPHA-ADDR"),
+					Signature:        []byte("ALPHA-SIG"),
+				},
+			},
+		},
+	}
+}
+
+// startMockWSServer starts a websocket endpoint that sends a NewBlock event for each
+// of the given heights once a client subscribes.
+func startMockWSServer(t *testing.T, port int, heights ...int64) *http.Server {
+	t.Helper()
+	upgrader := websocket.Upgrader{}
+	mux := http.NewServeMux()
+	mux.HandleFunc(wsEndpoint, func(rw http.ResponseWriter, r *http.Request) {
+		conn, err := upgrader.Upgrade(rw, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		// Wait for the subscription.
+		if _, _, err := conn.ReadMessage(); err != nil {
+			return
+		}
+		for _, height := range heights {
+			resp := tm_rpctypes.NewRPCSuccessResponse(tm_rpctypes.JSONRPCIntID(0), tm_coretypes.ResultEvent{
+				Query: newBlockQuery,
+				Data:  tm_types.EventDataNewBlock{Block: testBlock(t, height)},
+			})
+			if err := conn.WriteJSON(resp); err != nil {
+				return
+			}
+		}
+
+		// Keep the connection open until the client closes it.
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	})
+
+	server := &http.Server{Handler: mux}
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%v", port))
+	assert.NoError(t, err)
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	return server
+}
+
+func TestClient_Subscribe(t *testing.T) {
+	port, _ := getFreePort(t)
+	server := startMockWSServer(t, port, 1, 2, 3)
+	defer server.Close()
+
+	m := metrics.Nop()
+	c := NewClient(fmt.Sprintf("tcp://127.0.0.1:%v", port), nil, 2, types.NewSyncLogger(ioutil.Discard, "", 0), m)
+	err := c.Start()
+	assert.NoError(t, err)
+	defer func() {
+		_ = c.Stop()
+	}()
+
+	// Wait for the blocks to be cached.
+	assert.Eventually(t, func() bool {
+		c.mtx.RLock()
+		defer c.mtx.RUnlock()
+		_, ok := c.cache[3]
+		return ok
+	}, time.Second, 10*time.Millisecond)
+
+	// The cache only keeps the latest two blocks.
+	c.mtx.RLock()
+	assert.Len(t, c.cache, 2)
+	c.mtx.RUnlock()
+
+	// The lookup is served from the cache.
+	rb, err := c.Block(context.Background(), 3)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(3), rb.Block.Height)
+	assert.Equal(t, []byte("ALPHA-ADDR"), []byte(rb.Block.LastCommit.Signatures[0].ValidatorAddress))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.BlockCacheHits))
+
+	// Only cached blocks are returned without querying.
+	_, ok := c.Cached(3)
+	assert.True(t, ok)
+	_, ok = c.Cached(1)
+	assert.False(t, ok)
+}
+
+func TestClient_Fallback(t *testing.T) {
+	port, _ := getFreePort(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/block", func(rw http.ResponseWriter, r *http.Request) {
+		bytes, _ := tm_json.Marshal(testBlockResult(t))
+		_, _ = rw.Write(bytes)
+	})
+	server := &http.Server{Handler: mux}
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%v", port))
+	assert.NoError(t, err)
+	defer server.Close()
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	// The block isn't cached, so it's queried from the /block endpoint.
+	m := metrics.Nop()
+	c := NewClient(fmt.Sprintf("tcp://127.0.0.1:%v", port), nil, DefaultCacheSize, types.NewSyncLogger(ioutil.Discard, "", 0), m)
+	c.add(testBlock(t, 1))
+
+	rb, err := c.Block(context.Background(), 2)
+	assert.NotNil(t, rb)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.BlockCacheMisses))
+}
+
+func TestClient_Failover(t *testing.T) {
+	// The validator's RPC server is down, the fallback serves the block.
+	downPort, _ := getFreePort(t)
+	port, _ := getFreePort(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/block", func(rw http.ResponseWriter, r *http.Request) {
+		bytes, _ := tm_json.Marshal(testBlockResult(t))
+		_, _ = rw.Write(bytes)
+	})
+	server := &http.Server{Handler: mux}
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%v", port))
+	assert.NoError(t, err)
+	defer server.Close()
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	m := metrics.Nop()
+	down := fmt.Sprintf("tcp://127.0.0.1:%v", downPort)
+	fallback := fmt.Sprintf("tcp://127.0.0.1:%v", port)
+	c := NewClient(down, []string{fallback}, DefaultCacheSize, types.NewSyncLogger(ioutil.Discard, "", 0), m)
+
+	rb, err := c.Block(context.Background(), 2)
+	assert.NotNil(t, rb)
+	assert.NoError(t, err)
+	assert.Equal(t, float64(0), testutil.ToFloat64(m.RPCEndpointUp.WithLabelValues(down)))
+	assert.Equal(t, float64(1), testutil.ToFloat64(m.RPCEndpointUp.WithLabelValues(fallback)))
+
+	// The failed RPC server is queried last until its backoff is over.
+	assert.Equal(t, fallback, byHealth(c.endpoints, time.Now())[0].addr)
+
+	// Querying all RPC servers only returns the successful responses.
+	rbs, err := c.QueryBlocks(context.Background(), 2)
+	assert.Len(t, rbs, 1)
+	assert.NoError(t, err)
+
+	// All RPC servers fail.
+	server.Close()
+	_, err = c.Block(context.Background(), 2)
+	assert.Error(t, err)
+	_, err = c.QueryBlocks(context.Background(), 2)
+	assert.Error(t, err)
+}
+
+func TestClient_LatestHeight(t *testing.T) {
+	port, _ := getFreePort(t)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/status", func(rw http.ResponseWriter, r *http.Request) {
+		bytes, _ := tm_json.Marshal(StatusResult{
+			Result: &tm_coretypes.ResultStatus{
+				SyncInfo: tm_coretypes.SyncInfo{LatestBlockHeight: 42},
+			},
+		})
+		_, _ = rw.Write(bytes)
+	})
+	server := &http.Server{Handler: mux}
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%v", port))
+	assert.NoError(t, err)
+	defer server.Close()
+	go func() {
+		_ = server.Serve(listener)
+	}()
+
+	c := NewClient(fmt.Sprintf("tcp://127.0.0.1:%v", port), nil, DefaultCacheSize, types.NewSyncLogger(ioutil.Discard, "", 0), metrics.Nop())
+	height, err := c.LatestHeight(context.Background())
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), height)
+
+	// The RPC server is down.
+	server.Close()
+	_, err = c.LatestHeight(context.Background())
+	assert.Error(t, err)
+}
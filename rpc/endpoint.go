@@ -0,0 +1,66 @@
+package rpc
+
+import (
+	"time"
+)
+
+const (
+	// baseBackoff is the time an endpoint is considered unhealthy after its first
+	// failure. It doubles with every further failure in a row.
+	baseBackoff = 5 * time.Second
+
+	// maxBackoff is the maximum time an endpoint is considered unhealthy after a
+	// failure.
+	maxBackoff = 5 * time.Minute
+)
+
+// endpoint is an RPC server blocks can be queried from. It keeps track of its health,
+// so that endpoints that failed recently are only queried as a last resort.
+type endpoint struct {
+	addr           string
+	failures       int
+	unhealthyUntil time.Time
+}
+
+// healthy returns true if the endpoint hasn't failed recently.
+func (e *endpoint) healthy(now time.Time) bool {
+	return !now.Before(e.unhealthyUntil)
+}
+
+// markFailed marks the endpoint as unhealthy for a backoff period that grows with
+// every failure in a row.
+func (e *endpoint) markFailed(now time.Time) {
+	e.failures++
+	backoff := baseBackoff
+	for i := 1; i < e.failures && backoff < maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > maxBackoff {
+		backoff = maxBackoff
+	}
+	e.unhealthyUntil = now.Add(backoff)
+}
+
+// markHealthy resets the endpoint's failures.
+func (e *endpoint) markHealthy() {
+	e.failures = 0
+	e.unhealthyUntil = time.Time{}
+}
+
+// byHealth returns the given endpoints with the healthy ones first, while keeping
+// their configured order otherwise.
+func byHealth(endpoints []*endpoint, now time.Time) []*endpoint {
+	sorted := make([]*endpoint, 0, len(endpoints))
+	for _, e := range endpoints {
+		if e.healthy(now) {
+			sorted = append(sorted, e)
+		}
+	}
+	for _, e := range endpoints {
+		if !e.healthy(now) {
+			sorted = append(sorted, e)
+		}
+	}
+
+	return sorted
+}
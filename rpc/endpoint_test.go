@@ -0,0 +1,45 @@
+package rpc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEndpointHealth(t *testing.T) {
+	now := time.Now()
+	e := &endpoint{addr: "tcp://127.0.0.1:26657"}
+	assert.True(t, e.healthy(now))
+
+	// First failure.
+	e.markFailed(now)
+	assert.False(t, e.healthy(now))
+	assert.True(t, e.healthy(now.Add(baseBackoff)))
+
+	// Second failure doubles the backoff.
+	e.markFailed(now)
+	assert.False(t, e.healthy(now.Add(baseBackoff)))
+	assert.True(t, e.healthy(now.Add(2*baseBackoff)))
+
+	// The backoff is capped.
+	for i := 0; i < 100; i++ {
+		e.markFailed(now)
+	}
+	assert.True(t, e.healthy(now.Add(maxBackoff)))
+
+	e.markHealthy()
+	assert.True(t, e.healthy(now))
+	assert.Equal(t, 0, e.failures)
+}
+
+func TestByHealth(t *testing.T) {
+	now := time.Now()
+	a := &endpoint{addr: "a"}
+	b := &endpoint{addr: "b"}
+	c := &endpoint{addr: "c"}
+	a.markFailed(now)
+
+	sorted := byHealth([]*endpoint{a, b, c}, now)
+	assert.Equal(t, []*endpoint{b, c, a}, sorted)
+}
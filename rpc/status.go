@@ -0,0 +1,53 @@
+package rpc
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"regexp"
+
+	"github.com/BlockscapeNetwork/signctrl/types"
+	tm_json "github.com/tendermint/tendermint/libs/json"
+	tm_coretypes "github.com/tendermint/tendermint/rpc/core/types"
+)
+
+// StatusResult defines the JSONRPC 2.0 response structure for Tendermint's /status
+// endpoint.
+type StatusResult struct {
+	Result *tm_coretypes.ResultStatus `json:"result"`
+}
+
+// QueryStatus gets the status of the node behind the RPC server, including its node ID
+// and the height of the latest block it knows of.
+func QueryStatus(ctx context.Context, rpcladdr string, logger *types.SyncLogger) (*tm_coretypes.ResultStatus, error) {
+	// Cut the protocol from rpcladdr.
+	rpcladdrHostPort := regexp.MustCompile(`(tcp|unix)://`).ReplaceAllString(rpcladdr, "")
+	url := fmt.Sprintf("http://%v/status", rpcladdrHostPort)
+
+	logger.Debug("GET %v", url)
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	bytes, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var status StatusResult
+	if err := tm_json.Unmarshal(bytes, &status); err != nil {
+		return nil, err
+	}
+	if status.Result == nil {
+		return nil, fmt.Errorf("no status found")
+	}
+
+	return status.Result, nil
+}
@@ -0,0 +1,171 @@
+package rpc
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/BlockscapeNetwork/signctrl/types"
+	tm_light "github.com/tendermint/tendermint/light"
+	tm_provider "github.com/tendermint/tendermint/light/provider"
+	tm_httpprovider "github.com/tendermint/tendermint/light/provider/http"
+	tm_lightstore "github.com/tendermint/tendermint/light/store/db"
+	tm_coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	tm_db "github.com/tendermint/tm-db"
+)
+
+const (
+	// lightPruningSize is the number of light blocks the light client keeps in its
+	// trusted store.
+	lightPruningSize = 100
+)
+
+var (
+	// ErrTamperedBlock is returned if a block's header or last commit doesn't match the
+	// header verified by the light client.
+	ErrTamperedBlock = errors.New("block doesn't match the verified header")
+
+	// ErrTrustExpired is returned if the trusted header configured in the [light]
+	// section expired, so blocks can't be verified until it's updated.
+	ErrTrustExpired = errors.New("trusted header expired")
+)
+
+// BlockVerifier verifies blocks returned by RPC servers.
+type BlockVerifier interface {
+	Verify(ctx context.Context, rb *tm_coretypes.ResultBlock) error
+}
+
+// Verifier must implement the BlockVerifier interface.
+var _ BlockVerifier = new(Verifier)
+
+// Verifier verifies blocks returned by RPC servers with a light client, so that a
+// compromised or buggy RPC server can't forge or hide commitsigs.
+type Verifier struct {
+	Logger    *types.SyncLogger
+	chainID   string
+	trust     tm_light.TrustOptions
+	primary   tm_provider.Provider
+	witnesses []tm_provider.Provider
+
+	mtx sync.Mutex
+	lc  *tm_light.Client
+}
+
+// NewVerifier creates a new instance of Verifier that uses the validator's RPC server
+// at rpcladdr as the light client's primary and the fallback RPC servers as its
+// witnesses. If the trust options lack a trusted header, the latest header of the
+// primary is trusted on first use.
+func NewVerifier(chainID string, rpcladdr string, fallbacks []string, trust tm_light.TrustOptions, logger *types.SyncLogger) (*Verifier, error) {
+	primary, err := tm_httpprovider.New(chainID, rpcladdr)
+	if err != nil {
+		return nil, err
+	}
+	var witnesses []tm_provider.Provider
+	for _, addr := range fallbacks {
+		witness, err := tm_httpprovider.New(chainID, addr)
+		if err != nil {
+			return nil, err
+		}
+		witnesses = append(witnesses, witness)
+	}
+
+	return newVerifier(chainID, primary, witnesses, trust, logger), nil
+}
+
+// newVerifier creates a new instance of Verifier with the given providers.
+func newVerifier(chainID string, primary tm_provider.Provider, witnesses []tm_provider.Provider, trust tm_light.TrustOptions, logger *types.SyncLogger) *Verifier {
+	// The light client requires at least one witness. Without fallback RPC servers,
+	// the primary has to witness itself.
+	if len(witnesses) == 0 {
+		witnesses = []tm_provider.Provider{primary}
+	}
+
+	return &Verifier{
+		Logger:    logger,
+		chainID:   chainID,
+		trust:     trust,
+		primary:   primary,
+		witnesses: witnesses,
+	}
+}
+
+// client returns the light client and initializes it first if necessary.
+func (v *Verifier) client(ctx context.Context) (*tm_light.Client, error) {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+
+	if v.lc != nil {
+		return v.lc, nil
+	}
+
+	trust := v.trust
+	if trust.Height == 0 {
+		lb, err := v.primary.LightBlock(ctx, 0)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't get latest light block to trust: %w", err)
+		}
+		trust.Height = lb.Height
+		trust.Hash = lb.Hash()
+		v.Logger.Warn("Trusting header %X at height %v of %v on first use\n", trust.Hash, trust.Height, v.primary)
+	}
+
+	lc, err := tm_light.NewClient(
+		ctx,
+		v.chainID,
+		trust,
+		v.primary,
+		v.witnesses,
+		tm_lightstore.New(tm_db.NewMemDB(), v.chainID),
+		tm_light.PruningSize(lightPruningSize),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't initialize light client: %w", err)
+	}
+	v.lc = lc
+
+	return lc, nil
+}
+
+// reset drops the light client, so that it's initialized anew on the next
+// verification.
+func (v *Verifier) reset() {
+	v.mtx.Lock()
+	defer v.mtx.Unlock()
+	v.lc = nil
+}
+
+// Verify verifies the block's header with the light client and checks that the
+// block's header, including its time, is the verified one and that its last commit is
+// the one committed to by the verified header.
+func (v *Verifier) Verify(ctx context.Context, rb *tm_coretypes.ResultBlock) error {
+	lc, err := v.client(ctx)
+	if err != nil {
+		return err
+	}
+
+	lb, err := lc.VerifyLightBlockAtHeight(ctx, rb.Block.Height, time.Now())
+	if err != nil {
+		// If the trusted header expired, start over with a new root of trust on first
+		// use. A configured root of trust isn't replaced behind the operator's back, as
+		// it would expire right away again.
+		var expired tm_light.ErrOldHeaderExpired
+		if errors.As(err, &expired) {
+			if v.trust.Height != 0 {
+				return fmt.Errorf("couldn't verify header at height %v: %w, update trust_height and trust_hash in the [light] section of the config.toml to a recent header (%v)", rb.Block.Height, ErrTrustExpired, err)
+			}
+			v.reset()
+		}
+		return fmt.Errorf("couldn't verify header at height %v: %w", rb.Block.Height, err)
+	}
+	if !bytes.Equal(rb.Block.Header.Hash(), lb.Hash()) {
+		return fmt.Errorf("%w: header at height %v (got %X, expected %X)", ErrTamperedBlock, rb.Block.Height, rb.Block.Header.Hash(), lb.Hash())
+	}
+	if !bytes.Equal(rb.Block.LastCommit.Hash(), lb.LastCommitHash) {
+		return fmt.Errorf("%w: last commit at height %v (got %X, expected %X)", ErrTamperedBlock, rb.Block.Height, rb.Block.LastCommit.Hash(), lb.LastCommitHash)
+	}
+
+	return nil
+}
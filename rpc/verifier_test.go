@@ -0,0 +1,140 @@
+package rpc
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"github.com/BlockscapeNetwork/signctrl/types"
+	"github.com/stretchr/testify/assert"
+	tm_ed25519 "github.com/tendermint/tendermint/crypto/ed25519"
+	tm_light "github.com/tendermint/tendermint/light"
+	tm_mockprovider "github.com/tendermint/tendermint/light/provider/mock"
+	tm_prototypes "github.com/tendermint/tendermint/proto/tendermint/types"
+	tm_versionproto "github.com/tendermint/tendermint/proto/tendermint/version"
+	tm_coretypes "github.com/tendermint/tendermint/rpc/core/types"
+	tm_types "github.com/tendermint/tendermint/types"
+	tm_version "github.com/tendermint/tendermint/version"
+)
+
+// testChain generates a chain of signed headers up to the given height, signed by a
+// single validator.
+func testChain(t *testing.T, chainID string, height int64) (map[int64]*tm_types.SignedHeader, map[int64]*tm_types.ValidatorSet) {
+	t.Helper()
+	priv := tm_ed25519.GenPrivKey()
+	vals := tm_types.NewValidatorSet([]*tm_types.Validator{tm_types.NewValidator(priv.PubKey(), 10)})
+	start := time.Now().Add(-time.Hour)
+
+	headers := make(map[int64]*tm_types.SignedHeader)
+	valsets := make(map[int64]*tm_types.ValidatorSet)
+	var last *tm_types.SignedHeader
+	for h := int64(1); h <= height; h++ {
+		header := &tm_types.Header{
+			Version:            tm_versionproto.Consensus{Block: tm_version.BlockProtocol},
+			ChainID:            chainID,
+			Height:             h,
+			Time:               start.Add(time.Duration(h) * time.Minute),
+			ValidatorsHash:     vals.Hash(),
+			NextValidatorsHash: vals.Hash(),
+			ProposerAddress:    vals.Validators[0].Address,
+		}
+		if last != nil {
+			header.LastBlockID = last.Commit.BlockID
+			header.LastCommitHash = last.Commit.Hash()
+		}
+
+		blockID := tm_types.BlockID{
+			Hash:          header.Hash(),
+			PartSetHeader: tm_types.PartSetHeader{Total: 1, Hash: make([]byte, 32)},
+		}
+		vote := &tm_types.Vote{
+			Type:             tm_prototypes.PrecommitType,
+			Height:           h,
+			BlockID:          blockID,
+			Timestamp:        header.Time,
+			ValidatorAddress: vals.Validators[0].Address,
+		}
+		sig, err := priv.Sign(tm_types.VoteSignBytes(chainID, vote.ToProto()))
+		assert.NoError(t, err)
+		vote.Signature = sig
+
+		last = &tm_types.SignedHeader{
+			Header: header,
+			Commit: tm_types.NewCommit(h, 0, blockID, []tm_types.CommitSig{vote.CommitSig()}),
+		}
+		headers[h] = last
+		valsets[h] = vals
+	}
+
+	return headers, valsets
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	headers, vals := testChain(t, "testchain", 3)
+	provider := tm_mockprovider.New("testchain", headers, vals)
+	v := newVerifier("testchain", provider, nil, tm_light.TrustOptions{Period: 24 * time.Hour}, types.NewSyncLogger(ioutil.Discard, "", 0))
+
+	// The block's last commit is the one committed to by the verified header.
+	rb := &tm_coretypes.ResultBlock{
+		Block: &tm_types.Block{
+			Header:     *headers[3].Header,
+			LastCommit: headers[2].Commit,
+		},
+	}
+	err := v.Verify(context.Background(), rb)
+	assert.NoError(t, err)
+
+	// The block's last commit lacks a commitsig.
+	tampered := &tm_coretypes.ResultBlock{
+		Block: &tm_types.Block{
+			Header:     *headers[3].Header,
+			LastCommit: tm_types.NewCommit(2, 0, headers[2].Commit.BlockID, []tm_types.CommitSig{tm_types.NewCommitSigAbsent()}),
+		},
+	}
+	err = v.Verify(context.Background(), tampered)
+	assert.ErrorIs(t, err, ErrTamperedBlock)
+
+	// The block's time differs from the verified header's.
+	header := *headers[3].Header
+	header.Time = header.Time.Add(time.Hour)
+	retimed := &tm_coretypes.ResultBlock{
+		Block: &tm_types.Block{
+			Header:     header,
+			LastCommit: headers[2].Commit,
+		},
+	}
+	err = v.Verify(context.Background(), retimed)
+	assert.ErrorIs(t, err, ErrTamperedBlock)
+
+	// The block's height isn't known to the light client's providers.
+	unknown := &tm_coretypes.ResultBlock{Block: &tm_types.Block{Header: tm_types.Header{Height: 10}}}
+	err = v.Verify(context.Background(), unknown)
+	assert.Error(t, err)
+}
+
+func TestVerifier_Expired(t *testing.T) {
+	headers, vals := testChain(t, "testchain", 3)
+	provider := tm_mockprovider.New("testchain", headers, vals)
+	rb := &tm_coretypes.ResultBlock{
+		Block: &tm_types.Block{
+			Header:     *headers[3].Header,
+			LastCommit: headers[2].Commit,
+		},
+	}
+
+	// The configured trusted header is older than the trusting period, so the operator
+	// has to update it.
+	trust := tm_light.TrustOptions{Period: 30 * time.Minute, Height: 1, Hash: headers[1].Hash()}
+	v := newVerifier("testchain", provider, nil, trust, types.NewSyncLogger(ioutil.Discard, "", 0))
+	err := v.Verify(context.Background(), rb)
+	assert.ErrorIs(t, err, ErrTrustExpired)
+	assert.Contains(t, err.Error(), "trust_height")
+
+	// The configured root of trust isn't replaced, so the error persists.
+	v.mtx.Lock()
+	assert.NotNil(t, v.lc)
+	v.mtx.Unlock()
+	err = v.Verify(context.Background(), rb)
+	assert.ErrorIs(t, err, ErrTrustExpired)
+}
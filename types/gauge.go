@@ -11,14 +11,15 @@ type Gauges struct {
 	MissedInARowGauge prometheus.Gauge
 }
 
-// RegisterGauges registers SignCTRL's prometheus gauges and returns them.
-func RegisterGauges() Gauges {
+// RegisterGauges registers SignCTRL's prometheus gauges with the given registerer
+// and returns them.
+func RegisterGauges(reg prometheus.Registerer) Gauges {
 	var g Gauges
-	g.RankGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	g.RankGauge = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
 		Name: "signctrl_rank",
 		Help: "Current rank of the SignCTRL validator.",
 	})
-	g.MissedInARowGauge = promauto.NewGauge(prometheus.GaugeOpts{
+	g.MissedInARowGauge = promauto.With(reg).NewGauge(prometheus.GaugeOpts{
 		Name: "signctrl_missed_blocks_in_a_row",
 		Help: "Number of blocks missed in a row",
 	})
@@ -3,11 +3,17 @@ package types
 import (
 	"testing"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/stretchr/testify/assert"
 )
 
 func TestRegisterGauges(t *testing.T) {
-	g := RegisterGauges()
+	reg := prometheus.NewRegistry()
+	g := RegisterGauges(reg)
 	assert.NotNil(t, g.RankGauge)
 	assert.NotNil(t, g.MissedInARowGauge)
+
+	mfs, err := reg.Gather()
+	assert.NoError(t, err)
+	assert.Len(t, mfs, 2)
 }
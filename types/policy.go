@@ -0,0 +1,240 @@
+package types
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	// PolicyConsecutive is the name of the rank policy that triggers a rank update after
+	// {threshold} blocks missed in a row.
+	PolicyConsecutive = "consecutive"
+
+	// PolicyWindow is the name of the rank policy that triggers a rank update after
+	// {threshold} missed blocks out of the last {window} blocks.
+	PolicyWindow = "window"
+
+	// PolicyTime is the name of the rank policy that triggers a rank update once the
+	// validator's commitsig has been missing for {threshold_time}.
+	PolicyTime = "time"
+)
+
+// Block defines the information about a block that rank policies base their decisions
+// on. It must be the same for all validators in the set, so the set agrees on when a
+// rank update is due.
+type Block struct {
+	Height int64
+	Time   time.Time
+}
+
+// RankPolicy decides when a rank update is due, based on the blocks with and without
+// the validator's commitsig.
+type RankPolicy interface {
+	// Missed records a block lacking the validator's commitsig and returns true if a
+	// rank update is due.
+	Missed(b Block) bool
+
+	// Signed records a block carrying the validator's commitsig.
+	Signed(b Block)
+
+	// Reset forgets all recorded blocks. It's called after every rank update.
+	Reset()
+
+	// Count returns the number of missed blocks that currently count towards the
+	// next rank update.
+	Count() int
+
+	// Progress returns the progress towards the next rank update for logging.
+	Progress() string
+
+	// MissesUntilUpdate returns the number of blocks that must be missed in a row from
+	// the given height on until a rank update is due, or 0 if it can't be told by the
+	// number of blocks alone.
+	MissesUntilUpdate(height int64) int
+
+	// Clone returns an independent copy of the policy, including its recorded blocks.
+	Clone() RankPolicy
+}
+
+// ConsecutivePolicy is a RankPolicy that triggers a rank update after {threshold} blocks
+// missed in a row. This is SignCTRL's default policy.
+type ConsecutivePolicy struct {
+	threshold    int
+	missedInARow int
+}
+
+// NewConsecutivePolicy creates a new instance of ConsecutivePolicy.
+func NewConsecutivePolicy(threshold int) *ConsecutivePolicy {
+	return &ConsecutivePolicy{threshold: threshold}
+}
+
+// Missed implements the RankPolicy interface.
+func (p *ConsecutivePolicy) Missed(b Block) bool {
+	p.missedInARow++
+	return p.missedInARow >= p.threshold
+}
+
+// Signed implements the RankPolicy interface.
+func (p *ConsecutivePolicy) Signed(b Block) {
+	p.missedInARow = 0
+}
+
+// Reset implements the RankPolicy interface.
+func (p *ConsecutivePolicy) Reset() {
+	p.missedInARow = 0
+}
+
+// Count implements the RankPolicy interface.
+func (p *ConsecutivePolicy) Count() int {
+	return p.missedInARow
+}
+
+// Progress implements the RankPolicy interface.
+func (p *ConsecutivePolicy) Progress() string {
+	return fmt.Sprintf("%v/%v in a row", p.missedInARow, p.threshold)
+}
+
+// MissesUntilUpdate implements the RankPolicy interface.
+func (p *ConsecutivePolicy) MissesUntilUpdate(height int64) int {
+	return p.threshold - p.missedInARow
+}
+
+// Clone implements the RankPolicy interface.
+func (p *ConsecutivePolicy) Clone() RankPolicy {
+	clone := *p
+	return &clone
+}
+
+// WindowPolicy is a RankPolicy that triggers a rank update after {threshold} missed
+// blocks out of the last {window} blocks. Other than ConsecutivePolicy, a single signed
+// block doesn't reset the count, so a signer that keeps missing blocks intermittently
+// is replaced as well.
+type WindowPolicy struct {
+	threshold int
+	window    int64
+	missed    []int64
+}
+
+// NewWindowPolicy creates a new instance of WindowPolicy.
+func NewWindowPolicy(threshold, window int) *WindowPolicy {
+	return &WindowPolicy{threshold: threshold, window: int64(window)}
+}
+
+// Missed implements the RankPolicy interface.
+func (p *WindowPolicy) Missed(b Block) bool {
+	p.missed = append(p.missed, b.Height)
+	p.slide(b.Height)
+	return len(p.missed) >= p.threshold
+}
+
+// Signed implements the RankPolicy interface.
+func (p *WindowPolicy) Signed(b Block) {
+	p.slide(b.Height)
+}
+
+// slide drops the missed blocks that are no longer within the window ending at the
+// given height.
+func (p *WindowPolicy) slide(height int64) {
+	var i int
+	for i < len(p.missed) && p.missed[i] <= height-p.window {
+		i++
+	}
+	p.missed = p.missed[i:]
+}
+
+// Reset implements the RankPolicy interface.
+func (p *WindowPolicy) Reset() {
+	p.missed = nil
+}
+
+// Count implements the RankPolicy interface.
+func (p *WindowPolicy) Count() int {
+	return len(p.missed)
+}
+
+// Progress implements the RankPolicy interface.
+func (p *WindowPolicy) Progress() string {
+	return fmt.Sprintf("%v/%v in the last %v blocks", len(p.missed), p.threshold, p.window)
+}
+
+// MissesUntilUpdate implements the RankPolicy interface. The blocks missed earlier
+// count as long as they're within the window.
+func (p *WindowPolicy) MissesUntilUpdate(height int64) int {
+	sim := p.Clone()
+	for n := 1; n <= p.threshold; n++ {
+		if sim.Missed(Block{Height: height + int64(n) - 1}) {
+			return n
+		}
+	}
+
+	return 0
+}
+
+// Clone implements the RankPolicy interface.
+func (p *WindowPolicy) Clone() RankPolicy {
+	clone := *p
+	clone.missed = append([]int64{}, p.missed...)
+	return &clone
+}
+
+// TimePolicy is a RankPolicy that triggers a rank update once the validator's commitsig
+// has been missing for {threshold} of time. The time is measured with the block times,
+// from the first block lacking the commitsig to the latest one, so it's the same for
+// all validators in the set, regardless of their clocks. At least 2 blocks must be
+// missed in a row, as a rank update skips the next block.
+type TimePolicy struct {
+	threshold    time.Duration
+	firstMissed  time.Time
+	lastMissed   time.Time
+	missedInARow int
+}
+
+// NewTimePolicy creates a new instance of TimePolicy.
+func NewTimePolicy(threshold time.Duration) *TimePolicy {
+	return &TimePolicy{threshold: threshold}
+}
+
+// Missed implements the RankPolicy interface.
+func (p *TimePolicy) Missed(b Block) bool {
+	if p.missedInARow == 0 {
+		p.firstMissed = b.Time
+	}
+	p.lastMissed = b.Time
+	p.missedInARow++
+
+	return p.missedInARow >= 2 && p.lastMissed.Sub(p.firstMissed) >= p.threshold
+}
+
+// Signed implements the RankPolicy interface.
+func (p *TimePolicy) Signed(b Block) {
+	p.Reset()
+}
+
+// Reset implements the RankPolicy interface.
+func (p *TimePolicy) Reset() {
+	p.firstMissed = time.Time{}
+	p.lastMissed = time.Time{}
+	p.missedInARow = 0
+}
+
+// Count implements the RankPolicy interface.
+func (p *TimePolicy) Count() int {
+	return p.missedInARow
+}
+
+// Progress implements the RankPolicy interface.
+func (p *TimePolicy) Progress() string {
+	return fmt.Sprintf("%v in a row for %v/%v", p.missedInARow, p.lastMissed.Sub(p.firstMissed), p.threshold)
+}
+
+// MissesUntilUpdate implements the RankPolicy interface. A rank update depends on the
+// block times, so it can't be told in blocks.
+func (p *TimePolicy) MissesUntilUpdate(height int64) int {
+	return 0
+}
+
+// Clone implements the RankPolicy interface.
+func (p *TimePolicy) Clone() RankPolicy {
+	clone := *p
+	return &clone
+}
@@ -0,0 +1,96 @@
+package types
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// simulate feeds the given blocks to the policy, starting at height 1. A block is
+// either signed ('S') or missed ('M'). The blocks are produced every second, unless
+// the block times are given as offsets from the first block. It returns the heights
+// at which a rank update is due. The policy is reset after every rank update, just
+// like on promotion.
+func simulate(policy RankPolicy, blocks string, times []time.Duration) []int64 {
+	genesis := time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC)
+	var updates []int64
+	for i, b := range blocks {
+		block := Block{Height: int64(i + 1), Time: genesis.Add(time.Duration(i) * time.Second)}
+		if times != nil {
+			block.Time = genesis.Add(times[i])
+		}
+		switch b {
+		case 'S':
+			policy.Signed(block)
+		case 'M':
+			if policy.Missed(block) {
+				updates = append(updates, block.Height)
+				policy.Reset()
+			}
+		}
+	}
+
+	return updates
+}
+
+func TestRankPolicies(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  RankPolicy
+		blocks  string
+		times   []time.Duration
+		updates []int64
+	}{
+		{"consecutive/all signed", NewConsecutivePolicy(3), "SSSSSS", nil, nil},
+		{"consecutive/in a row", NewConsecutivePolicy(3), "SMMMSS", nil, []int64{4}},
+		{"consecutive/interrupted", NewConsecutivePolicy(3), "MMSMMSMM", nil, nil},
+		{"consecutive/twice", NewConsecutivePolicy(2), "MMSMM", nil, []int64{2, 5}},
+		{"window/all signed", NewWindowPolicy(3, 5), "SSSSSS", nil, nil},
+		{"window/in a row", NewWindowPolicy(3, 5), "SMMMSS", nil, []int64{4}},
+		{"window/interrupted", NewWindowPolicy(3, 5), "MMSMSS", nil, []int64{4}},
+		{"window/spread out", NewWindowPolicy(3, 5), "MSSMSSMSSM", nil, nil},
+		{"window/slides", NewWindowPolicy(2, 3), "MSSMSM", nil, []int64{6}},
+		{"window/reset", NewWindowPolicy(2, 4), "MMMSM", nil, []int64{2, 5}},
+		{"time/all signed", NewTimePolicy(3 * time.Second), "SSSSSS", nil, nil},
+		{"time/in a row", NewTimePolicy(3 * time.Second), "SMMMMS", nil, []int64{5}},
+		{"time/interrupted", NewTimePolicy(3 * time.Second), "MMMSMMMS", nil, nil},
+		{"time/slow blocks", NewTimePolicy(time.Minute), "SMMS", []time.Duration{0, time.Minute, 2 * time.Minute, 3 * time.Minute}, []int64{3}},
+		{"time/fast blocks", NewTimePolicy(time.Minute), "SMMMMMS", []time.Duration{0, time.Second, 2 * time.Second, 3 * time.Second, 4 * time.Second, 5 * time.Second, 6 * time.Second}, nil},
+		{"time/single block", NewTimePolicy(time.Second), "SMS", []time.Duration{0, time.Hour, 2 * time.Hour}, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.updates, simulate(tt.policy, tt.blocks, tt.times))
+		})
+	}
+}
+
+func TestRankPolicyClone(t *testing.T) {
+	for _, policy := range []RankPolicy{NewConsecutivePolicy(3), NewWindowPolicy(3, 5), NewTimePolicy(time.Minute)} {
+		policy.Missed(Block{Height: 1})
+		clone := policy.Clone()
+		clone.Missed(Block{Height: 2})
+		assert.Equal(t, 1, policy.Count())
+		assert.Equal(t, 2, clone.Count())
+	}
+}
+
+func TestMissesUntilUpdate(t *testing.T) {
+	consecutive := NewConsecutivePolicy(3)
+	assert.Equal(t, 3, consecutive.MissesUntilUpdate(1))
+	consecutive.Missed(Block{Height: 1})
+	assert.Equal(t, 2, consecutive.MissesUntilUpdate(2))
+
+	// The missed blocks only count as long as they're within the window.
+	window := NewWindowPolicy(3, 4)
+	window.Missed(Block{Height: 1})
+	window.Missed(Block{Height: 2})
+	assert.Equal(t, 1, window.MissesUntilUpdate(4))
+	assert.Equal(t, 3, window.MissesUntilUpdate(5))
+	assert.Equal(t, 2, window.Count())
+
+	assert.Equal(t, 0, NewWindowPolicy(3, 2).MissesUntilUpdate(1))
+	assert.Equal(t, 0, NewTimePolicy(time.Minute).MissesUntilUpdate(1))
+}
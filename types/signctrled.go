@@ -3,6 +3,8 @@ package types
 import (
 	"errors"
 	"io/ioutil"
+	"sort"
+	"sync"
 )
 
 var (
@@ -17,14 +19,19 @@ var (
 	// ErrCounterLocked is returned when the counter for missed blocks in a row is
 	// still locked due to SignCTRL not having seen a signed block from rank 1.
 	ErrCounterLocked = errors.New("waiting for first commitsig from validator to unlock counter for missed blocks in a row")
+
+	// ErrRemovedFromSet is returned when the validator's rank is removed from the set
+	// by a set change.
+	ErrRemovedFromSet = errors.New("rank has been removed from the set")
 )
 
 // SignCtrled defines the functionality of a SignCTRL PrivValidator that monitors the
 // blockchain for missed blocks in a row and keeps its rank up to date.
 type SignCtrled interface {
-	Missed() error
+	Missed(b Block) error
 	OnMissedTooMany()
 
+	Signed(b Block)
 	Reset()
 
 	Promote() error
@@ -36,27 +43,83 @@ type BaseSignCtrled struct {
 	Logger        *SyncLogger
 	counterLocked bool
 	currentHeight int64
-	missedInARow  int
 	threshold     int
+	policy        RankPolicy
 	rank          int
+	drained       *drainedRanks
+	snapshot      *snapshot
 
 	impl SignCtrled
 }
 
+// Snapshot is a copy of the validator's rank, current height and rank policy as of the
+// last change. Other than the BaseSignCtrled itself, which is only changed while sign
+// requests are handled, it can be read from other goroutines.
+type Snapshot struct {
+	Rank    int
+	Height  int64
+	Counter int
+
+	// Policy is an independent copy of the rank policy.
+	Policy RankPolicy
+}
+
+// snapshot guards the last published Snapshot with a mutex.
+type snapshot struct {
+	mtx sync.RWMutex
+	s   Snapshot
+}
+
+// drainedRanks is the set of ranks taken out of the promotion line. It's guarded by a
+// mutex, as it can be changed while sign requests are handled.
+type drainedRanks struct {
+	mtx   sync.Mutex
+	ranks map[int]bool
+}
+
 // NewBaseSignCtrled creates a new instance of BaseSignCtrled.
 func NewBaseSignCtrled(logger *SyncLogger, threshold int, rank int, impl SignCtrled) *BaseSignCtrled {
 	if logger == nil {
 		logger = NewSyncLogger(ioutil.Discard, "", 0)
 	}
 
-	return &BaseSignCtrled{
+	bsc := &BaseSignCtrled{
 		Logger:        logger,
 		counterLocked: true,
 		currentHeight: 1,
 		threshold:     threshold,
+		policy:        NewConsecutivePolicy(threshold),
 		rank:          rank,
+		drained:       &drainedRanks{ranks: make(map[int]bool)},
+		snapshot:      &snapshot{},
 		impl:          impl,
 	}
+	bsc.publish()
+
+	return bsc
+}
+
+// publish publishes a new Snapshot of the validator's state. It must be called after
+// every change of the rank, the current height or the rank policy.
+func (bsc *BaseSignCtrled) publish() {
+	s := Snapshot{
+		Rank:    bsc.rank,
+		Height:  bsc.currentHeight,
+		Counter: bsc.policy.Count(),
+		Policy:  bsc.policy.Clone(),
+	}
+
+	bsc.snapshot.mtx.Lock()
+	defer bsc.snapshot.mtx.Unlock()
+	bsc.snapshot.s = s
+}
+
+// GetSnapshot returns the last published Snapshot of the validator's state. It's safe
+// to call from other goroutines than the one handling sign requests.
+func (bsc *BaseSignCtrled) GetSnapshot() Snapshot {
+	bsc.snapshot.mtx.RLock()
+	defer bsc.snapshot.mtx.RUnlock()
+	return bsc.snapshot.s
 }
 
 // LockCounter locks the counter for missed blocks in a row.
@@ -81,6 +144,11 @@ func (bsc *BaseSignCtrled) UnlockCounter() {
 	}
 }
 
+// IsCounterLocked checks whether the counter for missed blocks in a row is locked.
+func (bsc *BaseSignCtrled) IsCounterLocked() bool {
+	return bsc.counterLocked
+}
+
 // GetCurrentHeight returns the validator's current height.
 func (bsc *BaseSignCtrled) GetCurrentHeight() int64 {
 	return bsc.currentHeight
@@ -89,6 +157,7 @@ func (bsc *BaseSignCtrled) GetCurrentHeight() int64 {
 // SetCurrentHeight sets the current height to the given value.
 func (bsc *BaseSignCtrled) SetCurrentHeight(height int64) {
 	bsc.currentHeight = height
+	bsc.publish()
 }
 
 // GetThreshold returns the threshold of blocks missed in a row that trigger a rank
@@ -97,9 +166,22 @@ func (bsc *BaseSignCtrled) GetThreshold() int {
 	return bsc.threshold
 }
 
-// GetMissedInARow returns the number of blocks missed in a row.
+// GetMissedInARow returns the number of missed blocks that count towards the next
+// rank update. With the default policy, these are the blocks missed in a row.
 func (bsc *BaseSignCtrled) GetMissedInARow() int {
-	return bsc.missedInARow
+	return bsc.policy.Count()
+}
+
+// GetRankPolicy returns the policy that decides when a rank update is due.
+func (bsc *BaseSignCtrled) GetRankPolicy() RankPolicy {
+	return bsc.policy
+}
+
+// SetRankPolicy sets the policy that decides when a rank update is due. It defaults
+// to a ConsecutivePolicy with the threshold passed to NewBaseSignCtrled.
+func (bsc *BaseSignCtrled) SetRankPolicy(policy RankPolicy) {
+	bsc.policy = policy
+	bsc.publish()
 }
 
 // GetRank returns the validators current rank.
@@ -110,57 +192,134 @@ func (bsc *BaseSignCtrled) GetRank() int {
 // SetRank sets the validator's rank to the given rank.
 func (bsc *BaseSignCtrled) SetRank(rank int) {
 	bsc.rank = rank
+	bsc.publish()
 }
 
-// Missed updates the counter for missed blocks in a row. Errors are returned if...
+// SetDrainedRanks sets the ranks that are taken out of the promotion line. A drained
+// rank keeps its rank on rank updates and is skipped by the ranks below it.
+func (bsc *BaseSignCtrled) SetDrainedRanks(ranks []int) {
+	bsc.drained.mtx.Lock()
+	defer bsc.drained.mtx.Unlock()
+	bsc.drained.ranks = make(map[int]bool)
+	for _, rank := range ranks {
+		bsc.drained.ranks[rank] = true
+	}
+}
+
+// GetDrainedRanks returns the drained ranks in ascending order.
+func (bsc *BaseSignCtrled) GetDrainedRanks() []int {
+	bsc.drained.mtx.Lock()
+	defer bsc.drained.mtx.Unlock()
+	var ranks []int
+	for rank := range bsc.drained.ranks {
+		ranks = append(ranks, rank)
+	}
+	sort.Ints(ranks)
+
+	return ranks
+}
+
+// IsDrained checks whether the given rank is drained.
+func (bsc *BaseSignCtrled) IsDrained(rank int) bool {
+	bsc.drained.mtx.Lock()
+	defer bsc.drained.mtx.Unlock()
+	return bsc.drained.ranks[rank]
+}
+
+// RemoveRanks removes the given ranks from the set. The ranks below a removed rank move
+// up, and so do the drained ranks. ErrRemovedFromSet is returned if the validator's own
+// rank is removed.
+func (bsc *BaseSignCtrled) RemoveRanks(removed []int) error {
+	shift := func(rank int) (int, bool) {
+		newRank := rank
+		for _, r := range removed {
+			if r == rank {
+				return 0, false
+			}
+			if r < rank {
+				newRank--
+			}
+		}
+		return newRank, true
+	}
+
+	var drained []int
+	for _, rank := range bsc.GetDrainedRanks() {
+		if newRank, ok := shift(rank); ok {
+			drained = append(drained, newRank)
+		}
+	}
+	bsc.SetDrainedRanks(drained)
+
+	newRank, ok := shift(bsc.rank)
+	if !ok {
+		return ErrRemovedFromSet
+	}
+	if newRank != bsc.rank {
+		bsc.Logger.Info("Move up due to removed ranks %v (%v -> %v)", removed, bsc.rank, newRank)
+		bsc.rank = newRank
+		bsc.publish()
+	}
+
+	return nil
+}
+
+// Missed records the given block as missed with the rank policy. Errors are returned if...
 //
-// 1) the threshold of too many blocks missed in a row is exceeded
+// 1) the rank policy's threshold of too many missed blocks is exceeded
 // 2) the validator's promotion fails
 // 3) the counter for missed blocks in a row is still locked
 //
 // Implements the SignCtrled interface.
-func (bsc *BaseSignCtrled) Missed() error {
+func (bsc *BaseSignCtrled) Missed(b Block) error {
 	if bsc.counterLocked {
 		return ErrCounterLocked
 	}
+	defer bsc.publish()
 
-	bsc.missedInARow++
-	if bsc.missedInARow < bsc.threshold {
-		bsc.Logger.Info("Missed a block (%v/%v)", bsc.missedInARow, bsc.threshold)
-	} else if bsc.missedInARow == bsc.threshold {
-		bsc.Logger.Info("Missed too many blocks in a row (%v/%v)", bsc.missedInARow, bsc.threshold)
-		bsc.OnMissedTooMany()
-		if err := bsc.Promote(); err != nil {
-			return err
-		}
+	if !bsc.policy.Missed(b) {
+		bsc.Logger.Info("Missed a block (%v)", bsc.policy.Progress())
+		return nil
+	}
 
-		// When a rank update due to ErrThresholdExceeded is triggered, it is expected
-		// that the next block will not contain the validator's signature. This is due
-		// to a block containing the commit of the previous height which we know wasn't
-		// signed. Therefore, skip ahead.
-		// This is also the reason why the minimum threshold for blocks missed in a row
-		// is at 2.
-		bsc.currentHeight++
-		return ErrThresholdExceeded
+	bsc.Logger.Info("Missed too many blocks (%v)", bsc.policy.Progress())
+	bsc.impl.OnMissedTooMany()
+	if err := bsc.Promote(); err != nil {
+		return err
 	}
 
-	return nil
+	// When a rank update due to ErrThresholdExceeded is triggered, it is expected
+	// that the next block will not contain the validator's signature. This is due
+	// to a block containing the commit of the previous height which we know wasn't
+	// signed. Therefore, skip ahead.
+	// This is also the reason why the minimum threshold for blocks missed in a row
+	// is at 2.
+	bsc.currentHeight++
+	return ErrThresholdExceeded
 }
 
 // OnMissedTooMany does nothing. This way, users don't need to call BaseSignCtrled.OnMissedTooMany().
 // Implements the SignCtrled interface.
 func (bsc *BaseSignCtrled) OnMissedTooMany() {}
 
-// Reset resets the counter for missed blocks in a row to 0.
+// Signed records the given block as signed with the rank policy.
+// Implements the SignCtrled interface.
+func (bsc *BaseSignCtrled) Signed(b Block) {
+	bsc.policy.Signed(b)
+	bsc.publish()
+}
+
+// Reset resets the counter for missed blocks to 0.
 // Implements the SignCtrled interface.
 func (bsc *BaseSignCtrled) Reset() {
-	if bsc.missedInARow > 0 {
-		bsc.Logger.Debug("Reset counter for missed blocks in a row")
-		bsc.missedInARow = 0
+	if bsc.policy.Count() > 0 {
+		bsc.Logger.Debug("Reset counter for missed blocks")
 	}
+	bsc.policy.Reset()
+	bsc.publish()
 }
 
-// Promote moves the validator up one rank. An error is returned if the validator
+// Promote moves the validator up one rank, skipping drained ranks. An error is returned if the validator
 // cannot be promoted anymore and it has to be shut down consequently.
 // This method is only supposed to be called from within the Missed method and never
 // on its own.
@@ -170,10 +329,23 @@ func (bsc *BaseSignCtrled) Promote() error {
 		return ErrMustShutdown
 	}
 
-	bsc.Logger.Info("Promote validator (%v -> %v)", bsc.rank, bsc.rank-1)
-	bsc.rank--
+	// A drained rank is out of the promotion line and keeps its rank.
+	if bsc.IsDrained(bsc.rank) {
+		bsc.Logger.Info("Rank %v is drained, skip promotion", bsc.rank)
+		bsc.Reset()
+		return nil
+	}
+
+	// Skip the drained ranks above. Rank 1 can't be drained.
+	rank := bsc.rank - 1
+	for rank > 1 && bsc.IsDrained(rank) {
+		rank--
+	}
+
+	bsc.Logger.Info("Promote validator (%v -> %v)", bsc.rank, rank)
+	bsc.rank = rank
 	bsc.Reset()
-	bsc.OnPromote()
+	bsc.impl.OnPromote()
 
 	return nil
 }
@@ -8,6 +8,11 @@ import (
 
 type testSignCtrled struct {
 	BaseSignCtrled
+	promotions int
+}
+
+func (sc *testSignCtrled) OnPromote() {
+	sc.promotions++
 }
 
 func TestMissed(t *testing.T) {
@@ -15,13 +20,13 @@ func TestMissed(t *testing.T) {
 	sc.BaseSignCtrled = *NewBaseSignCtrled(nil, 2, 1, sc)
 
 	sc.UnlockCounter()
-	err := sc.Missed()
+	err := sc.Missed(Block{Height: 1})
 	assert.NoError(t, err)
 	assert.Equal(t, 1, sc.GetMissedInARow())
 	assert.Equal(t, 1, sc.GetRank())
 
 	sc.LockCounter()
-	err = sc.Missed()
+	err = sc.Missed(Block{Height: 2})
 	assert.ErrorIs(t, ErrCounterLocked, err)
 	assert.Equal(t, 1, sc.GetMissedInARow())
 	assert.Equal(t, 1, sc.GetRank())
@@ -32,27 +37,122 @@ func TestThresholdExceeded(t *testing.T) {
 	sc.BaseSignCtrled = *NewBaseSignCtrled(nil, 1, 2, sc)
 
 	sc.UnlockCounter()
-	err := sc.Missed()
+	err := sc.Missed(Block{Height: 1})
 	assert.ErrorIs(t, ErrThresholdExceeded, err)
 	assert.Equal(t, 0, sc.GetMissedInARow())
 	assert.Equal(t, 1, sc.GetRank())
+	assert.Equal(t, 1, sc.promotions)
+}
+
+func TestGetSnapshot(t *testing.T) {
+	sc := &testSignCtrled{}
+	sc.BaseSignCtrled = *NewBaseSignCtrled(nil, 2, 2, sc)
+	assert.Equal(t, 2, sc.GetSnapshot().Rank)
+	assert.Equal(t, int64(1), sc.GetSnapshot().Height)
+
+	sc.UnlockCounter()
+	err := sc.Missed(Block{Height: 1})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sc.GetSnapshot().Counter)
+
+	// The snapshot follows the promotion.
+	err = sc.Missed(Block{Height: 2})
+	assert.ErrorIs(t, ErrThresholdExceeded, err)
+	snapshot := sc.GetSnapshot()
+	assert.Equal(t, sc.GetRank(), snapshot.Rank)
+	assert.Equal(t, sc.GetCurrentHeight(), snapshot.Height)
+	assert.Equal(t, 0, snapshot.Counter)
+
+	// The snapshot's policy is a copy.
+	snapshot.Policy.Missed(Block{Height: 3})
+	assert.Equal(t, 0, sc.GetMissedInARow())
 }
 
 func TestReset(t *testing.T) {
 	sc := &testSignCtrled{}
 	sc.BaseSignCtrled = *NewBaseSignCtrled(nil, 2, 1, sc)
-	sc.missedInARow = 1
 
 	sc.UnlockCounter()
+	err := sc.Missed(Block{Height: 1})
+	assert.NoError(t, err)
 	sc.Reset()
 	assert.Equal(t, 0, sc.GetMissedInARow())
 }
 
+func TestSigned(t *testing.T) {
+	sc := &testSignCtrled{}
+	sc.BaseSignCtrled = *NewBaseSignCtrled(nil, 2, 2, sc)
+
+	sc.UnlockCounter()
+	err := sc.Missed(Block{Height: 1})
+	assert.NoError(t, err)
+	sc.Signed(Block{Height: 2})
+	assert.Equal(t, 0, sc.GetMissedInARow())
+}
+
+func TestSetRankPolicy(t *testing.T) {
+	sc := &testSignCtrled{}
+	sc.BaseSignCtrled = *NewBaseSignCtrled(nil, 2, 2, sc)
+	assert.IsType(t, &ConsecutivePolicy{}, sc.GetRankPolicy())
+
+	// With 2 out of the last 3 blocks, a signed block in between doesn't reset the
+	// counter.
+	sc.SetRankPolicy(NewWindowPolicy(2, 3))
+	sc.UnlockCounter()
+	err := sc.Missed(Block{Height: 1})
+	assert.NoError(t, err)
+	sc.Signed(Block{Height: 2})
+	assert.Equal(t, 1, sc.GetMissedInARow())
+	err = sc.Missed(Block{Height: 3})
+	assert.ErrorIs(t, ErrThresholdExceeded, err)
+	assert.Equal(t, 1, sc.GetRank())
+	assert.Equal(t, 0, sc.GetMissedInARow())
+}
+
 func TestPromote(t *testing.T) {
 	sc := &testSignCtrled{}
 	sc.BaseSignCtrled = *NewBaseSignCtrled(nil, 1, 1, sc)
 
 	sc.UnlockCounter()
-	err := sc.Missed()
+	err := sc.Missed(Block{Height: 1})
 	assert.ErrorIs(t, ErrMustShutdown, err)
 }
+
+func TestPromote_Drained(t *testing.T) {
+	sc := &testSignCtrled{}
+	sc.BaseSignCtrled = *NewBaseSignCtrled(nil, 1, 4, sc)
+	sc.SetDrainedRanks([]int{3, 2})
+	assert.Equal(t, []int{2, 3}, sc.GetDrainedRanks())
+	assert.True(t, sc.IsDrained(2))
+	assert.False(t, sc.IsDrained(4))
+
+	// Rank 4 skips the drained ranks 3 and 2.
+	err := sc.Promote()
+	assert.NoError(t, err)
+	assert.Equal(t, 1, sc.GetRank())
+	assert.Equal(t, 1, sc.promotions)
+
+	// A drained rank keeps its rank.
+	sc.SetRank(3)
+	err = sc.Promote()
+	assert.NoError(t, err)
+	assert.Equal(t, 3, sc.GetRank())
+	assert.Equal(t, 1, sc.promotions)
+}
+
+func TestRemoveRanks(t *testing.T) {
+	sc := &testSignCtrled{}
+	sc.BaseSignCtrled = *NewBaseSignCtrled(nil, 2, 5, sc)
+	sc.SetDrainedRanks([]int{3, 4})
+
+	// Rank 5 moves up past the removed ranks 2 and 4, while the drained rank 3 moves
+	// up past rank 2 and the drained rank 4 is gone.
+	err := sc.RemoveRanks([]int{2, 4})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, sc.GetRank())
+	assert.Equal(t, []int{2}, sc.GetDrainedRanks())
+	assert.Equal(t, 0, sc.promotions)
+
+	err = sc.RemoveRanks([]int{3})
+	assert.ErrorIs(t, err, ErrRemovedFromSet)
+}